@@ -1,6 +1,140 @@
 package accounts
 
+import (
+	"slices"
+	"time"
+
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/assets"
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/fx"
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/transactions"
+)
+
+// AccountBalance is the state of an account right after the entry with the
+// given sequence. AsOf echoes the requested point in time, if any. Posted is
+// what the entries of the account add up to, Available is Posted less what
+// pending holds reserve. Balances is Posted, kept for existing clients.
 type AccountBalance struct {
-	AccountId string           `json:"account_id"`
-	Balances  map[string]int64 `json:"balances"`
+	AccountId string                   `json:"account_id"`
+	Sequence  uint64                   `json:"sequence"`
+	AsOf      *time.Time               `json:"as_of,omitempty"`
+	Balances  map[string]assets.Amount `json:"balances"`
+	Posted    map[string]assets.Amount `json:"posted"`
+	Available map[string]assets.Amount `json:"available"`
+	Valuation *fx.Valuation            `json:"valuation,omitempty"`
+}
+
+// BalanceQuery selects a point in time for a balance, either a timestamp or a
+// ledger sequence. Without either the current balance is returned.
+// ValuationCurrency adds the value of all balances in that currency.
+type BalanceQuery struct {
+	AsOf              *time.Time `form:"as_of"`
+	AtSequence        *uint64    `form:"at_sequence"`
+	ValuationCurrency string     `form:"valuation_currency"`
+	Rounding          string     `form:"rounding"`
+}
+
+// AccountPolicies lists the policies assigned to an account and the one in
+// effect for each asset it holds or has a policy for.
+type AccountPolicies struct {
+	AccountId string                                `json:"account_id"`
+	Assigned  []transactions.AccountPolicy          `json:"assigned"`
+	Effective map[string]transactions.BalancePolicy `json:"effective"`
+}
+
+// PolicyDto assigns a policy to the account, or to one asset of it.
+type PolicyDto struct {
+	Asset       string `json:"asset"`
+	Type        string `json:"type" binding:"required,oneof=no_overdraft credit_limit unlimited"`
+	CreditLimit int64  `json:"credit_limit" binding:"min=0"`
+}
+
+const (
+	StatusActive = "active"
+	StatusFrozen = "frozen"
+	StatusClosed = "closed"
+)
+
+// Account is a registered ledger account. A frozen account keeps its balance
+// but takes no new postings until it is reactivated; closing is final.
+type Account struct {
+	AccountId string            `json:"account_id"`
+	Name      string            `json:"name,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	// AllowedAssets restricts the assets the account can hold, empty allows any.
+	AllowedAssets []string  `json:"allowed_assets,omitempty"`
+	Status        string    `json:"status"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+func (a Account) AllowsAsset(asset string) bool {
+	return len(a.AllowedAssets) == 0 || slices.Contains(a.AllowedAssets, asset)
+}
+
+type AccountDto struct {
+	AccountId     string            `json:"account_id" binding:"required,max=128"`
+	Name          string            `json:"name" binding:"max=256"`
+	Metadata      map[string]string `json:"metadata"`
+	AllowedAssets []string          `json:"allowed_assets" binding:"dive,required"`
+}
+
+type StatusChangeDto struct {
+	Status string `json:"status" binding:"required,oneof=active frozen closed"`
+	Reason string `json:"reason" binding:"max=512"`
+}
+
+// StatusChange is an entry of the account audit trail. From is empty for the
+// creation of the account.
+type StatusChange struct {
+	AccountId string    `json:"account_id"`
+	From      string    `json:"from,omitempty"`
+	To        string    `json:"to"`
+	Reason    string    `json:"reason,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type AccountFilters struct {
+	Status string `form:"status" binding:"omitempty,oneof=active frozen closed"`
+}
+
+// AccountRejection is returned as the details of a posting the registry refused.
+type AccountRejection struct {
+	AccountId string `json:"account_id"`
+	Asset     string `json:"asset"`
+	Status    string `json:"status,omitempty"`
+}
+
+type StatementQuery struct {
+	From  *time.Time `form:"from"`
+	To    *time.Time `form:"to"`
+	Asset string     `form:"asset" binding:"required"`
+}
+
+// Statement lists the activity of an account in one asset over a period.
+// Opening is the balance before the first entry of the period, every line
+// carries the balance after it, and Closing is the balance after the last one.
+type Statement struct {
+	AccountId    string          `json:"account_id"`
+	Asset        string          `json:"asset"`
+	From         *time.Time      `json:"from,omitempty"`
+	To           *time.Time      `json:"to,omitempty"`
+	Sequence     uint64          `json:"sequence"`
+	Opening      assets.Amount   `json:"opening_balance"`
+	TotalDebits  assets.Amount   `json:"total_debits"`
+	TotalCredits assets.Amount   `json:"total_credits"`
+	Closing      assets.Amount   `json:"closing_balance"`
+	Entries      []StatementLine `json:"entries"`
+}
+
+// StatementLine is the effect of one ledger entry on the account. Debit and
+// Credit add up the legs of the entry on the account in the asset.
+type StatementLine struct {
+	Sequence       uint64        `json:"sequence"`
+	TransactionId  string        `json:"transaction_id"`
+	Timestamp      time.Time     `json:"timestamp"`
+	Description    string        `json:"description,omitempty"`
+	ReversalOf     string        `json:"reversal_of,omitempty"`
+	Debit          assets.Amount `json:"debit"`
+	Credit         assets.Amount `json:"credit"`
+	RunningBalance assets.Amount `json:"running_balance"`
 }
@@ -0,0 +1,115 @@
+package accounts
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/transactions"
+)
+
+// PolicyStore keeps the balance policies assigned to accounts in a JSON file
+// and loads them into the ledger, which enforces them on every append.
+type PolicyStore struct {
+	transactionDb *transactions.TranasctionDatabase
+	path          string
+	mut           sync.Mutex
+}
+
+func NewPolicyStore(transactionDb *transactions.TranasctionDatabase, path string) (*PolicyStore, error) {
+	s := &PolicyStore{
+		transactionDb: transactionDb,
+		path:          path,
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read balance policies: %w", err)
+	}
+	var rules []transactions.AccountPolicy
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("decode balance policies: %w", err)
+	}
+	for _, rule := range rules {
+		if err := transactionDb.SetBalancePolicy(rule); err != nil {
+			return nil, fmt.Errorf("balance policy of %s: %w", rule.AccountId, err)
+		}
+	}
+	return s, nil
+}
+
+// Set saves the full list with the policy in it, then assigns it in the
+// ledger, so a policy that could not be saved is never enforced.
+func (s *PolicyStore) Set(rule transactions.AccountPolicy) error {
+	if err := rule.Validate(); err != nil {
+		return err
+	}
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	rules := s.transactionDb.BalancePolicies()
+	index := slices.IndexFunc(rules, func(existing transactions.AccountPolicy) bool {
+		return existing.AccountId == rule.AccountId && existing.Asset == rule.Asset
+	})
+	if index >= 0 {
+		rules[index] = rule
+	} else {
+		rules = append(rules, rule)
+	}
+	if err := s.persist(rules); err != nil {
+		return err
+	}
+	return s.transactionDb.SetBalancePolicy(rule)
+}
+
+// Get returns the policies assigned to an account and, for every asset it
+// holds, the policy that is in effect.
+func (s *PolicyStore) Get(accountId string) AccountPolicies {
+	policies := AccountPolicies{
+		AccountId: accountId,
+		Assigned:  []transactions.AccountPolicy{},
+		Effective: make(map[string]transactions.BalancePolicy),
+	}
+	for _, rule := range s.transactionDb.BalancePolicies() {
+		if rule.AccountId == accountId {
+			policies.Assigned = append(policies.Assigned, rule)
+		}
+	}
+	balances, _ := s.transactionDb.GetBalances(accountId)
+	for asset := range balances {
+		policies.Effective[asset] = s.transactionDb.ResolveBalancePolicy(accountId, asset)
+	}
+	for _, rule := range policies.Assigned {
+		if rule.Asset != "" {
+			policies.Effective[rule.Asset] = rule.BalancePolicy
+		}
+	}
+	return policies
+}
+
+// persist replaces the file through a rename, so a crash leaves either the old
+// or the new list.
+func (s *PolicyStore) persist(rules []transactions.AccountPolicy) error {
+	data, err := json.MarshalIndent(rules, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("create policies directory: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("write balance policies: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("replace balance policies: %w", err)
+	}
+	return nil
+}
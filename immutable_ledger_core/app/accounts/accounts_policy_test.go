@@ -0,0 +1,44 @@
+package accounts
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/transactions"
+)
+
+func TestPolicyStoreSetKeepsLedgerAndFileInStep(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policies.json")
+	transactionDb := transactions.NewSafeTranasctionDatabase()
+	store, err := NewPolicyStore(transactionDb, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	limit := transactions.AccountPolicy{AccountId: "alice", BalancePolicy: transactions.BalancePolicy{Type: transactions.PolicyCreditLimit, CreditLimit: 500}}
+	if err := store.Set(limit); err != nil {
+		t.Fatal(err)
+	}
+
+	// A directory in the way of the temporary file makes the next save fail,
+	// a policy that cannot be saved must not be enforced either.
+	if err := os.Mkdir(path+".tmp", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	noOverdraft := transactions.AccountPolicy{AccountId: "alice", BalancePolicy: transactions.BalancePolicy{Type: transactions.PolicyNoOverdraft}}
+	if err := store.Set(noOverdraft); err == nil {
+		t.Fatal("Set succeeded without saving the policy")
+	}
+	if got := transactionDb.ResolveBalancePolicy("alice", "USD"); got != limit.BalancePolicy {
+		t.Fatalf("policy in effect = %+v, want %+v", got, limit.BalancePolicy)
+	}
+
+	reloadedDb := transactions.NewSafeTranasctionDatabase()
+	if _, err := NewPolicyStore(reloadedDb, path); err != nil {
+		t.Fatal(err)
+	}
+	if got := reloadedDb.ResolveBalancePolicy("alice", "USD"); got != limit.BalancePolicy {
+		t.Fatalf("reloaded policy = %+v, want %+v", got, limit.BalancePolicy)
+	}
+}
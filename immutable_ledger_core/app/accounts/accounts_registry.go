@@ -0,0 +1,314 @@
+package accounts
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/transactions"
+)
+
+// Registry holds the accounts the ledger accepts postings for. Accounts are
+// kept in a JSON file rewritten on every change, status changes are appended
+// to a JSON lines audit trail before the account itself is updated.
+type Registry struct {
+	accountsPath string
+	auditPath    string
+
+	mut      sync.RWMutex
+	accounts map[string]Account
+	audit    []StatusChange
+}
+
+func NewRegistry(accountsPath string, auditPath string) (*Registry, error) {
+	r := &Registry{
+		accountsPath: accountsPath,
+		auditPath:    auditPath,
+		accounts:     make(map[string]Account),
+	}
+
+	data, err := os.ReadFile(accountsPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("read accounts: %w", err)
+	}
+	if err == nil {
+		var accounts []Account
+		if err := json.Unmarshal(data, &accounts); err != nil {
+			return nil, fmt.Errorf("decode accounts: %w", err)
+		}
+		for _, account := range accounts {
+			r.accounts[account.AccountId] = account
+		}
+	}
+
+	file, err := os.Open(auditPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open account audit trail: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var change StatusChange
+		if err := json.Unmarshal(scanner.Bytes(), &change); err != nil {
+			return nil, fmt.Errorf("decode account audit trail: %w", err)
+		}
+		r.audit = append(r.audit, change)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read account audit trail: %w", err)
+	}
+	return r, nil
+}
+
+func (r *Registry) Create(accountDto AccountDto) (Account, error) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	if _, exists := r.accounts[accountDto.AccountId]; exists {
+		return Account{}, &transactions.TransactionConflictError{
+			Message: fmt.Sprintf("Account %s already exists", accountDto.AccountId),
+			Code:    http.StatusConflict,
+		}
+	}
+
+	now := time.Now().UTC()
+	account := Account{
+		AccountId:     accountDto.AccountId,
+		Name:          accountDto.Name,
+		Metadata:      maps.Clone(accountDto.Metadata),
+		AllowedAssets: slices.Clone(accountDto.AllowedAssets),
+		Status:        StatusActive,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if err := r.record(account, StatusChange{
+		AccountId: account.AccountId,
+		To:        StatusActive,
+		Reason:    "created",
+		Timestamp: now,
+	}); err != nil {
+		return Account{}, err
+	}
+	return account, nil
+}
+
+func (r *Registry) Get(accountId string) (Account, error) {
+	r.mut.RLock()
+	defer r.mut.RUnlock()
+	account, exists := r.accounts[accountId]
+	if !exists {
+		return Account{}, &transactions.TransactionNotFoundError{
+			Message: fmt.Sprintf("Account %s not found", accountId),
+			Code:    http.StatusNotFound,
+		}
+	}
+	return account, nil
+}
+
+// List returns the accounts ordered by ID.
+func (r *Registry) List(filters AccountFilters) []Account {
+	r.mut.RLock()
+	defer r.mut.RUnlock()
+	accounts := []Account{}
+	for _, account := range r.accounts {
+		if filters.Status != "" && account.Status != filters.Status {
+			continue
+		}
+		accounts = append(accounts, account)
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		return accounts[i].AccountId < accounts[j].AccountId
+	})
+	return accounts
+}
+
+// SetStatus moves an account between active and frozen, or closes it. A closed
+// account cannot be reopened.
+func (r *Registry) SetStatus(accountId string, statusDto StatusChangeDto) (Account, error) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	account, exists := r.accounts[accountId]
+	if !exists {
+		return Account{}, &transactions.TransactionNotFoundError{
+			Message: fmt.Sprintf("Account %s not found", accountId),
+			Code:    http.StatusNotFound,
+		}
+	}
+	if account.Status == StatusClosed {
+		return Account{}, &transactions.TransactionRuleViolationError{
+			Message: fmt.Sprintf("Account %s is closed", accountId),
+			Code:    http.StatusConflict,
+		}
+	}
+	if account.Status == statusDto.Status {
+		return Account{}, &transactions.TransactionConflictError{
+			Message: fmt.Sprintf("Account %s is already %s", accountId, statusDto.Status),
+			Code:    http.StatusConflict,
+		}
+	}
+
+	now := time.Now().UTC()
+	change := StatusChange{
+		AccountId: accountId,
+		From:      account.Status,
+		To:        statusDto.Status,
+		Reason:    statusDto.Reason,
+		Timestamp: now,
+	}
+	account.Status = statusDto.Status
+	account.UpdatedAt = now
+	if err := r.record(account, change); err != nil {
+		return Account{}, err
+	}
+	return account, nil
+}
+
+// AuditTrail returns the status changes of an account, oldest first.
+func (r *Registry) AuditTrail(accountId string) ([]StatusChange, error) {
+	r.mut.RLock()
+	defer r.mut.RUnlock()
+	if _, exists := r.accounts[accountId]; !exists {
+		return nil, &transactions.TransactionNotFoundError{
+			Message: fmt.Sprintf("Account %s not found", accountId),
+			Code:    http.StatusNotFound,
+		}
+	}
+	changes := []StatusChange{}
+	for _, change := range r.audit {
+		if change.AccountId == accountId {
+			changes = append(changes, change)
+		}
+	}
+	return changes, nil
+}
+
+// CheckPosting is the transactions.AccountChecker of the registry: postings
+// need an active account that allows the asset. A frozen account still takes
+// the postings of a correction, so its entries can be reversed; a closed one
+// takes nothing.
+func (r *Registry) CheckPosting(accountId string, asset string, correction bool) error {
+	r.mut.RLock()
+	defer r.mut.RUnlock()
+	account, exists := r.accounts[accountId]
+	if !exists {
+		return &transactions.TransactionRuleViolationError{
+			Message: fmt.Sprintf("Account %s does not exist", accountId),
+			Code:    http.StatusUnprocessableEntity,
+			Details: AccountRejection{AccountId: accountId, Asset: asset},
+		}
+	}
+	if account.Status != StatusActive && (account.Status != StatusFrozen || !correction) {
+		return &transactions.TransactionRuleViolationError{
+			Message: fmt.Sprintf("Account %s is %s", accountId, account.Status),
+			Code:    http.StatusUnprocessableEntity,
+			Details: AccountRejection{AccountId: accountId, Asset: asset, Status: account.Status},
+		}
+	}
+	if !account.AllowsAsset(asset) {
+		return &transactions.TransactionRuleViolationError{
+			Message: fmt.Sprintf("Account %s does not allow %s", accountId, asset),
+			Code:    http.StatusUnprocessableEntity,
+			Details: AccountRejection{AccountId: accountId, Asset: asset, Status: account.Status},
+		}
+	}
+	return nil
+}
+
+// record appends the status change to the audit trail, then saves the
+// account. When the account cannot be saved the change is taken back out of
+// the audit trail, so the trail never records a change that did not happen.
+// Callers must hold the write lock.
+func (r *Registry) record(account Account, change StatusChange) error {
+	line, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.auditPath), 0o755); err != nil {
+		return fmt.Errorf("create audit directory: %w", err)
+	}
+	file, err := os.OpenFile(r.auditPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("open account audit trail: %w", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("stat account audit trail: %w", err)
+	}
+	auditSize := info.Size()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return errors.Join(fmt.Errorf("write account audit trail: %w", err), truncateAudit(file, auditSize))
+	}
+	if err := file.Sync(); err != nil {
+		return errors.Join(fmt.Errorf("sync account audit trail: %w", err), truncateAudit(file, auditSize))
+	}
+
+	previous, existed := r.accounts[account.AccountId]
+	r.accounts[account.AccountId] = account
+	if err := r.persist(); err != nil {
+		if existed {
+			r.accounts[account.AccountId] = previous
+		} else {
+			delete(r.accounts, account.AccountId)
+		}
+		return errors.Join(err, truncateAudit(file, auditSize))
+	}
+	r.audit = append(r.audit, change)
+	return nil
+}
+
+// truncateAudit cuts the audit trail back to size, dropping a line whose
+// change was not applied.
+func truncateAudit(file *os.File, size int64) error {
+	if err := file.Truncate(size); err != nil {
+		return fmt.Errorf("roll back account audit trail: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("roll back account audit trail: %w", err)
+	}
+	return nil
+}
+
+// persist replaces the accounts file through a rename, so a crash leaves
+// either the old or the new list.
+func (r *Registry) persist() error {
+	accounts := make([]Account, 0, len(r.accounts))
+	for _, account := range r.accounts {
+		accounts = append(accounts, account)
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		return accounts[i].AccountId < accounts[j].AccountId
+	})
+	data, err := json.MarshalIndent(accounts, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.accountsPath), 0o755); err != nil {
+		return fmt.Errorf("create accounts directory: %w", err)
+	}
+	tmp := r.accountsPath + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("write accounts: %w", err)
+	}
+	if err := os.Rename(tmp, r.accountsPath); err != nil {
+		return fmt.Errorf("replace accounts: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package accounts
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/transactions"
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/utils"
+)
+
+func TestRegistryRecordsOnlyAppliedChanges(t *testing.T) {
+	dir := t.TempDir()
+	accountsPath := filepath.Join(dir, "accounts.json")
+	auditPath := filepath.Join(dir, "accounts_audit.jsonl")
+	registry, err := NewRegistry(accountsPath, auditPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.Create(AccountDto{AccountId: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A directory in the way of the temporary file makes the accounts file
+	// impossible to save from here on.
+	if err := os.Mkdir(accountsPath+".tmp", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.SetStatus("alice", StatusChangeDto{Status: StatusFrozen}); err == nil {
+		t.Fatal("SetStatus succeeded without saving the account")
+	}
+	if _, err := registry.Create(AccountDto{AccountId: "bob"}); err == nil {
+		t.Fatal("Create succeeded without saving the account")
+	}
+
+	check := func(registry *Registry) {
+		t.Helper()
+		account, err := registry.Get("alice")
+		if err != nil || account.Status != StatusActive {
+			t.Fatalf("alice = %+v, %v; want it active", account, err)
+		}
+		if _, err := registry.Get("bob"); err == nil {
+			t.Fatal("bob exists although it was never saved")
+		}
+		changes, err := registry.AuditTrail("alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(changes) != 1 || changes[0].To != StatusActive {
+			t.Fatalf("audit trail = %+v, want only the creation", changes)
+		}
+		if len(registry.audit) != 1 {
+			t.Fatalf("audit trail holds %d changes, want 1", len(registry.audit))
+		}
+	}
+	check(registry)
+
+	reloaded, err := NewRegistry(accountsPath, auditPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(reloaded)
+}
+
+func TestReversalsOnAccountsByStatus(t *testing.T) {
+	tests := []struct {
+		status string
+		// code is what posting to or reversing onto bob answers, 0 when accepted.
+		postCode    int
+		reverseCode int
+	}{
+		{StatusActive, 0, 0},
+		{StatusFrozen, 422, 0},
+		{StatusClosed, 422, 422},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			dir := t.TempDir()
+			registry, err := NewRegistry(filepath.Join(dir, "accounts.json"), filepath.Join(dir, "accounts_audit.jsonl"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, accountId := range []string{"cash", "bob"} {
+				if _, err := registry.Create(AccountDto{AccountId: accountId}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			transactionDb := transactions.NewSafeTranasctionDatabase()
+			transactionDb.SetAccountChecker(registry.CheckPosting)
+			movement := transactions.TransactionDto{Postings: []transactions.PostingDto{
+				{AccountId: "cash", Direction: transactions.DirectionDebit, Amount: 100, Unit: "USD"},
+				{AccountId: "bob", Direction: transactions.DirectionCredit, Amount: 100, Unit: "USD"},
+			}}
+			original, _, err := transactions.CreateTransaction(movement, utils.GenerateID, utils.GenerateHash, transactionDb)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.status != StatusActive {
+				if _, err := registry.SetStatus("bob", StatusChangeDto{Status: tt.status}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			_, _, err = transactions.CreateTransaction(movement, utils.GenerateID, utils.GenerateHash, transactionDb)
+			if code := errorCode(err); code != tt.postCode {
+				t.Fatalf("posting to a %s account = %v, want code %d", tt.status, err, tt.postCode)
+			}
+			_, _, err = transactions.ReverseTransaction(original.TransactionId, transactions.ReversalDto{}, utils.GenerateID, utils.GenerateHash, transactionDb)
+			if code := errorCode(err); code != tt.reverseCode {
+				t.Fatalf("reversing onto a %s account = %v, want code %d", tt.status, err, tt.reverseCode)
+			}
+		})
+	}
+}
+
+// errorCode is the HTTP code carried by err, 0 when it is not a TransactionError.
+func errorCode(err error) int {
+	var transErr transactions.TransactionError
+	if errors.As(err, &transErr) {
+		return transErr.GetCode()
+	}
+	return 0
+}
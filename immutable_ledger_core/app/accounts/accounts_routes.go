@@ -2,10 +2,12 @@ package accounts
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/assets"
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/fx"
 	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/transactions"
 )
 
-func GetAccountBalanceHanlder(transactionDb *transactions.TranasctionDatabase) gin.HandlerFunc {
+func GetAccountBalanceHanlder(transactionDb *transactions.TranasctionDatabase, assetRegistry *assets.Registry, rateStore *fx.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		accountId := c.Param("account_id")
 		if accountId == "" {
@@ -14,10 +16,155 @@ func GetAccountBalanceHanlder(transactionDb *transactions.TranasctionDatabase) g
 			})
 			return
 		}
-		balance := GetAccountBalanceService(transactionDb, accountId)
+
+		var query BalanceQuery
+		if err := c.ShouldBindQuery(&query); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		balance, err := GetAccountBalanceService(transactionDb, assetRegistry, rateStore, accountId, query)
+		if err != nil {
+			transactions.WriteError(c, err)
+			return
+		}
 		c.JSON(200, gin.H{
 			"account_id": accountId,
 			"balance":    balance,
 		})
 	}
 }
+
+func GetAccountPoliciesHandler(policyStore *PolicyStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(200, gin.H{
+			"policies": policyStore.Get(c.Param("account_id")),
+		})
+	}
+}
+
+func SetAccountPolicyHandler(policyStore *PolicyStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var policyDto PolicyDto
+		if err := c.BindJSON(&policyDto); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		accountId := c.Param("account_id")
+		err := policyStore.Set(transactions.AccountPolicy{
+			AccountId: accountId,
+			Asset:     policyDto.Asset,
+			BalancePolicy: transactions.BalancePolicy{
+				Type:        policyDto.Type,
+				CreditLimit: policyDto.CreditLimit,
+			},
+		})
+		if err != nil {
+			transactions.WriteError(c, err)
+			return
+		}
+		c.JSON(200, gin.H{
+			"policies": policyStore.Get(accountId),
+		})
+	}
+}
+
+func CreateAccountHandler(registry *Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var accountDto AccountDto
+		if err := c.BindJSON(&accountDto); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		account, err := registry.Create(accountDto)
+		if err != nil {
+			transactions.WriteError(c, err)
+			return
+		}
+		c.JSON(201, gin.H{
+			"message": "Account created",
+			"account": account,
+		})
+	}
+}
+
+func ListAccountsHandler(registry *Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var filters AccountFilters
+		if err := c.ShouldBindQuery(&filters); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{
+			"accounts": registry.List(filters),
+		})
+	}
+}
+
+func GetAccountHandler(registry *Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		account, err := registry.Get(c.Param("account_id"))
+		if err != nil {
+			transactions.WriteError(c, err)
+			return
+		}
+		c.JSON(200, gin.H{
+			"account": account,
+		})
+	}
+}
+
+func SetAccountStatusHandler(registry *Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var statusDto StatusChangeDto
+		if err := c.BindJSON(&statusDto); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		account, err := registry.SetStatus(c.Param("account_id"), statusDto)
+		if err != nil {
+			transactions.WriteError(c, err)
+			return
+		}
+		c.JSON(200, gin.H{
+			"account": account,
+		})
+	}
+}
+
+func GetAccountAuditHandler(registry *Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		accountId := c.Param("account_id")
+		changes, err := registry.AuditTrail(accountId)
+		if err != nil {
+			transactions.WriteError(c, err)
+			return
+		}
+		c.JSON(200, gin.H{
+			"account_id": accountId,
+			"changes":    changes,
+		})
+	}
+}
+
+func GetAccountStatementHandler(transactionDb *transactions.TranasctionDatabase, assetRegistry *assets.Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var query StatementQuery
+		if err := c.ShouldBindQuery(&query); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		statement, err := GetAccountStatementService(transactionDb, assetRegistry, c.Param("account_id"), query)
+		if err != nil {
+			transactions.WriteError(c, err)
+			return
+		}
+		c.JSON(200, gin.H{
+			"statement": statement,
+		})
+	}
+}
@@ -1,23 +1,69 @@
 package accounts
 
-import "github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/transactions"
+import (
+	"maps"
+	"net/http"
+	"time"
 
-func GetAccountBalanceService(transactionDb *transactions.TranasctionDatabase, accountId string) AccountBalance {
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/assets"
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/fx"
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/transactions"
+)
 
-	accountData := transactionDb.GetDataFromAccount(accountId)
-	balances := make(map[string]int64)
-	for _, tx := range accountData {
-		asset := tx.Asset
-		if _, exists := balances[asset.Unit]; !exists {
-			balances[asset.Unit] = asset.Amount
+func GetAccountBalanceService(transactionDb *transactions.TranasctionDatabase, assetRegistry *assets.Registry, rateStore *fx.Store, accountId string, query BalanceQuery) (AccountBalance, error) {
+	if query.AsOf != nil && query.AtSequence != nil {
+		return AccountBalance{}, &transactions.TransactionValidationError{
+			Message: "as_of and at_sequence cannot be used together",
+			Code:    http.StatusBadRequest,
+		}
+	}
+
+	var balances map[string]int64
+	var sequence uint64
+	// valuedAt is the time FX rates are taken at: the requested time, the
+	// timestamp of the requested entry, or now for the current balance.
+	valuedAt := time.Now().UTC()
+	switch {
+	case query.AsOf == nil && query.AtSequence == nil:
+		balances, sequence = transactionDb.GetBalances(accountId)
+	default:
+		if query.AtSequence != nil {
+			sequence = *query.AtSequence
 		} else {
-			balances[asset.Unit] += asset.Amount
+			sequence = transactionDb.SequenceAt(*query.AsOf)
+		}
+		var err error
+		balances, err = transactionDb.GetBalancesAt(accountId, sequence)
+		if err != nil {
+			return AccountBalance{}, err
 		}
+		if query.AsOf != nil {
+			valuedAt = *query.AsOf
+		} else if timestamp, exists := transactionDb.EntryTimestamp(sequence); exists {
+			valuedAt = timestamp
+		}
+	}
 
+	available := maps.Clone(balances)
+	for asset, held := range transactionDb.GetHeldBalances(accountId, sequence, valuedAt) {
+		available[asset] -= held
 	}
 
-	return AccountBalance{
+	posted := assetRegistry.FormatBalances(balances)
+	balance := AccountBalance{
 		AccountId: accountId,
-		Balances:  balances,
+		Sequence:  sequence,
+		AsOf:      query.AsOf,
+		Balances:  posted,
+		Posted:    posted,
+		Available: assetRegistry.FormatBalances(available),
+	}
+	if query.ValuationCurrency != "" {
+		valuation, err := rateStore.Value(balances, query.ValuationCurrency, valuedAt, query.Rounding, assetRegistry)
+		if err != nil {
+			return AccountBalance{}, err
+		}
+		balance.Valuation = &valuation
 	}
+	return balance, nil
 }
@@ -0,0 +1,68 @@
+package accounts
+
+import (
+	"net/http"
+
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/assets"
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/transactions"
+)
+
+// GetAccountStatementService builds the statement of an account in one asset.
+// Entries of the account in other assets are left out.
+func GetAccountStatementService(transactionDb *transactions.TranasctionDatabase, assetRegistry *assets.Registry, accountId string, query StatementQuery) (Statement, error) {
+	if query.From != nil && query.To != nil && query.To.Before(*query.From) {
+		return Statement{}, &transactions.TransactionValidationError{
+			Message: "to must not be before from",
+			Code:    http.StatusBadRequest,
+		}
+	}
+
+	opening, entries, sequence := transactionDb.AccountActivity(accountId, query.From, query.To)
+
+	balance := opening[query.Asset]
+	var totalDebits, totalCredits int64
+	lines := []StatementLine{}
+	for _, transaction := range entries {
+		var debit, credit int64
+		for _, posting := range transaction.Postings {
+			if posting.AccountId != accountId || posting.Unit != query.Asset {
+				continue
+			}
+			if posting.Direction == transactions.DirectionDebit {
+				debit += posting.Amount
+			} else {
+				credit += posting.Amount
+			}
+		}
+		if debit == 0 && credit == 0 {
+			continue
+		}
+
+		balance += credit - debit
+		totalDebits += debit
+		totalCredits += credit
+		lines = append(lines, StatementLine{
+			Sequence:       transaction.Sequence,
+			TransactionId:  transaction.TransactionId,
+			Timestamp:      transaction.Timestamp,
+			Description:    transaction.Description,
+			ReversalOf:     transaction.ReversalOf,
+			Debit:          assetRegistry.Format(query.Asset, debit),
+			Credit:         assetRegistry.Format(query.Asset, credit),
+			RunningBalance: assetRegistry.Format(query.Asset, balance),
+		})
+	}
+
+	return Statement{
+		AccountId:    accountId,
+		Asset:        query.Asset,
+		From:         query.From,
+		To:           query.To,
+		Sequence:     sequence,
+		Opening:      assetRegistry.Format(query.Asset, opening[query.Asset]),
+		TotalDebits:  assetRegistry.Format(query.Asset, totalDebits),
+		TotalCredits: assetRegistry.Format(query.Asset, totalCredits),
+		Closing:      assetRegistry.Format(query.Asset, balance),
+		Entries:      lines,
+	}, nil
+}
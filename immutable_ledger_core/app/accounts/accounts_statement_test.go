@@ -0,0 +1,117 @@
+package accounts
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/assets"
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/transactions"
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/utils"
+)
+
+func TestAccountStatement(t *testing.T) {
+	assetRegistry, err := assets.NewRegistry(filepath.Join(t.TempDir(), "assets.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, code := range []string{"USD", "EUR"} {
+		scale := 2
+		if _, err := assetRegistry.Create(assets.AssetDto{Code: code, Scale: &scale}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db := transactions.NewSafeTranasctionDatabase()
+	move := func(from, to string, amount int64, unit string) transactions.TransactionModel {
+		t.Helper()
+		// Entries a millisecond apart, so periods can start and end on one.
+		time.Sleep(time.Millisecond)
+		transaction, _, err := transactions.CreateTransaction(transactions.TransactionDto{Postings: []transactions.PostingDto{
+			{AccountId: from, Direction: transactions.DirectionDebit, Amount: amount, Unit: unit},
+			{AccountId: to, Direction: transactions.DirectionCredit, Amount: amount, Unit: unit},
+		}}, utils.GenerateID, utils.GenerateHash, db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return transaction
+	}
+	move("cash", "alice", 10000, "USD")
+	move("cash", "alice", 500, "EUR")
+	spend := move("alice", "bob", 2500, "USD")
+	move("cash", "bob", 1000, "USD")
+	refund := move("bob", "alice", 750, "USD")
+	other := move("alice", "bob", 100, "EUR")
+	late := move("cash", "alice", 100, "USD")
+
+	type line struct {
+		sequence       uint64
+		debit, credit  string
+		runningBalance string
+	}
+	after := late.Timestamp.Add(time.Hour)
+	tests := []struct {
+		name     string
+		from, to *time.Time
+		opening  string
+		lines    []line
+		closing  string
+	}{
+		{
+			name:    "whole history",
+			opening: "0.00",
+			lines: []line{
+				{sequence: 1, debit: "0.00", credit: "100.00", runningBalance: "100.00"},
+				{sequence: spend.Sequence, debit: "25.00", credit: "0.00", runningBalance: "75.00"},
+				{sequence: refund.Sequence, debit: "0.00", credit: "7.50", runningBalance: "82.50"},
+				{sequence: late.Sequence, debit: "0.00", credit: "1.00", runningBalance: "83.50"},
+			},
+			closing: "83.50",
+		},
+		{
+			name:    "period",
+			from:    &spend.Timestamp,
+			to:      &other.Timestamp,
+			opening: "100.00",
+			lines: []line{
+				{sequence: spend.Sequence, debit: "25.00", credit: "0.00", runningBalance: "75.00"},
+				{sequence: refund.Sequence, debit: "0.00", credit: "7.50", runningBalance: "82.50"},
+			},
+			closing: "82.50",
+		},
+		{
+			name:    "period without activity",
+			from:    &after,
+			opening: "83.50",
+			closing: "83.50",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statement, err := GetAccountStatementService(db, assetRegistry, "alice", StatementQuery{From: tt.from, To: tt.to, Asset: "USD"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if statement.Opening.Formatted != tt.opening || statement.Closing.Formatted != tt.closing || statement.Sequence != late.Sequence {
+				t.Fatalf("statement = %+v, want %s to %s as of entry %d", statement, tt.opening, tt.closing, late.Sequence)
+			}
+			if len(statement.Entries) != len(tt.lines) {
+				t.Fatalf("statement has %d lines, want %d: %+v", len(statement.Entries), len(tt.lines), statement.Entries)
+			}
+			for i, want := range tt.lines {
+				got := statement.Entries[i]
+				if got.Sequence != want.sequence || got.Debit.Formatted != want.debit || got.Credit.Formatted != want.credit || got.RunningBalance.Formatted != want.runningBalance {
+					t.Fatalf("line %d = %+v, want %+v", i, got, want)
+				}
+			}
+			// The closing balance is the opening one plus the movements listed.
+			if statement.Opening.Raw+statement.TotalCredits.Raw-statement.TotalDebits.Raw != statement.Closing.Raw {
+				t.Fatalf("opening %d + credits %d - debits %d != closing %d", statement.Opening.Raw, statement.TotalCredits.Raw, statement.TotalDebits.Raw, statement.Closing.Raw)
+			}
+		})
+	}
+
+	if _, err := GetAccountStatementService(db, assetRegistry, "alice", StatementQuery{From: &late.Timestamp, To: &spend.Timestamp, Asset: "USD"}); errorCode(err) != http.StatusBadRequest {
+		t.Fatalf("period ending before it starts = %v, want code 400", err)
+	}
+}
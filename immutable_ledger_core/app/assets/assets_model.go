@@ -0,0 +1,50 @@
+package assets
+
+import (
+	"time"
+
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/utils"
+)
+
+// Asset describes a unit postings can be made in. Amounts of an asset are
+// integers of minor units, Scale is the number of decimal places of a major
+// unit: 2 for USD (cents), 0 for JPY, 8 for BTC (satoshis).
+type Asset struct {
+	Code        string    `json:"code"`
+	Scale       int       `json:"scale"`
+	DisplayName string    `json:"display_name,omitempty"`
+	Enabled     bool      `json:"enabled"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Format renders an amount in minor units of the asset.
+func (a Asset) Format(amount int64) Amount {
+	return Amount{
+		Raw:       amount,
+		Formatted: utils.FormatMinorUnits(amount, a.Scale),
+		Scale:     a.Scale,
+	}
+}
+
+// Amount is an amount in minor units together with its decimal rendering.
+type Amount struct {
+	Raw       int64  `json:"raw"`
+	Formatted string `json:"formatted"`
+	Scale     int    `json:"scale"`
+}
+
+type AssetDto struct {
+	Code        string `json:"code" binding:"required,max=16,alphanum"`
+	Scale       *int   `json:"scale" binding:"required,min=0,max=18"`
+	DisplayName string `json:"display_name" binding:"max=128"`
+	Enabled     *bool  `json:"enabled"`
+}
+
+// AssetUpdateDto changes the display name or enables and disables an asset.
+// The scale is fixed once the asset exists, since amounts already posted are
+// stored in its minor units.
+type AssetUpdateDto struct {
+	DisplayName *string `json:"display_name" binding:"omitempty,max=128"`
+	Enabled     *bool   `json:"enabled"`
+}
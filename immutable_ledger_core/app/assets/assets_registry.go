@@ -0,0 +1,204 @@
+package assets
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/transactions"
+)
+
+// Registry holds the assets the ledger accepts postings in, kept in a JSON
+// file rewritten on every change.
+type Registry struct {
+	path string
+
+	mut    sync.RWMutex
+	assets map[string]Asset
+}
+
+func NewRegistry(path string) (*Registry, error) {
+	r := &Registry{
+		path:   path,
+		assets: make(map[string]Asset),
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read assets: %w", err)
+	}
+	var assets []Asset
+	if err := json.Unmarshal(data, &assets); err != nil {
+		return nil, fmt.Errorf("decode assets: %w", err)
+	}
+	for _, asset := range assets {
+		r.assets[asset.Code] = asset
+	}
+	return r, nil
+}
+
+func (r *Registry) Create(assetDto AssetDto) (Asset, error) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	if _, exists := r.assets[assetDto.Code]; exists {
+		return Asset{}, &transactions.TransactionConflictError{
+			Message: fmt.Sprintf("Asset %s already exists", assetDto.Code),
+			Code:    http.StatusConflict,
+		}
+	}
+
+	now := time.Now().UTC()
+	asset := Asset{
+		Code:        assetDto.Code,
+		Scale:       *assetDto.Scale,
+		DisplayName: assetDto.DisplayName,
+		Enabled:     assetDto.Enabled == nil || *assetDto.Enabled,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := r.save(asset); err != nil {
+		return Asset{}, err
+	}
+	return asset, nil
+}
+
+func (r *Registry) Update(code string, updateDto AssetUpdateDto) (Asset, error) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	asset, exists := r.assets[code]
+	if !exists {
+		return Asset{}, notFound(code)
+	}
+	if updateDto.DisplayName != nil {
+		asset.DisplayName = *updateDto.DisplayName
+	}
+	if updateDto.Enabled != nil {
+		asset.Enabled = *updateDto.Enabled
+	}
+	asset.UpdatedAt = time.Now().UTC()
+	if err := r.save(asset); err != nil {
+		return Asset{}, err
+	}
+	return asset, nil
+}
+
+func (r *Registry) Get(code string) (Asset, error) {
+	r.mut.RLock()
+	defer r.mut.RUnlock()
+	asset, exists := r.assets[code]
+	if !exists {
+		return Asset{}, notFound(code)
+	}
+	return asset, nil
+}
+
+// List returns the assets ordered by code.
+func (r *Registry) List() []Asset {
+	r.mut.RLock()
+	defer r.mut.RUnlock()
+	assets := make([]Asset, 0, len(r.assets))
+	for _, asset := range r.assets {
+		assets = append(assets, asset)
+	}
+	sort.Slice(assets, func(i, j int) bool {
+		return assets[i].Code < assets[j].Code
+	})
+	return assets
+}
+
+// Resolve is the transactions.AssetResolver of the registry: postings need an
+// enabled asset, whose scale converts decimal amounts.
+func (r *Registry) Resolve(code string) (int, error) {
+	r.mut.RLock()
+	defer r.mut.RUnlock()
+	asset, exists := r.assets[code]
+	if !exists {
+		return 0, &transactions.TransactionRuleViolationError{
+			Message: fmt.Sprintf("Asset %s does not exist", code),
+			Code:    http.StatusUnprocessableEntity,
+		}
+	}
+	if !asset.Enabled {
+		return 0, &transactions.TransactionRuleViolationError{
+			Message: fmt.Sprintf("Asset %s is disabled", code),
+			Code:    http.StatusUnprocessableEntity,
+		}
+	}
+	return asset.Scale, nil
+}
+
+// Format renders an amount of an asset. Assets that are not registered, such
+// as ones posted before the registry existed, are rendered with a scale of 0.
+func (r *Registry) Format(code string, amount int64) Amount {
+	r.mut.RLock()
+	defer r.mut.RUnlock()
+	return r.assets[code].Format(amount)
+}
+
+// FormatBalances renders every balance of an account.
+func (r *Registry) FormatBalances(balances map[string]int64) map[string]Amount {
+	formatted := make(map[string]Amount, len(balances))
+	for code, amount := range balances {
+		formatted[code] = r.Format(code, amount)
+	}
+	return formatted
+}
+
+func notFound(code string) error {
+	return &transactions.TransactionNotFoundError{
+		Message: fmt.Sprintf("Asset %s not found", code),
+		Code:    http.StatusNotFound,
+	}
+}
+
+// save stores the asset and rewrites the file through a rename, so a crash
+// leaves either the old or the new list. Callers must hold the write lock.
+func (r *Registry) save(asset Asset) error {
+	previous, existed := r.assets[asset.Code]
+	r.assets[asset.Code] = asset
+
+	assets := make([]Asset, 0, len(r.assets))
+	for _, asset := range r.assets {
+		assets = append(assets, asset)
+	}
+	sort.Slice(assets, func(i, j int) bool {
+		return assets[i].Code < assets[j].Code
+	})
+
+	err := func() error {
+		data, err := json.MarshalIndent(assets, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+			return fmt.Errorf("create assets directory: %w", err)
+		}
+		tmp := r.path + ".tmp"
+		if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+			return fmt.Errorf("write assets: %w", err)
+		}
+		if err := os.Rename(tmp, r.path); err != nil {
+			return fmt.Errorf("replace assets: %w", err)
+		}
+		return nil
+	}()
+	if err != nil {
+		if existed {
+			r.assets[asset.Code] = previous
+		} else {
+			delete(r.assets, asset.Code)
+		}
+	}
+	return err
+}
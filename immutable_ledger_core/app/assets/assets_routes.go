@@ -0,0 +1,66 @@
+package assets
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/transactions"
+)
+
+func CreateAssetHandler(registry *Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var assetDto AssetDto
+		if err := c.BindJSON(&assetDto); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		asset, err := registry.Create(assetDto)
+		if err != nil {
+			transactions.WriteError(c, err)
+			return
+		}
+		c.JSON(201, gin.H{
+			"message": "Asset created",
+			"asset":   asset,
+		})
+	}
+}
+
+func ListAssetsHandler(registry *Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(200, gin.H{
+			"assets": registry.List(),
+		})
+	}
+}
+
+func GetAssetHandler(registry *Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		asset, err := registry.Get(c.Param("code"))
+		if err != nil {
+			transactions.WriteError(c, err)
+			return
+		}
+		c.JSON(200, gin.H{
+			"asset": asset,
+		})
+	}
+}
+
+func UpdateAssetHandler(registry *Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var updateDto AssetUpdateDto
+		if err := c.BindJSON(&updateDto); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		asset, err := registry.Update(c.Param("code"), updateDto)
+		if err != nil {
+			transactions.WriteError(c, err)
+			return
+		}
+		c.JSON(200, gin.H{
+			"asset": asset,
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package fx
+
+import (
+	"math/big"
+	"time"
+)
+
+// Rate is the price of one major unit of Base in major units of Quote, valid
+// from EffectiveAt until the next rate of the same pair. Value is a decimal
+// string so rates are stored and applied exactly.
+type Rate struct {
+	Base        string    `json:"base"`
+	Quote       string    `json:"quote"`
+	Value       string    `json:"rate"`
+	EffectiveAt time.Time `json:"effective_at"`
+	Source      string    `json:"source,omitempty"`
+}
+
+func (r Rate) ratio() *big.Rat {
+	ratio, _ := new(big.Rat).SetString(r.Value)
+	return ratio
+}
+
+type RateDto struct {
+	Base        string    `json:"base" binding:"required,max=16"`
+	Quote       string    `json:"quote" binding:"required,max=16,nefield=Base"`
+	Value       string    `json:"rate" binding:"required"`
+	EffectiveAt time.Time `json:"effective_at" binding:"required"`
+	Source      string    `json:"source" binding:"max=128"`
+}
+
+type RatesDto struct {
+	Rates []RateDto `json:"rates" binding:"required,min=1,dive"`
+}
+
+type RateFilters struct {
+	Base  string     `form:"base"`
+	Quote string     `form:"quote"`
+	At    *time.Time `form:"at"`
+}
+
+// AppliedRate is the rate a valuation used for an asset. Inverted is set when
+// only the opposite pair was known and its reciprocal was applied.
+type AppliedRate struct {
+	Rate
+	Inverted bool `json:"inverted,omitempty"`
+}
@@ -0,0 +1,43 @@
+package fx
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/transactions"
+)
+
+func AddRatesHandler(store *Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ratesDto RatesDto
+		if err := c.BindJSON(&ratesDto); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		rates := make([]Rate, 0, len(ratesDto.Rates))
+		for _, rateDto := range ratesDto.Rates {
+			rates = append(rates, Rate(rateDto))
+		}
+		added, err := store.Add(rates)
+		if err != nil {
+			transactions.WriteError(c, err)
+			return
+		}
+		c.JSON(201, gin.H{
+			"message": "Rates added",
+			"added":   len(added),
+		})
+	}
+}
+
+func ListRatesHandler(store *Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var filters RateFilters
+		if err := c.ShouldBindQuery(&filters); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{
+			"rates": store.List(filters),
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package fx
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/transactions"
+)
+
+type pair struct {
+	Base  string
+	Quote string
+}
+
+// Store keeps the history of FX rates per currency pair. Rates are appended to
+// a JSON lines file, which is also how a batch of rates can be loaded before
+// the service starts.
+type Store struct {
+	path string
+
+	mut   sync.RWMutex
+	rates map[pair][]Rate
+}
+
+func NewStore(path string) (*Store, error) {
+	s := &Store{
+		path:  path,
+		rates: make(map[pair][]Rate),
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open fx rates: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var rate Rate
+		if err := json.Unmarshal(scanner.Bytes(), &rate); err != nil {
+			return nil, fmt.Errorf("decode fx rate on line %d: %w", line, err)
+		}
+		if err := validateRate(rate); err != nil {
+			return nil, fmt.Errorf("fx rate on line %d: %w", line, err)
+		}
+		s.insert(rate)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read fx rates: %w", err)
+	}
+	return s, nil
+}
+
+// Add stores a batch of rates, all or none. A rate for a pair and effective
+// time that is already known is accepted again only with the same value.
+func (s *Store) Add(rates []Rate) ([]Rate, error) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	var added []Rate
+	batch := make(map[Rate]struct{}, len(rates))
+	for _, rate := range rates {
+		rate.EffectiveAt = rate.EffectiveAt.UTC()
+		if err := validateRate(rate); err != nil {
+			return nil, err
+		}
+		key := Rate{Base: rate.Base, Quote: rate.Quote, EffectiveAt: rate.EffectiveAt}
+		if _, exists := batch[key]; exists {
+			return nil, &transactions.TransactionValidationError{
+				Message: fmt.Sprintf("The batch has more than one %s/%s rate effective at %s", rate.Base, rate.Quote, rate.EffectiveAt.Format(time.RFC3339Nano)),
+				Code:    http.StatusBadRequest,
+			}
+		}
+		batch[key] = struct{}{}
+		if existing, exists := s.find(rate); exists {
+			if existing.ratio().Cmp(rate.ratio()) != 0 {
+				return nil, &transactions.TransactionConflictError{
+					Message: fmt.Sprintf("A different %s/%s rate is already effective at %s", rate.Base, rate.Quote, rate.EffectiveAt.Format(time.RFC3339Nano)),
+					Code:    http.StatusConflict,
+				}
+			}
+			continue
+		}
+		added = append(added, rate)
+	}
+
+	if err := s.persist(added); err != nil {
+		return nil, err
+	}
+	for _, rate := range added {
+		s.insert(rate)
+	}
+	return added, nil
+}
+
+// List returns the rates of the matching pairs ordered by pair and effective
+// time. With at set only the rate in effect at that time is kept per pair.
+func (s *Store) List(filters RateFilters) []Rate {
+	s.mut.RLock()
+	defer s.mut.RUnlock()
+
+	rates := []Rate{}
+	for key, history := range s.rates {
+		if (filters.Base != "" && key.Base != filters.Base) || (filters.Quote != "" && key.Quote != filters.Quote) {
+			continue
+		}
+		if filters.At != nil {
+			if rate, exists := rateAt(history, *filters.At); exists {
+				rates = append(rates, rate)
+			}
+			continue
+		}
+		rates = append(rates, history...)
+	}
+	sort.Slice(rates, func(i, j int) bool {
+		if rates[i].Base != rates[j].Base {
+			return rates[i].Base < rates[j].Base
+		}
+		if rates[i].Quote != rates[j].Quote {
+			return rates[i].Quote < rates[j].Quote
+		}
+		return rates[i].EffectiveAt.Before(rates[j].EffectiveAt)
+	})
+	return rates
+}
+
+// Lookup returns the base/quote rate in effect at a time. When only quote/base is
+// known its reciprocal is used; no currency triangulation is attempted.
+func (s *Store) Lookup(base, quote string, at time.Time) (AppliedRate, *big.Rat, bool) {
+	s.mut.RLock()
+	defer s.mut.RUnlock()
+
+	if rate, exists := rateAt(s.rates[pair{Base: base, Quote: quote}], at); exists {
+		return AppliedRate{Rate: rate}, rate.ratio(), true
+	}
+	if rate, exists := rateAt(s.rates[pair{Base: quote, Quote: base}], at); exists {
+		return AppliedRate{Rate: rate, Inverted: true}, new(big.Rat).Inv(rate.ratio()), true
+	}
+	return AppliedRate{}, nil, false
+}
+
+func validateRate(rate Rate) error {
+	if rate.Base == "" || rate.Quote == "" || rate.Base == rate.Quote {
+		return &transactions.TransactionValidationError{
+			Message: "A rate needs two different currencies",
+			Code:    http.StatusBadRequest,
+		}
+	}
+	ratio, ok := new(big.Rat).SetString(rate.Value)
+	if !ok || ratio.Sign() <= 0 {
+		return &transactions.TransactionValidationError{
+			Message: fmt.Sprintf("Rate %q of %s/%s must be a positive decimal", rate.Value, rate.Base, rate.Quote),
+			Code:    http.StatusBadRequest,
+		}
+	}
+	if rate.EffectiveAt.IsZero() {
+		return &transactions.TransactionValidationError{
+			Message: fmt.Sprintf("Rate of %s/%s needs effective_at", rate.Base, rate.Quote),
+			Code:    http.StatusBadRequest,
+		}
+	}
+	return nil
+}
+
+// find returns the rate of the same pair and effective time, callers must hold the lock.
+func (s *Store) find(rate Rate) (Rate, bool) {
+	history := s.rates[pair{Base: rate.Base, Quote: rate.Quote}]
+	idx := sort.Search(len(history), func(i int) bool {
+		return !history[i].EffectiveAt.Before(rate.EffectiveAt)
+	})
+	if idx < len(history) && history[idx].EffectiveAt.Equal(rate.EffectiveAt) {
+		return history[idx], true
+	}
+	return Rate{}, false
+}
+
+// insert keeps the history of the pair ordered by effective time, callers must hold the lock.
+func (s *Store) insert(rate Rate) {
+	key := pair{Base: rate.Base, Quote: rate.Quote}
+	history := s.rates[key]
+	idx := sort.Search(len(history), func(i int) bool {
+		return history[i].EffectiveAt.After(rate.EffectiveAt)
+	})
+	s.rates[key] = slices.Insert(history, idx, rate)
+}
+
+func rateAt(history []Rate, at time.Time) (Rate, bool) {
+	idx := sort.Search(len(history), func(i int) bool {
+		return history[i].EffectiveAt.After(at)
+	})
+	if idx == 0 {
+		return Rate{}, false
+	}
+	return history[idx-1], true
+}
+
+func (s *Store) persist(rates []Rate) error {
+	if len(rates) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("create fx rates directory: %w", err)
+	}
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("open fx rates: %w", err)
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	for _, rate := range rates {
+		line, err := json.Marshal(rate)
+		if err != nil {
+			return err
+		}
+		writer.Write(append(line, '\n'))
+	}
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("write fx rates: %w", err)
+	}
+	return file.Sync()
+}
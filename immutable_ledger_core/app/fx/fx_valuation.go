@@ -0,0 +1,184 @@
+package fx
+
+import (
+	"fmt"
+	"math/big"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/assets"
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/transactions"
+)
+
+// Rounding modes for converted amounts, applied once per asset when the exact
+// value falls between two minor units of the valuation currency.
+const (
+	RoundHalfEven = "half_even"
+	RoundHalfUp   = "half_up"
+	RoundDown     = "down"
+	RoundUp       = "up"
+
+	DefaultRounding = RoundHalfEven
+)
+
+// Valuation is the value of a set of balances in one currency. Each asset is
+// converted and rounded on its own, Total is the sum of the rounded values.
+type Valuation struct {
+	Currency string          `json:"currency"`
+	At       time.Time       `json:"at"`
+	Rounding string          `json:"rounding"`
+	Total    assets.Amount   `json:"total"`
+	Items    []ValuationItem `json:"items"`
+	Rates    []AppliedRate   `json:"rates"`
+}
+
+type ValuationItem struct {
+	Asset  string        `json:"asset"`
+	Amount assets.Amount `json:"amount"`
+	Value  assets.Amount `json:"value"`
+	// Rate is the asset/currency ratio that was applied, "1" for the currency
+	// itself. A reciprocal without a finite decimal form is written as "a/b".
+	Rate string `json:"rate"`
+}
+
+// Value converts every balance into currency with the rates in effect at the
+// given time. A missing rate fails the whole valuation rather than leaving an
+// asset out of the total.
+func (s *Store) Value(balances map[string]int64, currency string, at time.Time, rounding string, assetRegistry *assets.Registry) (Valuation, error) {
+	if rounding == "" {
+		rounding = DefaultRounding
+	}
+	if err := checkRounding(rounding); err != nil {
+		return Valuation{}, err
+	}
+	target, err := assetRegistry.Get(currency)
+	if err != nil {
+		return Valuation{}, &transactions.TransactionValidationError{
+			Message: fmt.Sprintf("Valuation currency %s is not a registered asset", currency),
+			Code:    http.StatusBadRequest,
+		}
+	}
+
+	codes := make([]string, 0, len(balances))
+	for code := range balances {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	valuation := Valuation{
+		Currency: currency,
+		At:       at,
+		Rounding: rounding,
+		Items:    []ValuationItem{},
+		Rates:    []AppliedRate{},
+	}
+	var total int64
+	for _, code := range codes {
+		amount := assetRegistry.Format(code, balances[code])
+		ratio := big.NewRat(1, 1)
+		if code != currency {
+			applied, appliedRatio, exists := s.Lookup(code, currency, at)
+			if !exists {
+				return Valuation{}, &transactions.TransactionRuleViolationError{
+					Message: fmt.Sprintf("No %s/%s rate is effective at %s", code, currency, at.Format(time.RFC3339Nano)),
+					Code:    http.StatusUnprocessableEntity,
+				}
+			}
+			ratio = appliedRatio
+			valuation.Rates = append(valuation.Rates, applied)
+		}
+
+		value, err := Convert(amount.Raw, amount.Scale, target.Scale, ratio, rounding)
+		if err != nil {
+			return Valuation{}, err
+		}
+		total += value
+		valuation.Items = append(valuation.Items, ValuationItem{
+			Asset:  code,
+			Amount: amount,
+			Value:  target.Format(value),
+			Rate:   formatRatio(ratio),
+		})
+	}
+	valuation.Total = target.Format(total)
+	return valuation, nil
+}
+
+// Convert turns an amount of minor units at fromScale into minor units at
+// toScale through ratio, rounding the exact result with the given mode.
+func Convert(amount int64, fromScale, toScale int, ratio *big.Rat, rounding string) (int64, error) {
+	value := new(big.Rat).SetInt64(amount)
+	value.Mul(value, ratio)
+	shift := new(big.Rat).SetFrac(pow10(toScale), pow10(fromScale))
+	value.Mul(value, shift)
+
+	rounded, err := round(value, rounding)
+	if err != nil {
+		return 0, err
+	}
+	if !rounded.IsInt64() {
+		return 0, &transactions.TransactionRuleViolationError{
+			Message: "Converted amount is out of range",
+			Code:    http.StatusUnprocessableEntity,
+		}
+	}
+	return rounded.Int64(), nil
+}
+
+func checkRounding(rounding string) error {
+	switch rounding {
+	case RoundHalfEven, RoundHalfUp, RoundDown, RoundUp:
+		return nil
+	}
+	return &transactions.TransactionValidationError{
+		Message: fmt.Sprintf("Unknown rounding %q, use %s, %s, %s or %s", rounding, RoundHalfEven, RoundHalfUp, RoundDown, RoundUp),
+		Code:    http.StatusBadRequest,
+	}
+}
+
+func round(value *big.Rat, rounding string) (*big.Int, error) {
+	if err := checkRounding(rounding); err != nil {
+		return nil, err
+	}
+	quotient, remainder := new(big.Int).QuoRem(value.Num(), value.Denom(), new(big.Int))
+	if remainder.Sign() == 0 {
+		return quotient, nil
+	}
+	awayFromZero := big.NewInt(int64(value.Sign()))
+
+	// Compare the dropped fraction with one half: 2*|remainder| against the denominator.
+	half := new(big.Int).Abs(remainder)
+	half.Lsh(half, 1)
+	position := half.Cmp(value.Denom())
+
+	switch rounding {
+	case RoundDown:
+		return quotient, nil
+	case RoundUp:
+		return quotient.Add(quotient, awayFromZero), nil
+	case RoundHalfUp:
+		if position >= 0 {
+			quotient.Add(quotient, awayFromZero)
+		}
+		return quotient, nil
+	default: // RoundHalfEven
+		if position > 0 || (position == 0 && quotient.Bit(0) == 1) {
+			quotient.Add(quotient, awayFromZero)
+		}
+		return quotient, nil
+	}
+}
+
+func formatRatio(ratio *big.Rat) string {
+	decimal := strings.TrimRight(strings.TrimRight(ratio.FloatString(18), "0"), ".")
+	if exact, ok := new(big.Rat).SetString(decimal); ok && exact.Cmp(ratio) == 0 {
+		return decimal
+	}
+	return ratio.RatString()
+}
+
+func pow10(exponent int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exponent)), nil)
+}
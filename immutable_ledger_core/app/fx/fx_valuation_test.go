@@ -0,0 +1,162 @@
+package fx
+
+import (
+	"errors"
+	"math/big"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/assets"
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/transactions"
+)
+
+// errorCode is the HTTP code carried by err, 0 when it is not a TransactionError.
+func errorCode(err error) int {
+	var transErr transactions.TransactionError
+	if errors.As(err, &transErr) {
+		return transErr.GetCode()
+	}
+	return 0
+}
+
+func TestConvertRounding(t *testing.T) {
+	tests := []struct {
+		name      string
+		amount    int64
+		fromScale int
+		toScale   int
+		ratio     string
+		want      map[string]int64
+	}{
+		{
+			name: "exact", amount: 250, fromScale: 2, toScale: 2, ratio: "2",
+			want: map[string]int64{RoundHalfEven: 500, RoundHalfUp: 500, RoundDown: 500, RoundUp: 500},
+		},
+		{
+			name: "half below an even unit", amount: 5, fromScale: 2, toScale: 2, ratio: "0.5",
+			want: map[string]int64{RoundHalfEven: 2, RoundHalfUp: 3, RoundDown: 2, RoundUp: 3},
+		},
+		{
+			name: "half below an odd unit", amount: 3, fromScale: 2, toScale: 2, ratio: "0.5",
+			want: map[string]int64{RoundHalfEven: 2, RoundHalfUp: 2, RoundDown: 1, RoundUp: 2},
+		},
+		{
+			name: "negative half", amount: -5, fromScale: 2, toScale: 2, ratio: "0.5",
+			want: map[string]int64{RoundHalfEven: -2, RoundHalfUp: -3, RoundDown: -2, RoundUp: -3},
+		},
+		{
+			name: "below half", amount: 7, fromScale: 2, toScale: 2, ratio: "1/3",
+			want: map[string]int64{RoundHalfEven: 2, RoundHalfUp: 2, RoundDown: 2, RoundUp: 3},
+		},
+		{
+			name: "above half", amount: 5, fromScale: 2, toScale: 2, ratio: "1/3",
+			want: map[string]int64{RoundHalfEven: 2, RoundHalfUp: 2, RoundDown: 1, RoundUp: 2},
+		},
+		{
+			name: "to a smaller scale", amount: 12345, fromScale: 2, toScale: 0, ratio: "150.5",
+			want: map[string]int64{RoundHalfEven: 18579, RoundHalfUp: 18579, RoundDown: 18579, RoundUp: 18580},
+		},
+		{
+			name: "to a larger scale", amount: 3, fromScale: 0, toScale: 8, ratio: "0.000012345678901",
+			want: map[string]int64{RoundHalfEven: 3704, RoundHalfUp: 3704, RoundDown: 3703, RoundUp: 3704},
+		},
+	}
+	for _, tt := range tests {
+		ratio, ok := new(big.Rat).SetString(tt.ratio)
+		if !ok {
+			t.Fatalf("bad ratio %q", tt.ratio)
+		}
+		for rounding, want := range tt.want {
+			t.Run(tt.name+"/"+rounding, func(t *testing.T) {
+				got, err := Convert(tt.amount, tt.fromScale, tt.toScale, ratio, rounding)
+				if err != nil || got != want {
+					t.Fatalf("Convert(%d, %d, %d, %s, %s) = %d, %v, want %d", tt.amount, tt.fromScale, tt.toScale, tt.ratio, rounding, got, err, want)
+				}
+			})
+		}
+	}
+
+	if _, err := Convert(1, 2, 2, big.NewRat(1, 3), "ceiling"); errorCode(err) != http.StatusBadRequest {
+		t.Fatalf("unknown rounding = %v, want code 400", err)
+	}
+	if _, err := Convert(1<<62, 0, 2, big.NewRat(1000, 1), RoundDown); errorCode(err) != http.StatusUnprocessableEntity {
+		t.Fatalf("overflowing conversion = %v, want code 422", err)
+	}
+}
+
+func TestValueAtRateBoundaries(t *testing.T) {
+	dir := t.TempDir()
+	registry, err := assets.NewRegistry(filepath.Join(dir, "assets.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for code, scale := range map[string]int{"USD": 2, "EUR": 2, "JPY": 0} {
+		if _, err := registry.Create(assets.AssetDto{Code: code, Scale: &scale}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store, err := NewStore(filepath.Join(dir, "fx_rates.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	monday := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+	tuesday := monday.Add(24 * time.Hour)
+	_, err = store.Add([]Rate{
+		{Base: "USD", Quote: "EUR", Value: "0.9", EffectiveAt: monday},
+		{Base: "USD", Quote: "EUR", Value: "0.8", EffectiveAt: tuesday},
+		{Base: "EUR", Quote: "JPY", Value: "160", EffectiveAt: monday},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	balances := map[string]int64{"USD": 1000, "EUR": 500, "JPY": 1600}
+	tests := []struct {
+		name    string
+		at      time.Time
+		usdRate string
+		total   string
+		noRate  bool
+	}{
+		{name: "before the first rate", at: monday.Add(-time.Nanosecond), noRate: true},
+		{name: "when the first rate takes effect", at: monday, usdRate: "0.9", total: "24.00"},
+		{name: "just before the next rate", at: tuesday.Add(-time.Nanosecond), usdRate: "0.9", total: "24.00"},
+		{name: "when the next rate takes effect", at: tuesday, usdRate: "0.8", total: "23.00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			valuation, err := store.Value(balances, "EUR", tt.at, "", registry)
+			if tt.noRate {
+				if errorCode(err) != http.StatusUnprocessableEntity {
+					t.Fatalf("Value() = %+v, %v, want code 422", valuation, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			// 10 USD at the rate, 5 EUR as they are, 1600 JPY through the
+			// reciprocal of EUR/JPY.
+			if valuation.Total.Formatted != tt.total || valuation.Rounding != DefaultRounding {
+				t.Fatalf("total = %+v, want %s", valuation.Total, tt.total)
+			}
+			if len(valuation.Rates) != 2 || valuation.Rates[0].Value != "160" || !valuation.Rates[0].Inverted || valuation.Rates[1].Value != tt.usdRate {
+				t.Fatalf("rates = %+v, want EUR/JPY inverted and USD/EUR at %s", valuation.Rates, tt.usdRate)
+			}
+			for _, item := range valuation.Items {
+				if item.Asset == "EUR" && (item.Rate != "1" || item.Value.Raw != 500) {
+					t.Fatalf("EUR item = %+v, want it valued as is", item)
+				}
+				if item.Asset == "JPY" && (item.Rate != "0.00625" || item.Value.Raw != 1000) {
+					t.Fatalf("JPY item = %+v, want 1600 JPY at 0.00625", item)
+				}
+			}
+		})
+	}
+
+	if _, err := store.Value(balances, "GBP", tuesday, "", registry); errorCode(err) != http.StatusBadRequest {
+		t.Fatalf("unregistered currency = %v, want code 400", err)
+	}
+}
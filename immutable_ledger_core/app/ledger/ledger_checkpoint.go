@@ -0,0 +1,221 @@
+package ledger
+
+import (
+	"bufio"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/transactions"
+)
+
+const checkpointDomain = "immutable-ledger-checkpoint/v1"
+
+// Checkpoint is a signed statement of the ledger head at a point in time. An
+// operator who later recomputes every hash to rewrite history cannot produce
+// a matching signature for the old head without the private key.
+type Checkpoint struct {
+	Sequence  int       `json:"sequence"`
+	LastHash  string    `json:"last_hash"`
+	Root      string    `json:"root"`
+	Timestamp time.Time `json:"timestamp"`
+	KeyId     string    `json:"key_id"`
+	Signature string    `json:"signature"`
+}
+
+// SignedContent is the message the signature covers.
+func (c Checkpoint) SignedContent() []byte {
+	return fmt.Appendf(nil, "%s\n%d\n%s\n%s\n%s\n",
+		checkpointDomain, c.Sequence, c.LastHash, c.Root, c.Timestamp.UTC().Format(time.RFC3339Nano))
+}
+
+func KeyId(publicKey ed25519.PublicKey) string {
+	sum := sha256.Sum256(publicKey)
+	return hex.EncodeToString(sum[:8])
+}
+
+func VerifyCheckpoint(publicKey ed25519.PublicKey, checkpoint Checkpoint) error {
+	if checkpoint.KeyId != KeyId(publicKey) {
+		return fmt.Errorf("checkpoint was signed by key %s", checkpoint.KeyId)
+	}
+	signature, err := hex.DecodeString(checkpoint.Signature)
+	if err != nil {
+		return fmt.Errorf("decode signature: %w", err)
+	}
+	if !ed25519.Verify(publicKey, checkpoint.SignedContent(), signature) {
+		return errors.New("invalid checkpoint signature")
+	}
+	return nil
+}
+
+// LoadSigningKey reads a hex encoded Ed25519 seed from path, generating and
+// saving a new one when the file does not exist yet.
+func LoadSigningKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		seed := make([]byte, ed25519.SeedSize)
+		if _, err := rand.Read(seed); err != nil {
+			return nil, fmt.Errorf("generate signing key: %w", err)
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return nil, fmt.Errorf("create key directory: %w", err)
+		}
+		if err := os.WriteFile(path, []byte(hex.EncodeToString(seed)+"\n"), 0o600); err != nil {
+			return nil, fmt.Errorf("write signing key: %w", err)
+		}
+		log.Printf("checkpoints: generated a new signing key at %s", path)
+		return ed25519.NewKeyFromSeed(seed), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read signing key: %w", err)
+	}
+
+	seed, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("signing key in %s must be a hex encoded %d byte seed", path, ed25519.SeedSize)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// Checkpointer signs the ledger head and keeps the checkpoints in an
+// append-only JSON lines file.
+type Checkpointer struct {
+	transactionDb *transactions.TranasctionDatabase
+	privateKey    ed25519.PrivateKey
+	path          string
+
+	mut         sync.Mutex
+	checkpoints []Checkpoint
+}
+
+// NewCheckpointer loads the checkpoints from path. Every one of them must carry
+// a valid signature of privateKey, a file edited by hand or left by another key
+// is refused.
+func NewCheckpointer(transactionDb *transactions.TranasctionDatabase, privateKey ed25519.PrivateKey, path string) (*Checkpointer, error) {
+	c := &Checkpointer{
+		transactionDb: transactionDb,
+		privateKey:    privateKey,
+		path:          path,
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open checkpoints: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var checkpoint Checkpoint
+		if err := json.Unmarshal(scanner.Bytes(), &checkpoint); err != nil {
+			return nil, fmt.Errorf("decode checkpoint on line %d: %w", line, err)
+		}
+		if err := VerifyCheckpoint(c.PublicKey(), checkpoint); err != nil {
+			return nil, fmt.Errorf("checkpoint on line %d: %w", line, err)
+		}
+		c.checkpoints = append(c.checkpoints, checkpoint)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read checkpoints: %w", err)
+	}
+	return c, nil
+}
+
+func (c *Checkpointer) PublicKey() ed25519.PublicKey {
+	return c.privateKey.Public().(ed25519.PublicKey)
+}
+
+func (c *Checkpointer) List() []Checkpoint {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	checkpoints := make([]Checkpoint, len(c.checkpoints))
+	copy(checkpoints, c.checkpoints)
+	return checkpoints
+}
+
+// Create signs the current ledger head and stores the checkpoint.
+func (c *Checkpointer) Create() (Checkpoint, error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	head := c.transactionDb.Head()
+	checkpoint := Checkpoint{
+		Sequence:  head.Size,
+		LastHash:  head.LastHash,
+		Root:      head.Root,
+		Timestamp: time.Now().UTC(),
+		KeyId:     KeyId(c.PublicKey()),
+	}
+	checkpoint.Signature = hex.EncodeToString(ed25519.Sign(c.privateKey, checkpoint.SignedContent()))
+
+	if err := c.persist(checkpoint); err != nil {
+		return Checkpoint{}, err
+	}
+	c.checkpoints = append(c.checkpoints, checkpoint)
+	return checkpoint, nil
+}
+
+// Run creates a checkpoint every interval while the ledger keeps growing.
+func (c *Checkpointer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !c.headChanged() {
+				continue
+			}
+			if _, err := c.Create(); err != nil {
+				log.Printf("checkpoints: failed to create checkpoint: %v", err)
+			}
+		}
+	}
+}
+
+func (c *Checkpointer) headChanged() bool {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	head := c.transactionDb.Head()
+	if len(c.checkpoints) == 0 {
+		return head.Size > 0
+	}
+	return c.checkpoints[len(c.checkpoints)-1].Sequence != head.Size
+}
+
+func (c *Checkpointer) persist(checkpoint Checkpoint) error {
+	line, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return fmt.Errorf("create checkpoints directory: %w", err)
+	}
+	file, err := os.OpenFile(c.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("open checkpoints: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("write checkpoint: %w", err)
+	}
+	return file.Sync()
+}
@@ -0,0 +1,99 @@
+package ledger
+
+import (
+	"crypto/ed25519"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/transactions"
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/utils"
+)
+
+func newTestCheckpointer(t *testing.T, path string) *Checkpointer {
+	t.Helper()
+	db := transactions.NewSafeTranasctionDatabase()
+	_, _, err := transactions.CreateTransaction(transactions.TransactionDto{Postings: []transactions.PostingDto{
+		{AccountId: "cash", Direction: transactions.DirectionDebit, Amount: 100, Unit: "USD"},
+		{AccountId: "alice", Direction: transactions.DirectionCredit, Amount: 100, Unit: "USD"},
+	}}, utils.GenerateID, utils.GenerateHash, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := LoadSigningKey(filepath.Join(filepath.Dir(path), "checkpoint.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkpointer, err := NewCheckpointer(db, key, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return checkpointer
+}
+
+func TestVerifyCheckpointDetectsTampering(t *testing.T) {
+	checkpointer := newTestCheckpointer(t, filepath.Join(t.TempDir(), "checkpoints.jsonl"))
+	signed, err := checkpointer.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+
+	tests := []struct {
+		name   string
+		tamper func(*Checkpoint)
+		key    ed25519.PublicKey
+		valid  bool
+	}{
+		{name: "untouched", tamper: func(*Checkpoint) {}, valid: true},
+		{name: "sequence", tamper: func(c *Checkpoint) { c.Sequence++ }},
+		{name: "last hash", tamper: func(c *Checkpoint) { c.LastHash = "00" + c.LastHash[2:] }},
+		{name: "root", tamper: func(c *Checkpoint) { c.Root = "00" + c.Root[2:] }},
+		{name: "timestamp", tamper: func(c *Checkpoint) { c.Timestamp = c.Timestamp.Add(time.Nanosecond) }},
+		{name: "signature", tamper: func(c *Checkpoint) { c.Signature = "00" + c.Signature[2:] }},
+		{name: "undecodable signature", tamper: func(c *Checkpoint) { c.Signature = "zz" }},
+		{name: "other key", tamper: func(*Checkpoint) {}, key: otherKey.Public().(ed25519.PublicKey)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkpoint := signed
+			tt.tamper(&checkpoint)
+			key := tt.key
+			if key == nil {
+				key = checkpointer.PublicKey()
+			}
+			err := VerifyCheckpoint(key, checkpoint)
+			if tt.valid && err != nil {
+				t.Fatalf("VerifyCheckpoint() = %v, want the checkpoint accepted", err)
+			}
+			if !tt.valid && err == nil {
+				t.Fatal("VerifyCheckpoint() accepted a tampered checkpoint")
+			}
+		})
+	}
+}
+
+func TestNewCheckpointerRefusesTamperedCheckpoints(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoints.jsonl")
+	checkpointer := newTestCheckpointer(t, path)
+	if _, err := checkpointer.Create(); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded := newTestCheckpointer(t, path); len(reloaded.List()) != 1 {
+		t.Fatalf("reloaded %d checkpoints, want 1", len(reloaded.List()))
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The sequence is the first field, bump its first digit.
+	data[len(`{"sequence":`)]++
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewCheckpointer(transactions.NewSafeTranasctionDatabase(), checkpointer.privateKey, path); err == nil {
+		t.Fatal("NewCheckpointer loaded a checkpoint whose sequence was edited")
+	}
+}
@@ -0,0 +1,112 @@
+package ledger
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/transactions"
+)
+
+const (
+	ExportNDJSON = "ndjson"
+	ExportCSV    = "csv"
+
+	exportFlushEvery = 500
+)
+
+// ExportLedger streams the entries matching LedgerFilters, up to the ledger
+// head at the start of the request, as NDJSON (one entry per line, the same
+// JSON as the API) or CSV. Output is flushed batch by batch. The export is
+// always complete and in sequence order, so the paging parameters of /ledger
+// are refused rather than ignored.
+func ExportLedger(transactionDb *transactions.TranasctionDatabase) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var filters transactions.LedgerFilters
+		if err := c.ShouldBindQuery(&filters); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if filters.Limit != nil || filters.Cursor != "" || filters.Order != "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "limit, cursor and order do not apply to exports, use after_sequence to resume one",
+			})
+			return
+		}
+		format := c.DefaultQuery("format", ExportNDJSON)
+		if format != ExportNDJSON && format != ExportCSV {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("format must be %q or %q", ExportNDJSON, ExportCSV),
+			})
+			return
+		}
+
+		head := transactionDb.Head()
+		until := uint64(head.Size)
+		c.Header("X-Ledger-Size", strconv.Itoa(head.Size))
+		c.Header("X-Ledger-Last-Hash", head.LastHash)
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="ledger-%d.%s"`, head.Size, format))
+
+		var begin, flush func() error
+		var write func(transactions.TransactionModel) error
+		switch format {
+		case ExportNDJSON:
+			c.Header("Content-Type", "application/x-ndjson")
+			encoder := json.NewEncoder(c.Writer)
+			begin = func() error { return nil }
+			write = func(transaction transactions.TransactionModel) error {
+				return encoder.Encode(transaction)
+			}
+			flush = func() error { return nil }
+		case ExportCSV:
+			c.Header("Content-Type", "text/csv; charset=utf-8")
+			writer := csv.NewWriter(c.Writer)
+			begin = func() error {
+				return writer.Write(transactions.CSVHeader)
+			}
+			write = func(transaction transactions.TransactionModel) error {
+				record, err := transactions.CSVRecord(transaction)
+				if err != nil {
+					return err
+				}
+				return writer.Write(record)
+			}
+			flush = func() error {
+				writer.Flush()
+				return writer.Error()
+			}
+		}
+		c.Status(http.StatusOK)
+
+		count := 0
+		err := begin()
+		if err == nil {
+			err = transactionDb.ScanEntries(filters, until, func(transaction transactions.TransactionModel) error {
+				if err := write(transaction); err != nil {
+					return err
+				}
+				if count++; count%exportFlushEvery == 0 {
+					if err := flush(); err != nil {
+						return err
+					}
+					c.Writer.Flush()
+				}
+				return nil
+			})
+		}
+		if err == nil {
+			err = flush()
+		}
+		c.Writer.Flush()
+
+		// The status is already sent, a failure can only cut the stream short.
+		if err != nil {
+			log.Printf("export: stopped after an error: %v", err)
+			c.Abort()
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package ledger
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/merkle"
+)
+
+type InclusionProofResponse struct {
+	TransactionId string   `json:"transaction_id"`
+	LeafIndex     int      `json:"leaf_index"`
+	TreeSize      int      `json:"tree_size"`
+	LeafHash      string   `json:"leaf_hash"`
+	AuditPath     []string `json:"audit_path"`
+	Root          string   `json:"root"`
+}
+
+func NewInclusionProofResponse(transactionId string, proof merkle.InclusionProof) InclusionProofResponse {
+	auditPath := make([]string, 0, len(proof.AuditPath))
+	for _, node := range proof.AuditPath {
+		auditPath = append(auditPath, hex.EncodeToString(node))
+	}
+	return InclusionProofResponse{
+		TransactionId: transactionId,
+		LeafIndex:     proof.LeafIndex,
+		TreeSize:      proof.TreeSize,
+		LeafHash:      hex.EncodeToString(proof.LeafHash),
+		AuditPath:     auditPath,
+		Root:          hex.EncodeToString(proof.Root),
+	}
+}
+
+type ConsistencyQuery struct {
+	FirstSize  int     `form:"first_size"`
+	FirstRoot  *string `form:"first_root"`
+	SecondSize *int    `form:"second_size"`
+}
+
+type ConsistencyProofResponse struct {
+	FirstSize  int      `json:"first_size"`
+	FirstRoot  string   `json:"first_root"`
+	SecondSize int      `json:"second_size"`
+	SecondRoot string   `json:"second_root"`
+	Proof      []string `json:"proof"`
+}
+
+func NewConsistencyProofResponse(proof merkle.ConsistencyProof) ConsistencyProofResponse {
+	path := make([]string, 0, len(proof.Path))
+	for _, node := range proof.Path {
+		path = append(path, hex.EncodeToString(node))
+	}
+	return ConsistencyProofResponse{
+		FirstSize:  proof.FirstSize,
+		FirstRoot:  hex.EncodeToString(proof.FirstRoot),
+		SecondSize: proof.SecondSize,
+		SecondRoot: hex.EncodeToString(proof.SecondRoot),
+		Proof:      path,
+	}
+}
+
+// VerifyConsistency checks a consistency proof returned by the API against the
+// root an auditor saved earlier and the root they are moving to.
+func VerifyConsistency(response ConsistencyProofResponse, savedRoot string, currentRoot string) error {
+	firstRoot, err := hex.DecodeString(savedRoot)
+	if err != nil {
+		return fmt.Errorf("decode saved root: %w", err)
+	}
+	secondRoot, err := hex.DecodeString(currentRoot)
+	if err != nil {
+		return fmt.Errorf("decode current root: %w", err)
+	}
+	path := make([][]byte, 0, len(response.Proof))
+	for _, node := range response.Proof {
+		decoded, err := hex.DecodeString(node)
+		if err != nil {
+			return fmt.Errorf("decode proof node: %w", err)
+		}
+		path = append(path, decoded)
+	}
+	return merkle.VerifyConsistency(response.FirstSize, response.SecondSize, firstRoot, secondRoot, path)
+}
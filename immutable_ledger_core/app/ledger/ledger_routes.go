@@ -1,6 +1,8 @@
 package ledger
 
 import (
+	"encoding/hex"
+
 	"github.com/gin-gonic/gin"
 	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/transactions"
 )
@@ -15,9 +17,89 @@ func GetLedger(transactionDb *transactions.TranasctionDatabase) gin.HandlerFunc
 			return
 		}
 
-		transactionsList := transactionDb.GetAllTransactions(filters)
+		page, err := transactionDb.GetAllTransactions(filters)
+		if err != nil {
+			transactions.WriteError(c, err)
+			return
+		}
+		c.JSON(200, page)
+	}
+}
+
+func GetTransactionProof(transactionDb *transactions.TranasctionDatabase) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		transactionId := c.Param("id")
+		proof, err := transactionDb.InclusionProof(transactionId)
+		if err != nil {
+			transactions.WriteError(c, err)
+			return
+		}
+
+		c.JSON(200, NewInclusionProofResponse(transactionId, proof))
+	}
+}
+
+func GetConsistencyProof(transactionDb *transactions.TranasctionDatabase) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var query ConsistencyQuery
+		if err := c.BindQuery(&query); err != nil {
+			c.JSON(400, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		proof, err := transactionDb.ConsistencyProof(query.FirstSize, query.SecondSize)
+		if err != nil {
+			transactions.WriteError(c, err)
+			return
+		}
+
+		response := NewConsistencyProofResponse(proof)
+		if query.FirstRoot != nil && *query.FirstRoot != response.FirstRoot {
+			c.JSON(409, gin.H{
+				"error":      "first_root does not match the ledger root at first_size",
+				"first_root": response.FirstRoot,
+			})
+			return
+		}
+		c.JSON(200, response)
+	}
+}
+
+func ListCheckpoints(checkpointer *Checkpointer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		publicKey := checkpointer.PublicKey()
 		c.JSON(200, gin.H{
-			"transactions": transactionsList,
+			"public_key":  hex.EncodeToString(publicKey),
+			"key_id":      KeyId(publicKey),
+			"checkpoints": checkpointer.List(),
 		})
 	}
 }
+
+func CreateCheckpoint(checkpointer *Checkpointer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		checkpoint, err := checkpointer.Create()
+		if err != nil {
+			c.JSON(500, gin.H{
+				"error": "Internal server error",
+			})
+			return
+		}
+		c.JSON(201, checkpoint)
+	}
+}
+
+func CheckBalanceProjection(transactionDb *transactions.TranasctionDatabase) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(200, transactionDb.CheckBalances())
+	}
+}
+
+func RebuildBalanceProjection(transactionDb *transactions.TranasctionDatabase) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		transactionDb.RebuildBalances()
+		c.JSON(200, transactionDb.CheckBalances())
+	}
+}
@@ -0,0 +1,96 @@
+package ledger
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/transactions"
+)
+
+const (
+	StreamEventTransaction = "transaction"
+
+	streamHeartbeat = 15 * time.Second
+	streamRetry     = 3000
+)
+
+// StreamLedger pushes appended entries to the client as Server-Sent Events.
+// The event ID is the entry sequence, so a client that reconnects with
+// Last-Event-ID (or ?last_event_id= for the first connection) resumes right
+// after the last entry it saw. Without either, only entries appended after
+// the connection opened are sent. account_id and asset_type filter the events.
+func StreamLedger(transactionDb *transactions.TranasctionDatabase) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var query transactions.LedgerFilters
+		if err := c.ShouldBindQuery(&query); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		filters := transactions.LedgerFilters{AccountId: query.AccountId, AssetType: query.AssetType}
+
+		position := uint64(transactionDb.Head().Size)
+		lastEventId := c.GetHeader("Last-Event-ID")
+		if lastEventId == "" {
+			lastEventId = c.Query("last_event_id")
+		}
+		if lastEventId != "" {
+			sequence, err := strconv.ParseUint(lastEventId, 10, 64)
+			if err != nil || sequence > position {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": fmt.Sprintf("Last-Event-ID must be a sequence between 0 and %d", position),
+				})
+				return
+			}
+			position = sequence
+		}
+
+		c.Header("Content-Type", sse.ContentType)
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.Header("X-Accel-Buffering", "no")
+		c.Status(http.StatusOK)
+		// Tell EventSource clients how long to wait before reconnecting.
+		if _, err := fmt.Fprintf(c.Writer, "retry: %d\n\n", streamRetry); err != nil {
+			return
+		}
+		c.Writer.Flush()
+
+		heartbeat := time.NewTicker(streamHeartbeat)
+		defer heartbeat.Stop()
+		for {
+			appended := transactionDb.Appended()
+			head := uint64(transactionDb.Head().Size)
+			if head > position {
+				filters.AfterSequence = &position
+				err := transactionDb.ScanEntries(filters, head, func(transaction transactions.TransactionModel) error {
+					return sse.Encode(c.Writer, sse.Event{
+						Id:    strconv.FormatUint(transaction.Sequence, 10),
+						Event: StreamEventTransaction,
+						Data:  transaction,
+					})
+				})
+				if err != nil {
+					return
+				}
+				position = head
+				c.Writer.Flush()
+			}
+
+			select {
+			case <-c.Request.Context().Done():
+				return
+			case <-heartbeat.C:
+				// A comment line keeps proxies from closing an idle stream.
+				if _, err := c.Writer.WriteString(": heartbeat\n\n"); err != nil {
+					return
+				}
+				c.Writer.Flush()
+			case <-appended:
+			}
+		}
+	}
+}
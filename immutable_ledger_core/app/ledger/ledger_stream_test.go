@@ -0,0 +1,155 @@
+package ledger
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/transactions"
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/utils"
+)
+
+func move(t *testing.T, db *transactions.TranasctionDatabase, from, to string) {
+	t.Helper()
+	_, _, err := transactions.CreateTransaction(transactions.TransactionDto{Postings: []transactions.PostingDto{
+		{AccountId: from, Direction: transactions.DirectionDebit, Amount: 100, Unit: "USD"},
+		{AccountId: to, Direction: transactions.DirectionCredit, Amount: 100, Unit: "USD"},
+	}}, utils.GenerateID, utils.GenerateHash, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// openStream connects to the stream and returns the IDs of the transaction
+// events as they arrive.
+func openStream(t *testing.T, url string, lastEventId string) <-chan uint64 {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastEventId != "" {
+		request.Header.Set("Last-Event-ID", lastEventId)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("stream answered %s", response.Status)
+	}
+
+	ids := make(chan uint64, 16)
+	go func() {
+		defer response.Body.Close()
+		defer close(ids)
+		scanner := bufio.NewScanner(response.Body)
+		for scanner.Scan() {
+			if value, found := strings.CutPrefix(scanner.Text(), "id:"); found {
+				id, err := strconv.ParseUint(value, 10, 64)
+				if err != nil {
+					return
+				}
+				ids <- id
+			}
+		}
+	}()
+	return ids
+}
+
+// receive waits for count events.
+func receive(t *testing.T, ids <-chan uint64, count int) []uint64 {
+	t.Helper()
+	var received []uint64
+	timeout := time.After(5 * time.Second)
+	for len(received) < count {
+		select {
+		case id, open := <-ids:
+			if !open {
+				t.Fatalf("stream closed after %v", received)
+			}
+			received = append(received, id)
+		case <-timeout:
+			t.Fatalf("got %v, want %d events", received, count)
+		}
+	}
+	return received
+}
+
+// newStreamServer serves the stream of a ledger whose entry 4 is the only
+// one posting to bob among 5.
+func newStreamServer(t *testing.T) (*transactions.TranasctionDatabase, string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	db := transactions.NewSafeTranasctionDatabase()
+	router := gin.New()
+	router.GET("/ledger/stream", StreamLedger(db))
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	for range 3 {
+		move(t, db, "cash", "alice")
+	}
+	move(t, db, "cash", "bob")
+	move(t, db, "cash", "alice")
+	return db, server.URL + "/ledger/stream"
+}
+
+func TestStreamLedgerResumes(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		query       string
+		lastEventId string
+		backlog     []uint64
+		live        []uint64
+	}{
+		{name: "resume after an event", lastEventId: "2", backlog: []uint64{3, 4, 5}, live: []uint64{6, 7}},
+		{name: "resume from the start", lastEventId: "0", backlog: []uint64{1, 2, 3, 4, 5}, live: []uint64{6, 7}},
+		{name: "resume at the head", lastEventId: "5", live: []uint64{6, 7}},
+		{name: "resume by query", query: "?last_event_id=4", backlog: []uint64{5}, live: []uint64{6, 7}},
+		{name: "resume filtered", query: "?account_id=bob", lastEventId: "1", backlog: []uint64{4}, live: []uint64{7}},
+		{name: "no resume point", live: []uint64{6, 7}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, url := newStreamServer(t)
+			ids := openStream(t, url+tt.query, tt.lastEventId)
+			if got := receive(t, ids, len(tt.backlog)); !slices.Equal(got, tt.backlog) {
+				t.Fatalf("backlog = %v, want %v", got, tt.backlog)
+			}
+			move(t, db, "cash", "alice")
+			move(t, db, "cash", "bob")
+			if got := receive(t, ids, len(tt.live)); !slices.Equal(got, tt.live) {
+				t.Fatalf("live events = %v, want %v", got, tt.live)
+			}
+		})
+	}
+}
+
+func TestStreamLedgerRefusesUnknownPositions(t *testing.T) {
+	_, url := newStreamServer(t)
+	for _, lastEventId := range []string{"abc", "-1", "6"} {
+		request, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Set("Last-Event-ID", lastEventId)
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		if response.StatusCode != http.StatusBadRequest {
+			t.Fatalf("Last-Event-ID %q answered %s, want 400", lastEventId, response.Status)
+		}
+	}
+}
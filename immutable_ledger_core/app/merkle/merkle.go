@@ -0,0 +1,288 @@
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/bits"
+)
+
+// Tree is an append-only Merkle tree following RFC 6962: leaves are hashed as
+// SHA-256(0x00 || data) and interior nodes as SHA-256(0x01 || left || right).
+//
+// Every perfect subtree is cached once it is complete, and the RFC splits a
+// range at the largest power of two, so any subtree the algorithms need is
+// either cached or split into cached ones. Root and proofs cost O(log² n).
+// A Tree is not safe for concurrent use.
+type Tree struct {
+	// levels[h][i] is the root of the perfect subtree covering leaves
+	// [i*2^h, (i+1)*2^h).
+	levels [][][]byte
+}
+
+type InclusionProof struct {
+	LeafIndex int
+	TreeSize  int
+	LeafHash  []byte
+	AuditPath [][]byte
+	Root      []byte
+}
+
+type ConsistencyProof struct {
+	FirstSize  int
+	SecondSize int
+	FirstRoot  []byte
+	SecondRoot []byte
+	Path       [][]byte
+}
+
+func New() *Tree {
+	return &Tree{}
+}
+
+func LeafHash(data []byte) []byte {
+	sum := sha256.Sum256(append([]byte{0x00}, data...))
+	return sum[:]
+}
+
+func nodeHash(left, right []byte) []byte {
+	input := make([]byte, 0, 1+len(left)+len(right))
+	input = append(input, 0x01)
+	input = append(input, left...)
+	input = append(input, right...)
+	sum := sha256.Sum256(input)
+	return sum[:]
+}
+
+func emptyRoot() []byte {
+	sum := sha256.Sum256(nil)
+	return sum[:]
+}
+
+func (t *Tree) Size() int {
+	if len(t.levels) == 0 {
+		return 0
+	}
+	return len(t.levels[0])
+}
+
+// Append adds the leaf for data and returns its index.
+func (t *Tree) Append(data []byte) int {
+	hash := LeafHash(data)
+	for level := 0; ; level++ {
+		if level == len(t.levels) {
+			t.levels = append(t.levels, nil)
+		}
+		t.levels[level] = append(t.levels[level], hash)
+		count := len(t.levels[level])
+		if count%2 == 1 {
+			break
+		}
+		hash = nodeHash(t.levels[level][count-2], t.levels[level][count-1])
+	}
+	return t.Size() - 1
+}
+
+func (t *Tree) Root() []byte {
+	root, _ := t.RootAt(t.Size())
+	return root
+}
+
+// RootAt returns the root the tree had when it contained size leaves.
+func (t *Tree) RootAt(size int) ([]byte, error) {
+	if size < 0 || size > t.Size() {
+		return nil, fmt.Errorf("tree size %d out of range [0, %d]", size, t.Size())
+	}
+	if size == 0 {
+		return emptyRoot(), nil
+	}
+	return t.subtreeHash(0, size), nil
+}
+
+// InclusionProof returns the audit path of leaf index in the tree of the given size.
+func (t *Tree) InclusionProof(index, size int) (InclusionProof, error) {
+	if size <= 0 || size > t.Size() {
+		return InclusionProof{}, fmt.Errorf("tree size %d out of range [1, %d]", size, t.Size())
+	}
+	if index < 0 || index >= size {
+		return InclusionProof{}, fmt.Errorf("leaf index %d out of range [0, %d)", index, size)
+	}
+	return InclusionProof{
+		LeafIndex: index,
+		TreeSize:  size,
+		LeafHash:  t.levels[0][index],
+		AuditPath: t.path(index, 0, size),
+		Root:      t.subtreeHash(0, size),
+	}, nil
+}
+
+// ConsistencyProof proves that the tree of size first is a prefix of the tree
+// of size second.
+func (t *Tree) ConsistencyProof(first, second int) (ConsistencyProof, error) {
+	if second < 0 || second > t.Size() {
+		return ConsistencyProof{}, fmt.Errorf("tree size %d out of range [0, %d]", second, t.Size())
+	}
+	if first < 0 || first > second {
+		return ConsistencyProof{}, fmt.Errorf("first size %d out of range [0, %d]", first, second)
+	}
+
+	firstRoot, _ := t.RootAt(first)
+	secondRoot, _ := t.RootAt(second)
+	proof := ConsistencyProof{
+		FirstSize:  first,
+		SecondSize: second,
+		FirstRoot:  firstRoot,
+		SecondRoot: secondRoot,
+	}
+	if first > 0 && first < second {
+		proof.Path = t.subproof(first, 0, second, true)
+	}
+	return proof, nil
+}
+
+// subproof is SUBPROOF(m, D[start:end], b) from RFC 6962 section 2.1.2.
+func (t *Tree) subproof(m, start, end int, complete bool) [][]byte {
+	n := end - start
+	if m == n {
+		if complete {
+			return nil
+		}
+		return [][]byte{t.subtreeHash(start, end)}
+	}
+	k := largestPowerOfTwoBelow(n)
+	if m <= k {
+		return append(t.subproof(m, start, start+k, complete), t.subtreeHash(start+k, end))
+	}
+	return append(t.subproof(m-k, start+k, end, false), t.subtreeHash(start, start+k))
+}
+
+// path is PATH(m, D[start:end]) from RFC 6962 section 2.1.1.
+func (t *Tree) path(index, start, end int) [][]byte {
+	n := end - start
+	if n == 1 {
+		return nil
+	}
+	k := largestPowerOfTwoBelow(n)
+	if index < k {
+		return append(t.path(index, start, start+k), t.subtreeHash(start+k, end))
+	}
+	return append(t.path(index-k, start+k, end), t.subtreeHash(start, start+k))
+}
+
+// subtreeHash is MTH(D[start:end]) for a non-empty range.
+func (t *Tree) subtreeHash(start, end int) []byte {
+	n := end - start
+	if n&(n-1) == 0 && start%n == 0 {
+		level := bits.TrailingZeros(uint(n))
+		return t.levels[level][start/n]
+	}
+	k := largestPowerOfTwoBelow(n)
+	return nodeHash(t.subtreeHash(start, start+k), t.subtreeHash(start+k, end))
+}
+
+// largestPowerOfTwoBelow returns the largest power of two strictly smaller than n, n > 1.
+func largestPowerOfTwoBelow(n int) int {
+	return 1 << (bits.Len(uint(n-1)) - 1)
+}
+
+// VerifyInclusion checks an audit path against a root, following RFC 9162
+// section 2.1.3.2.
+func VerifyInclusion(index, size int, leafHash []byte, auditPath [][]byte, root []byte) error {
+	if index < 0 || index >= size {
+		return fmt.Errorf("leaf index %d out of range [0, %d)", index, size)
+	}
+
+	fn, sn := index, size-1
+	hash := leafHash
+	for _, sibling := range auditPath {
+		if sn == 0 {
+			return errors.New("audit path is longer than expected")
+		}
+		if fn&1 == 1 || fn == sn {
+			hash = nodeHash(sibling, hash)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			hash = nodeHash(hash, sibling)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 {
+		return errors.New("audit path is shorter than expected")
+	}
+	if !bytes.Equal(hash, root) {
+		return errors.New("audit path does not lead to the root")
+	}
+	return nil
+}
+
+// VerifyConsistency checks that secondRoot extends firstRoot using a proof
+// built by ConsistencyProof, following RFC 9162 section 2.1.4.2. A ledger that
+// was rewritten instead of appended to cannot produce a proof that passes.
+func VerifyConsistency(first, second int, firstRoot, secondRoot []byte, path [][]byte) error {
+	if first < 0 || first > second {
+		return fmt.Errorf("first size %d out of range [0, %d]", first, second)
+	}
+	if first == second {
+		if len(path) != 0 {
+			return errors.New("proof must be empty for equal tree sizes")
+		}
+		if !bytes.Equal(firstRoot, secondRoot) {
+			return errors.New("roots differ for equal tree sizes")
+		}
+		return nil
+	}
+	if first == 0 {
+		if len(path) != 0 {
+			return errors.New("proof must be empty for an empty first tree")
+		}
+		return nil
+	}
+	if len(path) == 0 {
+		return errors.New("proof is empty")
+	}
+
+	if first&(first-1) == 0 {
+		path = append([][]byte{firstRoot}, path...)
+	}
+
+	fn, sn := first-1, second-1
+	for fn&1 == 1 {
+		fn >>= 1
+		sn >>= 1
+	}
+
+	fr, sr := path[0], path[0]
+	for _, node := range path[1:] {
+		if sn == 0 {
+			return errors.New("proof is longer than expected")
+		}
+		if fn&1 == 1 || fn == sn {
+			fr = nodeHash(node, fr)
+			sr = nodeHash(node, sr)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			sr = nodeHash(sr, node)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+
+	if sn != 0 {
+		return errors.New("proof is shorter than expected")
+	}
+	if !bytes.Equal(fr, firstRoot) {
+		return errors.New("proof does not lead to the first root")
+	}
+	if !bytes.Equal(sr, secondRoot) {
+		return errors.New("proof does not lead to the second root")
+	}
+	return nil
+}
@@ -0,0 +1,374 @@
+package merkle
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+const maxTestLeaves = 64
+
+// rfcLeaves are the leaves of the RFC 6962 test vectors used by Certificate
+// Transparency implementations.
+var rfcLeaves = []string{
+	"",
+	"00",
+	"10",
+	"2021",
+	"3031",
+	"40414243",
+	"5051525354555657",
+	"606162636465666768696a6b6c6d6e6f",
+}
+
+var rfcRoots = []string{
+	"6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d",
+	"fac54203e7cc696cf0dfcb42c92a1d9dbaf70ad9e621f4bd8d98662f00e3c125",
+	"aeb6bcfe274b70a14fb067a5e5578264db0fa9b51af5e0ba159158f329e06e77",
+	"d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7",
+	"4e3bbb1f7b478dcfe71fb631631519a3bca12c9aefca1612bfce4c13a86264d4",
+	"76e67dadbcdf1e10e1b74ddc608abd2f98dfb16fbce75277b5232a127f2087ef",
+	"ddb89be403809e325750d3d263cd78929c2942b7942a34b77e122c9594a74c8c",
+	"5dc9da79a70659a9ad559cb701ded9a2ab9d823aad2f4960cfe370eff4604328",
+}
+
+func decodeHex(t *testing.T, values ...string) [][]byte {
+	t.Helper()
+	decoded := make([][]byte, len(values))
+	for i, value := range values {
+		b, err := hex.DecodeString(value)
+		if err != nil {
+			t.Fatalf("decode %q: %v", value, err)
+		}
+		decoded[i] = b
+	}
+	return decoded
+}
+
+func rfcTree(t *testing.T) *Tree {
+	t.Helper()
+	tree := New()
+	for _, leaf := range decodeHex(t, rfcLeaves...) {
+		tree.Append(leaf)
+	}
+	return tree
+}
+
+// testTree returns a tree of maxTestLeaves leaves along with their data.
+func testTree() (*Tree, [][]byte) {
+	tree := New()
+	leaves := make([][]byte, maxTestLeaves)
+	for i := range leaves {
+		leaves[i] = []byte(fmt.Sprintf("leaf-%d", i))
+		tree.Append(leaves[i])
+	}
+	return tree, leaves
+}
+
+// referenceRoot is MTH from RFC 6962 section 2.1, computed from scratch.
+func referenceRoot(leaves [][]byte) []byte {
+	switch len(leaves) {
+	case 0:
+		return emptyRoot()
+	case 1:
+		return LeafHash(leaves[0])
+	}
+	k := largestPowerOfTwoBelow(len(leaves))
+	return nodeHash(referenceRoot(leaves[:k]), referenceRoot(leaves[k:]))
+}
+
+// referencePath is PATH from RFC 6962 section 2.1.1, computed from scratch.
+func referencePath(index int, leaves [][]byte) [][]byte {
+	if len(leaves) == 1 {
+		return nil
+	}
+	k := largestPowerOfTwoBelow(len(leaves))
+	if index < k {
+		return append(referencePath(index, leaves[:k]), referenceRoot(leaves[k:]))
+	}
+	return append(referencePath(index-k, leaves[k:]), referenceRoot(leaves[:k]))
+}
+
+// referenceProof is PROOF from RFC 6962 section 2.1.2, computed from scratch.
+func referenceProof(first int, leaves [][]byte) [][]byte {
+	var subproof func(m int, leaves [][]byte, complete bool) [][]byte
+	subproof = func(m int, leaves [][]byte, complete bool) [][]byte {
+		if m == len(leaves) {
+			if complete {
+				return nil
+			}
+			return [][]byte{referenceRoot(leaves)}
+		}
+		k := largestPowerOfTwoBelow(len(leaves))
+		if m <= k {
+			return append(subproof(m, leaves[:k], complete), referenceRoot(leaves[k:]))
+		}
+		return append(subproof(m-k, leaves[k:], false), referenceRoot(leaves[:k]))
+	}
+	if first == 0 || first == len(leaves) {
+		return nil
+	}
+	return subproof(first, leaves, true)
+}
+
+func equalHashes(a, b [][]byte) bool {
+	return slices.EqualFunc(a, b, bytes.Equal)
+}
+
+func flipped(path [][]byte, i int) [][]byte {
+	tampered := make([][]byte, len(path))
+	for j, node := range path {
+		tampered[j] = bytes.Clone(node)
+	}
+	tampered[i][0] ^= 0x01
+	return tampered
+}
+
+func TestRootMatchesRFCVectors(t *testing.T) {
+	tree := rfcTree(t)
+	for size, want := range rfcRoots {
+		root, err := tree.RootAt(size + 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := hex.EncodeToString(root); got != want {
+			t.Errorf("root of size %d = %s, want %s", size+1, got, want)
+		}
+	}
+	if got := hex.EncodeToString(New().Root()); got != "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855" {
+		t.Errorf("empty root = %s", got)
+	}
+}
+
+func TestInclusionProofMatchesRFCVectors(t *testing.T) {
+	tests := []struct {
+		index, size int
+		path        []string
+	}{
+		{0, 1, nil},
+		{0, 8, []string{
+			"96a296d224f285c67bee93c30f8a309157f0daa35dc5b87e410b78630a09cfc7",
+			"5f083f0a1a33ca076a95279832580db3e0ef4584bdff1f54c8a360f50de3031e",
+			"6b47aaf29ee3c2af9af889bc1fb9254dabd31177f16232dd6aab035ca39bf6e4",
+		}},
+		{5, 8, []string{
+			"bc1a0643b12e4d2d7c77918f44e0f4f79a838b6cf9ec5b5c283e1f4d88599e6b",
+			"ca854ea128ed050b41b35ffc1b87b8eb2bde461e9e3b5596ece6b9d5975a0ae0",
+			"d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7",
+		}},
+		{2, 3, []string{
+			"fac54203e7cc696cf0dfcb42c92a1d9dbaf70ad9e621f4bd8d98662f00e3c125",
+		}},
+		{1, 5, []string{
+			"6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d",
+			"5f083f0a1a33ca076a95279832580db3e0ef4584bdff1f54c8a360f50de3031e",
+			"bc1a0643b12e4d2d7c77918f44e0f4f79a838b6cf9ec5b5c283e1f4d88599e6b",
+		}},
+	}
+
+	tree := rfcTree(t)
+	for _, tt := range tests {
+		proof, err := tree.InclusionProof(tt.index, tt.size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := decodeHex(t, tt.path...); !equalHashes(proof.AuditPath, want) {
+			t.Errorf("path of leaf %d in size %d = %x, want %x", tt.index, tt.size, proof.AuditPath, want)
+		}
+		root := decodeHex(t, rfcRoots[tt.size-1])[0]
+		if err := VerifyInclusion(tt.index, tt.size, proof.LeafHash, proof.AuditPath, root); err != nil {
+			t.Errorf("leaf %d in size %d: %v", tt.index, tt.size, err)
+		}
+	}
+}
+
+func TestConsistencyProofMatchesRFCVectors(t *testing.T) {
+	tests := []struct {
+		first, second int
+		path          []string
+	}{
+		{1, 1, nil},
+		{1, 8, []string{
+			"96a296d224f285c67bee93c30f8a309157f0daa35dc5b87e410b78630a09cfc7",
+			"5f083f0a1a33ca076a95279832580db3e0ef4584bdff1f54c8a360f50de3031e",
+			"6b47aaf29ee3c2af9af889bc1fb9254dabd31177f16232dd6aab035ca39bf6e4",
+		}},
+		{6, 8, []string{
+			"0ebc5d3437fbe2db158b9f126a1d118e308181031d0a949f8dededebc558ef6a",
+			"ca854ea128ed050b41b35ffc1b87b8eb2bde461e9e3b5596ece6b9d5975a0ae0",
+			"d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7",
+		}},
+		{2, 5, []string{
+			"5f083f0a1a33ca076a95279832580db3e0ef4584bdff1f54c8a360f50de3031e",
+			"bc1a0643b12e4d2d7c77918f44e0f4f79a838b6cf9ec5b5c283e1f4d88599e6b",
+		}},
+	}
+
+	tree := rfcTree(t)
+	for _, tt := range tests {
+		proof, err := tree.ConsistencyProof(tt.first, tt.second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := decodeHex(t, tt.path...); !equalHashes(proof.Path, want) {
+			t.Errorf("proof %d -> %d = %x, want %x", tt.first, tt.second, proof.Path, want)
+		}
+		roots := decodeHex(t, rfcRoots[tt.first-1], rfcRoots[tt.second-1])
+		if err := VerifyConsistency(tt.first, tt.second, roots[0], roots[1], proof.Path); err != nil {
+			t.Errorf("proof %d -> %d: %v", tt.first, tt.second, err)
+		}
+	}
+}
+
+func TestRootAtEverySize(t *testing.T) {
+	tree, leaves := testTree()
+	for size := 0; size <= maxTestLeaves; size++ {
+		root, err := tree.RootAt(size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(root, referenceRoot(leaves[:size])) {
+			t.Fatalf("root of size %d differs from the reference", size)
+		}
+	}
+	if _, err := tree.RootAt(maxTestLeaves + 1); err == nil {
+		t.Fatal("RootAt accepted a size past the tree")
+	}
+}
+
+func TestInclusionProofRoundTrip(t *testing.T) {
+	tree, leaves := testTree()
+	for size := 1; size <= maxTestLeaves; size++ {
+		root := referenceRoot(leaves[:size])
+		for index := 0; index < size; index++ {
+			proof, err := tree.InclusionProof(index, size)
+			if err != nil {
+				t.Fatalf("InclusionProof(%d, %d): %v", index, size, err)
+			}
+			if !bytes.Equal(proof.Root, root) || !bytes.Equal(proof.LeafHash, LeafHash(leaves[index])) {
+				t.Fatalf("InclusionProof(%d, %d) reports the wrong root or leaf", index, size)
+			}
+			if !equalHashes(proof.AuditPath, referencePath(index, leaves[:size])) {
+				t.Fatalf("InclusionProof(%d, %d) path differs from the reference", index, size)
+			}
+			if err := VerifyInclusion(index, size, proof.LeafHash, proof.AuditPath, root); err != nil {
+				t.Fatalf("VerifyInclusion(%d, %d): %v", index, size, err)
+			}
+		}
+	}
+}
+
+func TestInclusionProofRejectsTampering(t *testing.T) {
+	tree, leaves := testTree()
+	for size := 1; size <= maxTestLeaves; size++ {
+		root := referenceRoot(leaves[:size])
+		for index := 0; index < size; index++ {
+			proof, _ := tree.InclusionProof(index, size)
+			path := proof.AuditPath
+			reject := func(what string, index, size int, leafHash []byte, path [][]byte, root []byte) {
+				t.Helper()
+				if VerifyInclusion(index, size, leafHash, path, root) == nil {
+					t.Fatalf("leaf %d in size %d: accepted %s", proof.LeafIndex, proof.TreeSize, what)
+				}
+			}
+
+			for i := range path {
+				reject(fmt.Sprintf("path node %d flipped", i), index, size, proof.LeafHash, flipped(path, i), root)
+			}
+			if len(path) > 0 {
+				reject("a truncated path", index, size, proof.LeafHash, path[:len(path)-1], root)
+			}
+			reject("an extended path", index, size, proof.LeafHash, append(slices.Clone(path), root), root)
+			reject("another leaf", index, size, LeafHash([]byte("forged")), path, root)
+			reject("a flipped root", index, size, proof.LeafHash, path, flipped([][]byte{root}, 0)[0])
+			reject("an index past the size", size, size, proof.LeafHash, path, root)
+			reject("a negative index", -1, size, proof.LeafHash, path, root)
+
+			// The same path checked for a neighbouring leaf or tree size, against
+			// the root of that size, must fail unless it is also that leaf's path.
+			for _, other := range [][2]int{{index - 1, size}, {index + 1, size}, {index, size - 1}, {index, size + 1}} {
+				otherIndex, otherSize := other[0], other[1]
+				if otherIndex < 0 || otherIndex >= otherSize || otherSize > maxTestLeaves {
+					continue
+				}
+				if equalHashes(referencePath(otherIndex, leaves[:otherSize]), path) {
+					continue
+				}
+				reject(fmt.Sprintf("leaf %d in size %d", otherIndex, otherSize), otherIndex, otherSize, proof.LeafHash, path, referenceRoot(leaves[:otherSize]))
+			}
+		}
+	}
+}
+
+func TestConsistencyProofRoundTrip(t *testing.T) {
+	tree, leaves := testTree()
+	for second := 0; second <= maxTestLeaves; second++ {
+		secondRoot := referenceRoot(leaves[:second])
+		for first := 0; first <= second; first++ {
+			firstRoot := referenceRoot(leaves[:first])
+			proof, err := tree.ConsistencyProof(first, second)
+			if err != nil {
+				t.Fatalf("ConsistencyProof(%d, %d): %v", first, second, err)
+			}
+			if !bytes.Equal(proof.FirstRoot, firstRoot) || !bytes.Equal(proof.SecondRoot, secondRoot) {
+				t.Fatalf("ConsistencyProof(%d, %d) reports the wrong roots", first, second)
+			}
+			if !equalHashes(proof.Path, referenceProof(first, leaves[:second])) {
+				t.Fatalf("ConsistencyProof(%d, %d) path differs from the reference", first, second)
+			}
+			if err := VerifyConsistency(first, second, firstRoot, secondRoot, proof.Path); err != nil {
+				t.Fatalf("VerifyConsistency(%d, %d): %v", first, second, err)
+			}
+		}
+	}
+
+	if _, err := tree.ConsistencyProof(3, 2); err == nil {
+		t.Fatal("ConsistencyProof accepted a first size past the second")
+	}
+	if _, err := tree.ConsistencyProof(1, maxTestLeaves+1); err == nil {
+		t.Fatal("ConsistencyProof accepted a size past the tree")
+	}
+}
+
+func TestConsistencyProofRejectsTampering(t *testing.T) {
+	tree, leaves := testTree()
+	for second := 1; second <= maxTestLeaves; second++ {
+		secondRoot := referenceRoot(leaves[:second])
+		for first := 1; first < second; first++ {
+			firstRoot := referenceRoot(leaves[:first])
+			proof, _ := tree.ConsistencyProof(first, second)
+			path := proof.Path
+			reject := func(what string, first, second int, firstRoot, secondRoot []byte, path [][]byte) {
+				t.Helper()
+				if VerifyConsistency(first, second, firstRoot, secondRoot, path) == nil {
+					t.Fatalf("proof %d -> %d: accepted %s", proof.FirstSize, proof.SecondSize, what)
+				}
+			}
+
+			for i := range path {
+				reject(fmt.Sprintf("path node %d flipped", i), first, second, firstRoot, secondRoot, flipped(path, i))
+			}
+			reject("a truncated path", first, second, firstRoot, secondRoot, path[:len(path)-1])
+			reject("an extended path", first, second, firstRoot, secondRoot, append(slices.Clone(path), secondRoot))
+			reject("a flipped first root", first, second, flipped([][]byte{firstRoot}, 0)[0], secondRoot, path)
+			reject("a flipped second root", first, second, firstRoot, flipped([][]byte{secondRoot}, 0)[0], path)
+			reject("swapped roots", first, second, secondRoot, firstRoot, path)
+			reject("a first size past the second", second+1, second, firstRoot, secondRoot, path)
+
+			// The same path checked for neighbouring sizes, against the roots of
+			// those sizes, must fail unless it is also the proof between them.
+			for _, other := range [][2]int{{first - 1, second}, {first + 1, second}, {first, second - 1}, {first, second + 1}} {
+				otherFirst, otherSecond := other[0], other[1]
+				if otherFirst < 1 || otherFirst >= otherSecond || otherSecond > maxTestLeaves {
+					continue
+				}
+				if equalHashes(referenceProof(otherFirst, leaves[:otherSecond]), path) {
+					continue
+				}
+				reject(fmt.Sprintf("sizes %d -> %d", otherFirst, otherSecond), otherFirst, otherSecond, referenceRoot(leaves[:otherFirst]), referenceRoot(leaves[:otherSecond]), path)
+			}
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package transactions
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// BalanceSnapshotInterval is how many entries apart the balances of the
+// accounts are copied, a historical balance never replays more than this many
+// entries.
+const BalanceSnapshotInterval = 1000
+
+// balanceSnapshot is the balances of one account right after the entry with
+// Sequence, a multiple of BalanceSnapshotInterval.
+type balanceSnapshot struct {
+	Sequence uint64
+	Balances map[string]int64
+}
+
+// BalanceMismatch is an account/asset pair where the projection disagrees with
+// a recomputation from the ledger.
+type BalanceMismatch struct {
+	AccountId  string `json:"account_id"`
+	Unit       string `json:"unit"`
+	Projected  int64  `json:"projected"`
+	Recomputed int64  `json:"recomputed"`
+}
+
+type BalanceCheckReport struct {
+	Consistent      bool              `json:"consistent"`
+	EntriesReplayed int               `json:"entries_replayed"`
+	Accounts        int               `json:"accounts"`
+	Mismatches      []BalanceMismatch `json:"mismatches"`
+}
+
+// applyBalances adds the postings of an entry to a per account, per asset
+// balance map.
+func applyBalances(balances map[string]map[string]int64, transaction TransactionModel) {
+	for _, posting := range transaction.Postings {
+		accountBalances, exists := balances[posting.AccountId]
+		if !exists {
+			accountBalances = make(map[string]int64)
+			balances[posting.AccountId] = accountBalances
+		}
+		accountBalances[posting.Unit] += posting.Delta()
+	}
+}
+
+// projectBalances applies an entry to the projection. Every
+// BalanceSnapshotInterval entries the accounts posted to since the previous
+// snapshot get a snapshot, an account that did not move keeps its last one.
+// The snapshots never outnumber the postings, however many accounts there are.
+// Callers must hold the write lock.
+func (db *TranasctionDatabase) projectBalances(transaction TransactionModel) {
+	applyBalances(db.balances, transaction)
+	for _, posting := range transaction.Postings {
+		db.moved[posting.AccountId] = struct{}{}
+	}
+	if transaction.Sequence%BalanceSnapshotInterval != 0 {
+		return
+	}
+	for accountId := range db.moved {
+		db.snapshots[accountId] = append(db.snapshots[accountId], balanceSnapshot{
+			Sequence: transaction.Sequence,
+			Balances: maps.Clone(db.balances[accountId]),
+		})
+	}
+	clear(db.moved)
+}
+
+func computeBalances(entries []TransactionModel) map[string]map[string]int64 {
+	balances := make(map[string]map[string]int64)
+	for _, transaction := range entries {
+		applyBalances(balances, transaction)
+	}
+	return balances
+}
+
+// GetBalances reads the balance projection of an account, maintained on every
+// append, so the cost does not depend on the size of the ledger. The returned
+// sequence is the last entry the balances include.
+func (db *TranasctionDatabase) GetBalances(accountId string) (map[string]int64, uint64) {
+	db.mut.RLock()
+	defer db.mut.RUnlock()
+	balances := maps.Clone(db.balances[accountId])
+	if balances == nil {
+		balances = make(map[string]int64)
+	}
+	return balances, uint64(len(db.entries))
+}
+
+// GetBalancesAt returns the balances of an account right after the entry with
+// the given sequence, starting from the closest snapshot at or before it.
+func (db *TranasctionDatabase) GetBalancesAt(accountId string, sequence uint64) (map[string]int64, error) {
+	db.mut.RLock()
+	defer db.mut.RUnlock()
+
+	if sequence > uint64(len(db.entries)) {
+		return nil, &TransactionValidationError{
+			Message: fmt.Sprintf("Sequence %d is beyond the ledger head %d", sequence, len(db.entries)),
+			Code:    http.StatusBadRequest,
+		}
+	}
+	return db.balancesAt(accountId, sequence), nil
+}
+
+// balancesAt needs the lock held and a sequence within the ledger. The
+// balances at the last snapshot boundary before sequence are those of the last
+// snapshot of the account up to it, the entries after the boundary are
+// replayed.
+func (db *TranasctionDatabase) balancesAt(accountId string, sequence uint64) map[string]int64 {
+	balances := make(map[string]int64)
+	start := sequence - sequence%BalanceSnapshotInterval
+	snapshots := db.snapshots[accountId]
+	idx := sort.Search(len(snapshots), func(i int) bool {
+		return snapshots[i].Sequence > start
+	})
+	if idx > 0 {
+		maps.Copy(balances, snapshots[idx-1].Balances)
+	}
+
+	for _, transaction := range db.entries[start:sequence] {
+		for _, posting := range transaction.Postings {
+			if posting.AccountId == accountId {
+				balances[posting.Unit] += posting.Delta()
+			}
+		}
+	}
+	return balances
+}
+
+// AccountActivity returns the balances of an account right before from and the
+// entries touching it from then until to, in sequence order. Both are read
+// under one lock, so the entries always start from that opening balance. Head
+// is the ledger size at the time of the read.
+func (db *TranasctionDatabase) AccountActivity(accountId string, from, to *time.Time) (opening map[string]int64, entries []TransactionModel, head uint64) {
+	db.mut.RLock()
+	defer db.mut.RUnlock()
+
+	var start int
+	if from != nil {
+		start = sort.Search(len(db.entries), func(i int) bool {
+			return !db.entries[i].Timestamp.Before(*from)
+		})
+	}
+	opening = db.balancesAt(accountId, uint64(start))
+
+	entries = []TransactionModel{}
+	for _, transaction := range db.entries[start:] {
+		if to != nil && transaction.Timestamp.After(*to) {
+			break
+		}
+		if transaction.HasAccount(accountId) {
+			entries = append(entries, transaction)
+		}
+	}
+	return opening, entries, uint64(len(db.entries))
+}
+
+// SequenceAt returns the sequence of the last entry appended at or before t,
+// 0 when the ledger had no entries yet. Timestamps never decrease along the
+// chain, so this is a binary search.
+func (db *TranasctionDatabase) SequenceAt(t time.Time) uint64 {
+	db.mut.RLock()
+	defer db.mut.RUnlock()
+	idx := sort.Search(len(db.entries), func(i int) bool {
+		return db.entries[i].Timestamp.After(t)
+	})
+	return uint64(idx)
+}
+
+// EntryTimestamp returns the timestamp of the entry with the given sequence.
+func (db *TranasctionDatabase) EntryTimestamp(sequence uint64) (time.Time, bool) {
+	db.mut.RLock()
+	defer db.mut.RUnlock()
+	if sequence == 0 || sequence > uint64(len(db.entries)) {
+		return time.Time{}, false
+	}
+	return db.entries[sequence-1].Timestamp, true
+}
+
+// RebuildBalances throws the projection and its snapshots away and replays
+// them from the ledger.
+func (db *TranasctionDatabase) RebuildBalances() {
+	db.mut.Lock()
+	defer db.mut.Unlock()
+	db.balances = make(map[string]map[string]int64)
+	db.snapshots = make(map[string][]balanceSnapshot)
+	db.moved = make(map[string]struct{})
+	for _, transaction := range db.entries {
+		db.projectBalances(transaction)
+	}
+}
+
+// CheckBalances compares the projection with a full recomputation from the
+// ledger without changing either.
+func (db *TranasctionDatabase) CheckBalances() BalanceCheckReport {
+	db.mut.RLock()
+	defer db.mut.RUnlock()
+
+	recomputed := computeBalances(db.entries)
+	report := BalanceCheckReport{
+		EntriesReplayed: len(db.entries),
+		Accounts:        len(recomputed),
+		Mismatches:      []BalanceMismatch{},
+	}
+
+	accountIds := make(map[string]struct{})
+	for accountId := range recomputed {
+		accountIds[accountId] = struct{}{}
+	}
+	for accountId := range db.balances {
+		accountIds[accountId] = struct{}{}
+	}
+	for accountId := range accountIds {
+		units := make(map[string]struct{})
+		for unit := range recomputed[accountId] {
+			units[unit] = struct{}{}
+		}
+		for unit := range db.balances[accountId] {
+			units[unit] = struct{}{}
+		}
+		for unit := range units {
+			projected := db.balances[accountId][unit]
+			expected := recomputed[accountId][unit]
+			if projected != expected {
+				report.Mismatches = append(report.Mismatches, BalanceMismatch{
+					AccountId:  accountId,
+					Unit:       unit,
+					Projected:  projected,
+					Recomputed: expected,
+				})
+			}
+		}
+	}
+	report.Consistent = len(report.Mismatches) == 0
+	return report
+}
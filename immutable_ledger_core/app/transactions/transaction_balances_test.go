@@ -0,0 +1,133 @@
+package transactions
+
+import (
+	"maps"
+	"testing"
+
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/utils"
+)
+
+func TestGetBalancesAtMatchesFullReplay(t *testing.T) {
+	db := NewSafeTranasctionDatabase()
+	// alice moves once before the first boundary and then sits idle, bob moves
+	// all the time, carol only after the second boundary.
+	mustCreate(t, db, movement("cash", "alice", 500, "USD"))
+	mustCreate(t, db, movement("cash", "alice", 7, "EUR"))
+	for i := 3; i <= 2*BalanceSnapshotInterval+500; i++ {
+		switch {
+		case i > 2*BalanceSnapshotInterval && i%3 == 0:
+			mustCreate(t, db, movement("bob", "carol", 2, "USD"))
+		case i%2 == 0:
+			mustCreate(t, db, movement("cash", "bob", int64(i), "USD"))
+		default:
+			mustCreate(t, db, movement("bob", "cash", 1, "EUR"))
+		}
+	}
+
+	sequences := []uint64{0, 1, 2, 999, 1000, 1001, 1999, 2000, 2001, 2002, uint64(db.Head().Size)}
+	check := func(t *testing.T) {
+		t.Helper()
+		for _, sequence := range sequences {
+			replayed := computeBalances(db.entries[:sequence])
+			for _, accountId := range []string{"cash", "alice", "bob", "carol", "nobody"} {
+				got, err := db.GetBalancesAt(accountId, sequence)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := replayed[accountId]
+				if want == nil {
+					want = map[string]int64{}
+				}
+				if !maps.Equal(got, want) {
+					t.Fatalf("%s after entry %d = %v, want %v", accountId, sequence, got, want)
+				}
+			}
+		}
+	}
+	check(t)
+
+	// Snapshots are only taken for accounts that moved.
+	if snapshots := len(db.snapshots["alice"]); snapshots != 1 {
+		t.Fatalf("alice has %d snapshots, want 1", snapshots)
+	}
+	if snapshots := len(db.snapshots["carol"]); snapshots != 0 {
+		t.Fatalf("carol has %d snapshots, want 0", snapshots)
+	}
+	if snapshots := len(db.snapshots["bob"]); snapshots != 2 {
+		t.Fatalf("bob has %d snapshots, want 2", snapshots)
+	}
+
+	db.RebuildBalances()
+	check(t)
+
+	if _, err := db.GetBalancesAt("bob", uint64(db.Head().Size)+1); errorCode(err) != 400 {
+		t.Fatalf("balances beyond the head = %v, want code 400", err)
+	}
+	if report := db.CheckBalances(); !report.Consistent {
+		t.Fatalf("projection differs from the ledger: %+v", report.Mismatches)
+	}
+}
+
+func TestBalanceProjectionFollowsEveryAppend(t *testing.T) {
+	dir := t.TempDir()
+	open := func(t *testing.T) *TranasctionDatabase {
+		t.Helper()
+		storage, err := OpenSegmentLog(dir, DefaultSegmentSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		db, err := OpenTranasctionDatabase(storage, utils.DefaultHashAlgorithm, utils.GenerateHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return db
+	}
+	db := open(t)
+	original := mustCreate(t, db, movement("cash", "alice", 100, "USD"))
+	mustCreate(t, db, movement("alice", "bob", 30, "USD"))
+	mustCreate(t, db, movement("cash", "bob", 5, "EUR"))
+	reversed := int64(40)
+	if _, _, err := ReverseTransaction(original.TransactionId, ReversalDto{Amount: &reversed}, utils.GenerateID, utils.GenerateHash, db); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]map[string]int64{
+		"cash":   {"USD": -60, "EUR": -5},
+		"alice":  {"USD": 30},
+		"bob":    {"USD": 30, "EUR": 5},
+		"nobody": {},
+	}
+	check := func(t *testing.T, db *TranasctionDatabase) {
+		t.Helper()
+		for accountId, balances := range want {
+			got, sequence := db.GetBalances(accountId)
+			if !maps.Equal(got, balances) || sequence != 4 {
+				t.Fatalf("%s = %v at entry %d, want %v at entry 4", accountId, got, sequence, balances)
+			}
+		}
+	}
+	check(t, db)
+
+	// Replaying the write-ahead log builds the same projection.
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db = open(t)
+	check(t, db)
+
+	// A drifted projection is reported, and a rebuild brings it back.
+	db.balances["alice"]["USD"] += 7
+	report := db.CheckBalances()
+	if report.Consistent || len(report.Mismatches) != 1 || report.EntriesReplayed != 4 {
+		t.Fatalf("report = %+v, want one mismatch over 4 entries", report)
+	}
+	if mismatch := report.Mismatches[0]; mismatch != (BalanceMismatch{AccountId: "alice", Unit: "USD", Projected: 37, Recomputed: 30}) {
+		t.Fatalf("mismatch = %+v, want alice USD projected 37, recomputed 30", mismatch)
+	}
+	db.RebuildBalances()
+	check(t, db)
+	if report := db.CheckBalances(); !report.Consistent {
+		t.Fatalf("projection differs from the ledger after a rebuild: %+v", report.Mismatches)
+	}
+}
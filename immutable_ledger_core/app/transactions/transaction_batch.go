@@ -0,0 +1,272 @@
+package transactions
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// MaxBatchSize is how many transactions a batch can hold.
+const MaxBatchSize = 1000
+
+// batchKeySeparator joins the idempotency key of a batch to the index of each
+// of its transactions. Single requests cannot use a key containing it, so the
+// keys of batch items never collide with theirs.
+const batchKeySeparator = "\x1f"
+
+const (
+	BatchItemCreated    = "created"
+	BatchItemRejected   = "rejected"
+	BatchItemNotApplied = "not_applied"
+)
+
+type BatchDto struct {
+	Transactions []TransactionDto `json:"transactions" binding:"required,min=1,dive"`
+	// IdempotencyKey comes from the Idempotency-Key header, it covers the
+	// whole batch.
+	IdempotencyKey string `json:"-"`
+}
+
+// BatchItemResult is the outcome of one transaction of a batch. When the batch
+// is rejected, the items that caused it are rejected and every other one is
+// not_applied.
+type BatchItemResult struct {
+	Index       int               `json:"index"`
+	Status      string            `json:"status"`
+	Transaction *TransactionModel `json:"transaction,omitempty"`
+	Error       string            `json:"error,omitempty"`
+	Code        int               `json:"code,omitempty"`
+	Details     any               `json:"details,omitempty"`
+}
+
+// BatchResult lists the outcome of every transaction of a batch, in request
+// order, and the ledger head once the batch was applied or rejected.
+type BatchResult struct {
+	Results []BatchItemResult `json:"results"`
+	Head    LedgerHead        `json:"head"`
+}
+
+// BatchItemError is the error of the transaction at Index that rejected a batch.
+type BatchItemError struct {
+	Index int
+	Err   error
+}
+
+func (e *BatchItemError) Error() string {
+	return fmt.Sprintf("Transaction %d of the batch: %v", e.Index, e.Err)
+}
+
+func (e *BatchItemError) Unwrap() error {
+	return e.Err
+}
+
+// CreateTransactionBatch appends the transactions of a batch all or nothing.
+// Every transaction is validated first and the failures of all of them are
+// reported together. The rest of the checks run under a single write lock,
+// each transaction against the balances the earlier ones leave, and the
+// batch is stored in one write once every transaction passed.
+//
+// With an idempotency key, transaction i is recorded with batchItemKey, so a
+// retried batch returns the entries it created with replayed set.
+func CreateTransactionBatch(batchDto BatchDto, GenerateID func() string, GenerateHash func(string, string) (string, error), transactionDb *TranasctionDatabase) (BatchResult, bool, error) {
+	items := batchDto.Transactions
+	if len(items) > MaxBatchSize {
+		return BatchResult{}, false, &TransactionValidationError{
+			Message: fmt.Sprintf("A batch holds at most %d transactions", MaxBatchSize),
+			Code:    http.StatusBadRequest,
+		}
+	}
+	if err := checkIdempotencyKey(batchDto.IdempotencyKey); err != nil {
+		return BatchResult{}, false, err
+	}
+
+	var failures []*BatchItemError
+	for i := range items {
+		if batchDto.IdempotencyKey != "" {
+			items[i].IdempotencyKey = batchItemKey(batchDto.IdempotencyKey, i)
+		}
+		err := transactionDb.ResolveAmounts(items[i].Postings)
+		if err == nil {
+			err = validatePostings(items[i].Postings)
+		}
+		if err != nil {
+			failures = append(failures, &BatchItemError{Index: i, Err: err})
+		}
+	}
+	if len(failures) > 0 {
+		return rejectedBatch(len(items), failures, transactionDb.Head()), false, failures[0]
+	}
+
+	builds := make([]func(link ChainLink) (TransactionModel, error), len(items))
+	for i, transactionDto := range items {
+		builds[i] = func(link ChainLink) (TransactionModel, error) {
+			if err := transactionDb.checkPostings(transactionDto.Postings, false); err != nil {
+				return TransactionModel{}, err
+			}
+			return NewTransactionModel(transactionDto, link, GenerateID, GenerateHash)
+		}
+	}
+	keys := make([]string, len(items))
+	for i, transactionDto := range items {
+		keys[i] = transactionDto.IdempotencyKey
+	}
+
+	entries, replayed, head, err := transactionDb.AppendBatch(keys, builds)
+	if err != nil {
+		var itemErr *BatchItemError
+		if errors.As(err, &itemErr) {
+			return rejectedBatch(len(items), []*BatchItemError{itemErr}, head), false, err
+		}
+		return BatchResult{}, false, err
+	}
+
+	if replayed {
+		for i, transaction := range entries {
+			requestHash, err := items[i].Fingerprint(transaction.HashAlgorithm, GenerateHash)
+			if err != nil {
+				return BatchResult{}, false, err
+			}
+			if transaction.RequestHash != requestHash {
+				return BatchResult{}, false, &TransactionConflictError{
+					Message: "Idempotency key was already used for a different batch",
+					Code:    http.StatusConflict,
+				}
+			}
+		}
+	}
+
+	result := BatchResult{Results: make([]BatchItemResult, len(entries)), Head: head}
+	for i := range entries {
+		result.Results[i] = BatchItemResult{Index: i, Status: BatchItemCreated, Transaction: &entries[i]}
+	}
+	return result, replayed, nil
+}
+
+// AppendBatch builds and stores several entries under one write lock. Every
+// entry links to the one built before it and its debits are checked against
+// the balances the earlier ones leave, but nothing is stored or visible until
+// all of them are built: the first error, wrapped in a BatchItemError, rejects
+// the whole batch. When the first idempotency key was already used the entries
+// recorded for the keys are returned with replayed set. The returned head is
+// the one after the batch, or the unchanged one when it was rejected.
+func (db *TranasctionDatabase) AppendBatch(idempotencyKeys []string, builds []func(link ChainLink) (TransactionModel, error)) (entries []TransactionModel, replayed bool, head LedgerHead, err error) {
+	db.mut.Lock()
+	defer db.mut.Unlock()
+	defer func() {
+		head = db.headLocked()
+	}()
+
+	if len(idempotencyKeys) > 0 && idempotencyKeys[0] != "" {
+		if _, exists := db.idempotency[idempotencyKeys[0]]; exists {
+			entries, err = db.replayBatch(idempotencyKeys)
+			return entries, err == nil, head, err
+		}
+	}
+
+	link, err := db.nextLink()
+	if err != nil {
+		return nil, false, head, err
+	}
+	entries = make([]TransactionModel, 0, len(builds))
+	pending := make(map[balanceKey]int64)
+	batchIds := make(map[string]struct{}, len(builds))
+	for i, build := range builds {
+		transaction, err := build(link)
+		if err != nil {
+			return nil, false, head, &BatchItemError{Index: i, Err: err}
+		}
+		_, stored := db.store[transaction.TransactionId]
+		_, batched := batchIds[transaction.TransactionId]
+		if stored || batched {
+			return nil, false, head, &BatchItemError{Index: i, Err: &TransactionConflictError{
+				Message: "Transaction with the same ID already exists",
+				Code:    http.StatusConflict,
+			}}
+		}
+		if err := db.checkBalancePoliciesAfter(transaction, pending); err != nil {
+			return nil, false, head, &BatchItemError{Index: i, Err: err}
+		}
+
+		for _, posting := range transaction.Postings {
+			pending[balanceKey{AccountId: posting.AccountId, Asset: posting.Unit}] += posting.Delta()
+		}
+		batchIds[transaction.TransactionId] = struct{}{}
+		entries = append(entries, transaction)
+		link = ChainLink{
+			Sequence:      transaction.Sequence + 1,
+			PreviousHash:  transaction.Hash,
+			Timestamp:     transaction.Timestamp,
+			HashAlgorithm: transaction.HashAlgorithm,
+		}
+	}
+
+	if err := db.setBatch(entries); err != nil {
+		return nil, false, head, err
+	}
+	return entries, false, head, nil
+}
+
+// replayBatch returns the entries recorded for the idempotency keys of a batch,
+// callers must hold the lock. The keys must match a batch of the same size.
+func (db *TranasctionDatabase) replayBatch(idempotencyKeys []string) ([]TransactionModel, error) {
+	conflict := &TransactionConflictError{
+		Message: "Idempotency key was already used for a different batch",
+		Code:    http.StatusConflict,
+	}
+	entries := make([]TransactionModel, 0, len(idempotencyKeys))
+	for _, key := range idempotencyKeys {
+		transactionId, exists := db.idempotency[key]
+		if !exists {
+			return nil, conflict
+		}
+		entries = append(entries, db.store[transactionId])
+	}
+	// A longer batch was recorded under the same key.
+	batchKey, _, _ := strings.Cut(idempotencyKeys[0], batchKeySeparator)
+	if _, exists := db.idempotency[batchItemKey(batchKey, len(idempotencyKeys))]; exists {
+		return nil, conflict
+	}
+	return entries, nil
+}
+
+// batchItemKey is the idempotency key transaction index of a batch is
+// recorded with.
+func batchItemKey(batchKey string, index int) string {
+	return batchKey + batchKeySeparator + strconv.Itoa(index)
+}
+
+// checkIdempotencyKey refuses a key from a request that contains a control
+// character. batchKeySeparator is one, so such a key could replay the item of
+// a batch.
+func checkIdempotencyKey(key string) error {
+	if strings.ContainsFunc(key, unicode.IsControl) {
+		return &TransactionValidationError{
+			Message: "Idempotency key must not contain control characters",
+			Code:    http.StatusBadRequest,
+		}
+	}
+	return nil
+}
+
+func rejectedBatch(size int, failures []*BatchItemError, head LedgerHead) BatchResult {
+	result := BatchResult{Results: make([]BatchItemResult, size), Head: head}
+	for i := range result.Results {
+		result.Results[i] = BatchItemResult{Index: i, Status: BatchItemNotApplied}
+	}
+	for _, failure := range failures {
+		item := BatchItemResult{Index: failure.Index, Status: BatchItemRejected, Error: failure.Err.Error()}
+		var transErr TransactionError
+		if errors.As(failure.Err, &transErr) {
+			item.Code = transErr.GetCode()
+		}
+		var detailed interface{ GetDetails() any }
+		if errors.As(failure.Err, &detailed) {
+			item.Details = detailed.GetDetails()
+		}
+		result.Results[failure.Index] = item
+	}
+	return result
+}
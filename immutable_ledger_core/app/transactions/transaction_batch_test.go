@@ -0,0 +1,218 @@
+package transactions
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/utils"
+)
+
+func createBatch(db *TranasctionDatabase, key string, items ...TransactionDto) (BatchResult, bool, error) {
+	return CreateTransactionBatch(BatchDto{Transactions: items, IdempotencyKey: key}, utils.GenerateID, utils.GenerateHash, db)
+}
+
+func TestCreateTransactionBatchIsAllOrNothing(t *testing.T) {
+	withId := func(transactionDto TransactionDto, transactionId string) TransactionDto {
+		transactionDto.TransactionId = transactionId
+		return transactionDto
+	}
+	unbalanced := TransactionDto{Postings: []PostingDto{debit("cash", 10, "USD"), credit("bob", 9, "USD")}}
+
+	tests := []struct {
+		name  string
+		items []TransactionDto
+		code  int
+		// rejected are the indexes reported as rejected, every other one is not_applied.
+		rejected []int
+	}{
+		{
+			name:     "unbalanced item",
+			items:    []TransactionDto{movement("cash", "bob", 10, "USD"), unbalanced, movement("cash", "bob", 10, "USD")},
+			code:     422,
+			rejected: []int{1},
+		},
+		{
+			name:     "every invalid item is reported",
+			items:    []TransactionDto{unbalanced, movement("cash", "bob", 10, "USD"), {Postings: []PostingDto{}}},
+			code:     422,
+			rejected: []int{0, 2},
+		},
+		{
+			name:     "overdraft after the earlier items",
+			items:    []TransactionDto{movement("cash", "alice", 50, "USD"), movement("alice", "bob", 30, "USD"), movement("alice", "bob", 31, "USD")},
+			code:     422,
+			rejected: []int{2},
+		},
+		{
+			name:     "transaction_id already in the ledger",
+			items:    []TransactionDto{movement("cash", "bob", 10, "USD"), withId(movement("cash", "bob", 10, "USD"), "existing")},
+			code:     409,
+			rejected: []int{1},
+		},
+		{
+			name:     "transaction_id twice in the batch",
+			items:    []TransactionDto{withId(movement("cash", "bob", 10, "USD"), "twice"), withId(movement("cash", "bob", 20, "USD"), "twice")},
+			code:     409,
+			rejected: []int{1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := NewSafeTranasctionDatabase()
+			if err := db.SetBalancePolicy(AccountPolicy{AccountId: "alice", BalancePolicy: BalancePolicy{Type: PolicyNoOverdraft}}); err != nil {
+				t.Fatal(err)
+			}
+			mustCreate(t, db, withId(movement("cash", "alice", 10, "USD"), "existing"))
+			head := db.Head()
+
+			result, _, err := createBatch(db, "batch", tt.items...)
+			if errorCode(err) != tt.code {
+				t.Fatalf("CreateTransactionBatch() = %v, want code %d", err, tt.code)
+			}
+			var itemErr *BatchItemError
+			if !errors.As(err, &itemErr) || itemErr.Index != tt.rejected[0] {
+				t.Fatalf("error %v does not name item %d", err, tt.rejected[0])
+			}
+
+			if result.Head != head || db.Head() != head {
+				t.Fatalf("head moved from %+v to %+v", head, db.Head())
+			}
+			for _, account := range []string{"alice", "bob"} {
+				balances, _ := db.GetBalances(account)
+				if want := map[string]int64{"alice": 10}[account]; balances["USD"] != want {
+					t.Fatalf("%s has %d, want %d", account, balances["USD"], want)
+				}
+			}
+			if _, exists := db.idempotency[batchItemKey("batch", 0)]; exists {
+				t.Fatal("a rejected batch recorded its idempotency key")
+			}
+
+			if len(result.Results) != len(tt.items) {
+				t.Fatalf("got %d results for %d items", len(result.Results), len(tt.items))
+			}
+			rejected := map[int]bool{}
+			for _, index := range tt.rejected {
+				rejected[index] = true
+			}
+			for i, item := range result.Results {
+				switch {
+				case rejected[i] && (item.Status != BatchItemRejected || item.Error == "" || item.Code == 0):
+					t.Fatalf("result %d = %+v, want it rejected", i, item)
+				case !rejected[i] && item.Status != BatchItemNotApplied:
+					t.Fatalf("result %d = %+v, want it not applied", i, item)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateTransactionBatchRejectsOversizedBatches(t *testing.T) {
+	db := NewSafeTranasctionDatabase()
+	items := make([]TransactionDto, MaxBatchSize+1)
+	for i := range items {
+		items[i] = movement("cash", "bob", 1, "USD")
+	}
+	if _, _, err := createBatch(db, "", items...); errorCode(err) != 400 {
+		t.Fatalf("batch of %d = %v, want code 400", len(items), err)
+	}
+	if result, _, err := createBatch(db, "", items[:MaxBatchSize]...); err != nil || len(result.Results) != MaxBatchSize {
+		t.Fatalf("batch of %d = %v", MaxBatchSize, err)
+	}
+}
+
+func TestCreateTransactionBatchIdempotency(t *testing.T) {
+	batch := []TransactionDto{movement("cash", "alice", 10, "USD"), movement("cash", "bob", 20, "USD")}
+
+	tests := []struct {
+		name  string
+		retry []TransactionDto
+		code  int
+	}{
+		{"same batch", batch, 0},
+		{"different amount", []TransactionDto{movement("cash", "alice", 10, "USD"), movement("cash", "bob", 21, "USD")}, 409},
+		{"shorter batch", batch[:1], 409},
+		{"longer batch", append(batch[:2:2], movement("cash", "carol", 30, "USD")), 409},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := NewSafeTranasctionDatabase()
+			first, replayed, err := createBatch(db, "K", batch...)
+			if err != nil || replayed {
+				t.Fatalf("first batch = %v, replayed %v", err, replayed)
+			}
+			head := db.Head()
+
+			retry, replayed, err := createBatch(db, "K", tt.retry...)
+			if db.Head() != head {
+				t.Fatal("a retried batch changed the ledger")
+			}
+			if tt.code != 0 {
+				if errorCode(err) != tt.code {
+					t.Fatalf("retry = %v, want code %d", err, tt.code)
+				}
+				return
+			}
+			if err != nil || !replayed {
+				t.Fatalf("retry = %v, replayed %v", err, replayed)
+			}
+			for i := range first.Results {
+				if retry.Results[i].Transaction.TransactionId != first.Results[i].Transaction.TransactionId {
+					t.Fatalf("retry returned entry %s for item %d, want %s", retry.Results[i].Transaction.TransactionId, i, first.Results[i].Transaction.TransactionId)
+				}
+			}
+		})
+	}
+}
+
+func TestBatchAndSingleKeysDoNotCollide(t *testing.T) {
+	db := NewSafeTranasctionDatabase()
+	single := movement("cash", "alice", 10, "USD")
+	single.IdempotencyKey = "K#0"
+	mustCreate(t, db, single)
+
+	// Under the old "<key>#i" scheme this batch replayed the single entry.
+	result, replayed, err := createBatch(db, "K", movement("cash", "bob", 20, "USD"))
+	if err != nil || replayed {
+		t.Fatalf("batch = %v, replayed %v", err, replayed)
+	}
+	single.IdempotencyKey = "K"
+	if transaction, replayed, err := CreateTransaction(single, utils.GenerateID, utils.GenerateHash, db); err != nil || replayed || transaction.TransactionId == result.Results[0].Transaction.TransactionId {
+		t.Fatalf("single request with the batch key = %v, replayed %v", err, replayed)
+	}
+	if size := db.Head().Size; size != 3 {
+		t.Fatalf("ledger holds %d entries, want 3", size)
+	}
+
+	// A single request cannot reach the key of a batch item.
+	single.IdempotencyKey = batchItemKey("K", 0)
+	if _, _, err := CreateTransaction(single, utils.GenerateID, utils.GenerateHash, db); errorCode(err) != 400 {
+		t.Fatalf("single request with a batch item key = %v, want code 400", err)
+	}
+	if _, _, err := createBatch(db, batchItemKey("K", 0), movement("cash", "bob", 20, "USD")); errorCode(err) != 400 {
+		t.Fatalf("batch with a batch item key = %v, want code 400", err)
+	}
+}
+
+func TestCheckIdempotencyKey(t *testing.T) {
+	tests := []struct {
+		key   string
+		valid bool
+	}{
+		{"", true},
+		{"order-42", true},
+		{"clé #1 ✓", true},
+		{batchItemKey("K", 0), false},
+		{"K\n", false},
+		{"K\x00", false},
+		{"K\t1", false},
+		{"K\u0085", false},
+	}
+
+	for _, tt := range tests {
+		if err := checkIdempotencyKey(tt.key); (err == nil) != tt.valid || (err != nil && errorCode(err) != 400) {
+			t.Errorf("checkIdempotencyKey(%q) = %v, want valid %v", tt.key, err, tt.valid)
+		}
+	}
+}
@@ -1,28 +1,381 @@
 package transactions
 
 import (
+	"encoding/hex"
 	"fmt"
+	"net/http"
+	"slices"
 	"sync"
+	"time"
+
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/merkle"
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/utils"
 )
 
 type TranasctionDatabase struct {
-	store    map[string]TransactionModel
-	lastHash string
-	mut      sync.RWMutex
+	store         map[string]TransactionModel
+	lastHash      string
+	mut           sync.RWMutex
+	storage       TransactionStorage
+	hashAlgorithm string
+	generateHash  func(string, string) (string, error)
+	tree          *merkle.Tree
+	// entries holds the ledger in sequence order, entries[i].Sequence == i+1.
+	entries     []TransactionModel
+	idempotency map[string]string
+	reversals   map[string][]string
+	// balances is the projection of posted balances per account and asset.
+	// snapshots lists the snapshots of every account in sequence order, moved
+	// the accounts posted to since the last snapshot boundary.
+	balances  map[string]map[string]int64
+	snapshots map[string][]balanceSnapshot
+	moved     map[string]struct{}
+	// policies[account][asset] bounds debits, the "" asset covers the whole
+	// account. defaultPolicy applies when neither is set.
+	policies      map[string]map[string]BalancePolicy
+	defaultPolicy BalancePolicy
+	// accountChecker, when set, decides whether an account may receive a
+	// posting in an asset. The ledger itself knows accounts only by ID.
+	accountChecker AccountChecker
+	assetResolver  AssetResolver
+	// holds is the projection of the hold records of the ledger by hold ID.
+	// accountHolds holds the IDs of the pending holds of every account, a hold
+	// leaves it when it is closed and joins closedHolds, which lists the holds
+	// of every account in the order they were closed. openHolds orders the
+	// pending holds by expiry, for ExpireHolds.
+	holds        map[string]Hold
+	accountHolds map[string]map[string]struct{}
+	closedHolds  map[string][]string
+	openHolds    *holdQueue
+	// transfers maps transfer IDs to the ID of their entry.
+	transfers map[string]string
+	// appended is closed and replaced after every append, see Appended.
+	appended chan struct{}
 }
 
+// AccountChecker returns an error when a new posting to accountId in asset
+// must be rejected. Correction is set for the postings of a reversal, which
+// undo an existing entry rather than start a new movement. It is called with
+// the write lock held, so it must not call back into the database.
+type AccountChecker func(accountId, asset string, correction bool) error
+
+// AssetResolver returns the scale of an asset, or an error when new postings
+// in it must be rejected. Like AccountChecker it runs under the write lock.
+type AssetResolver func(asset string) (scale int, err error)
+
 func NewSafeTranasctionDatabase() *TranasctionDatabase {
 	return &TranasctionDatabase{
-		store:    make(map[string]TransactionModel),
-		lastHash: "echochain",
+		store:         make(map[string]TransactionModel),
+		storage:       NewMemoryStorage(),
+		hashAlgorithm: utils.DefaultHashAlgorithm,
+		generateHash:  utils.GenerateHash,
+		tree:          merkle.New(),
+		idempotency:   make(map[string]string),
+		reversals:     make(map[string][]string),
+		balances:      make(map[string]map[string]int64),
+		snapshots:     make(map[string][]balanceSnapshot),
+		moved:         make(map[string]struct{}),
+		policies:      make(map[string]map[string]BalancePolicy),
+		defaultPolicy: BalancePolicy{Type: PolicyUnlimited},
+		holds:         make(map[string]Hold),
+		accountHolds:  make(map[string]map[string]struct{}),
+		closedHolds:   make(map[string][]string),
+		openHolds:     newHoldQueue(),
+		transfers:     make(map[string]string),
+		appended:      make(chan struct{}),
+	}
+}
+
+// OpenTranasctionDatabase replays the entries kept by storage and re-verifies
+// their content hashes and chain links before the database accepts new writes.
+// New entries are hashed with hashAlgorithm, replayed ones with their own.
+func OpenTranasctionDatabase(storage TransactionStorage, hashAlgorithm string, GenerateHash func(string, string) (string, error)) (*TranasctionDatabase, error) {
+	if !utils.IsSupportedHashAlgorithm(hashAlgorithm) {
+		return nil, fmt.Errorf("unsupported hash algorithm %q", hashAlgorithm)
+	}
+
+	entries, err := storage.Load()
+	if err != nil {
+		return nil, err
 	}
+
+	db := &TranasctionDatabase{
+		store:         make(map[string]TransactionModel, len(entries)),
+		storage:       storage,
+		hashAlgorithm: hashAlgorithm,
+		generateHash:  GenerateHash,
+		tree:          merkle.New(),
+		entries:       make([]TransactionModel, 0, len(entries)),
+		idempotency:   make(map[string]string),
+		reversals:     make(map[string][]string),
+		balances:      make(map[string]map[string]int64),
+		snapshots:     make(map[string][]balanceSnapshot),
+		moved:         make(map[string]struct{}),
+		policies:      make(map[string]map[string]BalancePolicy),
+		defaultPolicy: BalancePolicy{Type: PolicyUnlimited},
+		holds:         make(map[string]Hold),
+		accountHolds:  make(map[string]map[string]struct{}),
+		closedHolds:   make(map[string][]string),
+		openHolds:     newHoldQueue(),
+		transfers:     make(map[string]string),
+		appended:      make(chan struct{}),
+	}
+	report := VerifyEntries(entries, GenerateHash)
+	if !report.Valid {
+		failure := report.Failure
+		return nil, fmt.Errorf("replay: %s at position %d (transaction %s): %s", failure.Kind, failure.Position, failure.TransactionId, failure.Message)
+	}
+	for _, entry := range entries {
+		db.index(entry.TransactionId, entry)
+	}
+	return db, nil
+}
+
+func (db *TranasctionDatabase) SetAccountChecker(checker AccountChecker) {
+	db.mut.Lock()
+	defer db.mut.Unlock()
+	db.accountChecker = checker
 }
 
-func (db *TranasctionDatabase) Set(key string, value TransactionModel) {
+func (db *TranasctionDatabase) SetAssetResolver(resolver AssetResolver) {
 	db.mut.Lock()
 	defer db.mut.Unlock()
+	db.assetResolver = resolver
+}
+
+// checkPostings runs the asset resolver and the account checker over every
+// posting, correction is set for reversals. Callers must hold the write lock.
+func (db *TranasctionDatabase) checkPostings(postings []PostingDto, correction bool) error {
+	for _, posting := range postings {
+		if db.assetResolver != nil {
+			if _, err := db.assetResolver(posting.Unit); err != nil {
+				return err
+			}
+		}
+		if db.accountChecker != nil {
+			if err := db.accountChecker(posting.AccountId, posting.Unit, correction); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ResolveAmounts converts the decimal amounts of postings into minor units
+// with the scale of their asset. Scales never change once an asset exists.
+func (db *TranasctionDatabase) ResolveAmounts(postings []PostingDto) error {
+	for i, posting := range postings {
+		if posting.DecimalAmount == "" {
+			continue
+		}
+		amount, err := db.resolveAmount(posting.Unit, posting.DecimalAmount)
+		if err != nil {
+			return err
+		}
+		postings[i].Amount = amount
+		postings[i].DecimalAmount = ""
+	}
+	return nil
+}
+
+// resolveAmount converts a decimal amount of an asset into minor units.
+func (db *TranasctionDatabase) resolveAmount(unit string, decimal string) (int64, error) {
+	db.mut.RLock()
+	resolver := db.assetResolver
+	db.mut.RUnlock()
+
+	if resolver == nil {
+		return 0, &TransactionMalformed{
+			Message: "Decimal amounts need an asset registry, send minor units instead",
+			Code:    http.StatusUnprocessableEntity,
+		}
+	}
+	scale, err := resolver(unit)
+	if err != nil {
+		return 0, err
+	}
+	amount, err := utils.ParseDecimal(decimal, scale)
+	if err != nil {
+		return 0, &TransactionMalformed{
+			Message: fmt.Sprintf("Amount of %s: %v", unit, err),
+			Code:    http.StatusUnprocessableEntity,
+		}
+	}
+	return amount, nil
+}
+
+func (db *TranasctionDatabase) HashAlgorithm() string {
+	return db.hashAlgorithm
+}
+
+func (db *TranasctionDatabase) Close() error {
+	return db.storage.Close()
+}
+
+func (db *TranasctionDatabase) Set(key string, value TransactionModel) error {
+	db.mut.Lock()
+	defer db.mut.Unlock()
+	return db.set(key, value)
+}
+
+// set persists the entry before it becomes visible, callers must hold the write lock.
+func (db *TranasctionDatabase) set(key string, value TransactionModel) error {
+	if value.Sequence != db.nextSequence() {
+		return &TransactionRuleViolationError{
+			Message: fmt.Sprintf("Transaction sequence %d is out of order, expected %d", value.Sequence, db.nextSequence()),
+			Code:    http.StatusConflict,
+		}
+	}
+	if err := db.storage.Append(value); err != nil {
+		return err
+	}
+	db.index(key, value)
+	db.notifyAppended()
+	return nil
+}
+
+// setBatch persists consecutive entries in a single storage append, so either
+// all of them survive a crash or none does. Callers must hold the write lock.
+func (db *TranasctionDatabase) setBatch(values []TransactionModel) error {
+	for i, value := range values {
+		if expected := db.nextSequence() + uint64(i); value.Sequence != expected {
+			return &TransactionRuleViolationError{
+				Message: fmt.Sprintf("Transaction sequence %d is out of order, expected %d", value.Sequence, expected),
+				Code:    http.StatusConflict,
+			}
+		}
+	}
+	if err := db.storage.Append(values...); err != nil {
+		return err
+	}
+	for _, value := range values {
+		db.index(value.TransactionId, value)
+	}
+	db.notifyAppended()
+	return nil
+}
+
+// notifyAppended wakes up the followers waiting on Appended, callers must
+// hold the write lock.
+func (db *TranasctionDatabase) notifyAppended() {
+	close(db.appended)
+	db.appended = make(chan struct{})
+}
+
+// Appended returns a channel that is closed when the next entry is appended.
+// Followers take it before reading the entries they have not seen yet, so an
+// append that happens while they read still wakes them up.
+func (db *TranasctionDatabase) Appended() <-chan struct{} {
+	db.mut.RLock()
+	defer db.mut.RUnlock()
+	return db.appended
+}
+
+// index makes a persisted entry visible, callers must hold the write lock.
+func (db *TranasctionDatabase) index(key string, value TransactionModel) {
 	db.store[key] = value
 	db.lastHash = value.Hash
+	db.entries = append(db.entries, value)
+	db.tree.Append([]byte(value.Hash))
+	if value.IdempotencyKey != "" {
+		db.idempotency[value.IdempotencyKey] = key
+	}
+	if value.ReversalOf != "" {
+		db.reversals[value.ReversalOf] = append(db.reversals[value.ReversalOf], key)
+	}
+	if value.TransferId != "" {
+		db.transfers[value.TransferId] = key
+	}
+	db.projectBalances(value)
+	db.projectHolds(value)
+}
+
+func (db *TranasctionDatabase) nextSequence() uint64 {
+	return uint64(len(db.entries)) + 1
+}
+
+// nextLink describes where the next entry attaches to the chain, callers must
+// hold the write lock. Timestamps never go backwards along the chain, even when
+// the wall clock does, so the ledger can be searched by time.
+func (db *TranasctionDatabase) nextLink() (ChainLink, error) {
+	link := ChainLink{
+		Sequence:      db.nextSequence(),
+		PreviousHash:  db.lastHash,
+		Timestamp:     time.Now().UTC(),
+		HashAlgorithm: db.hashAlgorithm,
+	}
+	if len(db.entries) == 0 {
+		genesisHash, err := GenesisHash(db.hashAlgorithm, db.generateHash)
+		if err != nil {
+			return ChainLink{}, err
+		}
+		link.PreviousHash = genesisHash
+		return link, nil
+	}
+	if last := db.entries[len(db.entries)-1].Timestamp; link.Timestamp.Before(last) {
+		link.Timestamp = last
+	}
+	return link, nil
+}
+
+// Append builds the next entry on top of the current chain head and stores it
+// while holding the write lock, so two writers can never take the same
+// sequence number or link to the same head.
+func (db *TranasctionDatabase) Append(build func(link ChainLink) (TransactionModel, error)) (TransactionModel, error) {
+	db.mut.Lock()
+	defer db.mut.Unlock()
+	return db.appendLocked(build)
+}
+
+// AppendOnce is Append for retried requests: when the idempotency key or the
+// transaction ID was already used, the entry recorded for it is returned with
+// replayed set and nothing is appended. The lookup happens under the same lock
+// as the append, so concurrent retries cannot both go through. The keys of
+// batch items are out of reach, see checkIdempotencyKey.
+func (db *TranasctionDatabase) AppendOnce(idempotencyKey string, transactionId string, build func(link ChainLink) (TransactionModel, error)) (transaction TransactionModel, replayed bool, err error) {
+	if err := checkIdempotencyKey(idempotencyKey); err != nil {
+		return TransactionModel{}, false, err
+	}
+	db.mut.Lock()
+	defer db.mut.Unlock()
+
+	if idempotencyKey != "" {
+		if existingId, exists := db.idempotency[idempotencyKey]; exists {
+			return db.store[existingId], true, nil
+		}
+	}
+	if transactionId != "" {
+		if existing, exists := db.store[transactionId]; exists {
+			return existing, true, nil
+		}
+	}
+
+	transaction, err = db.appendLocked(build)
+	return transaction, false, err
+}
+
+func (db *TranasctionDatabase) appendLocked(build func(link ChainLink) (TransactionModel, error)) (TransactionModel, error) {
+	link, err := db.nextLink()
+	if err != nil {
+		return TransactionModel{}, err
+	}
+	transaction, err := build(link)
+	if err != nil {
+		return TransactionModel{}, err
+	}
+	if _, exists := db.store[transaction.TransactionId]; exists {
+		return TransactionModel{}, &TransactionConflictError{
+			Message: "Transaction with the same ID already exists",
+			Code:    http.StatusConflict,
+		}
+	}
+	if err := db.checkBalancePolicies(transaction); err != nil {
+		return TransactionModel{}, err
+	}
+	if err := db.set(transaction.TransactionId, transaction); err != nil {
+		return TransactionModel{}, err
+	}
+	return transaction, nil
 }
 
 func (db *TranasctionDatabase) Get(key string) (TransactionModel, bool) {
@@ -32,53 +385,98 @@ func (db *TranasctionDatabase) Get(key string) (TransactionModel, bool) {
 	return value, exists
 }
 
-func (db *TranasctionDatabase) GetDataFromAccount(accountId string) []TransactionModel {
+// GetView returns the entry together with the reversals that point at it.
+func (db *TranasctionDatabase) GetView(key string) (TransactionView, bool) {
 	db.mut.RLock()
 	defer db.mut.RUnlock()
-	var transactions []TransactionModel
-	for _, transaction := range db.store {
-		if transaction.AccountId == accountId {
-			transactions = append(transactions, transaction)
-		}
+	value, exists := db.store[key]
+	if !exists {
+		return TransactionView{}, false
 	}
-	return transactions
+	return TransactionView{
+		TransactionModel: value,
+		ReversedBy:       slices.Clone(db.reversals[key]),
+	}, true
 }
 
-func (db *TranasctionDatabase) GetAllTransactions(filters LedgerFilters) []TransactionModel {
+// Entries returns a snapshot of the ledger in sequence order.
+func (db *TranasctionDatabase) Entries() []TransactionModel {
+	db.mut.RLock()
+	defer db.mut.RUnlock()
+	return slices.Clone(db.entries)
+}
 
+func (db *TranasctionDatabase) Head() LedgerHead {
 	db.mut.RLock()
 	defer db.mut.RUnlock()
-	transactions := make([]TransactionModel, 0, len(db.store))
-	for _, transaction := range db.store {
-		if !match(transaction, filters) {
-			continue
+	return db.headLocked()
+}
+
+// headLocked describes the tip of the ledger, callers must hold the lock.
+func (db *TranasctionDatabase) headLocked() LedgerHead {
+	head := LedgerHead{
+		Size: db.tree.Size(),
+		Root: hex.EncodeToString(db.tree.Root()),
+	}
+	if head.Size > 0 {
+		head.LastHash = db.lastHash
+	}
+	return head
+}
+
+// InclusionProof returns the Merkle audit path of a transaction to the current root.
+func (db *TranasctionDatabase) InclusionProof(transactionId string) (merkle.InclusionProof, error) {
+	db.mut.RLock()
+	defer db.mut.RUnlock()
+	transaction, exists := db.store[transactionId]
+	if !exists {
+		return merkle.InclusionProof{}, &TransactionNotFoundError{
+			Message: "Transaction not found",
+			Code:    http.StatusNotFound,
 		}
+	}
+	return db.tree.InclusionProof(int(transaction.Sequence-1), db.tree.Size())
+}
 
-		if filters.Limit != nil && len(transactions) >= *filters.Limit {
-			break
+// ConsistencyProof proves the ledger of firstSize entries is a prefix of the
+// ledger of secondSize entries. A nil secondSize means the current size.
+func (db *TranasctionDatabase) ConsistencyProof(firstSize int, secondSize *int) (merkle.ConsistencyProof, error) {
+	db.mut.RLock()
+	defer db.mut.RUnlock()
+	second := db.tree.Size()
+	if secondSize != nil {
+		second = *secondSize
+	}
+	proof, err := db.tree.ConsistencyProof(firstSize, second)
+	if err != nil {
+		return merkle.ConsistencyProof{}, &TransactionValidationError{
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
 		}
-		transactions = append(transactions, transaction)
 	}
+	return proof, nil
+}
+
+func (db *TranasctionDatabase) GetDataFromAccount(accountId string) []TransactionModel {
+	_, transactions, _ := db.AccountActivity(accountId, nil, nil)
 	return transactions
 }
 
 func match(tx TransactionModel, f LedgerFilters) bool {
 
-	if f.AccountId != nil && tx.AccountId != *f.AccountId {
+	if f.AccountId != nil && !tx.HasAccount(*f.AccountId) {
 		return false
 	}
 
-	if f.AssetType != nil && tx.Asset.Unit != *f.AssetType {
+	if f.AssetType != nil && !tx.HasUnit(*f.AssetType) {
 		return false
 	}
 
 	if f.FromTimestamp != nil && tx.Timestamp.Before(*f.FromTimestamp) {
-		fmt.Println("here")
 		return false
 	}
 
 	if f.ToTimestamp != nil && tx.Timestamp.After(*f.ToTimestamp) {
-		fmt.Println("here1")
 		return false
 	}
 
@@ -14,6 +14,10 @@ func (e *TransactionConflictError) Error() string {
 	return e.Message
 }
 
+func (e *TransactionConflictError) GetCode() int {
+	return e.Code
+}
+
 type TransactionNotFoundError struct {
 	Message string
 	Code    int
@@ -23,6 +27,10 @@ func (e *TransactionNotFoundError) Error() string {
 	return e.Message
 }
 
+func (e *TransactionNotFoundError) GetCode() int {
+	return e.Code
+}
+
 type TransactionValidationError struct {
 	Message string
 	Code    int
@@ -32,15 +40,30 @@ func (e *TransactionValidationError) Error() string {
 	return e.Message
 }
 
+func (e *TransactionValidationError) GetCode() int {
+	return e.Code
+}
+
+// TransactionRuleViolationError may carry Details, such as the balance a
+// policy left available, which is returned next to the message.
 type TransactionRuleViolationError struct {
 	Message string
 	Code    int
+	Details any
 }
 
 func (e *TransactionRuleViolationError) Error() string {
 	return e.Message
 }
 
+func (e *TransactionRuleViolationError) GetCode() int {
+	return e.Code
+}
+
+func (e *TransactionRuleViolationError) GetDetails() any {
+	return e.Details
+}
+
 type TransactionMalformed struct {
 	Message string
 	Code    int
@@ -49,3 +72,7 @@ type TransactionMalformed struct {
 func (e *TransactionMalformed) Error() string {
 	return e.Message
 }
+
+func (e *TransactionMalformed) GetCode() int {
+	return e.Code
+}
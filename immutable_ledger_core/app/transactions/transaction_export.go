@@ -0,0 +1,84 @@
+package transactions
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// scanBatchSize is how many entries ScanEntries copies per read lock.
+const scanBatchSize = 500
+
+// ScanEntries calls visit for every entry up to sequence until that matches
+// filters, in sequence order. The ledger is read in batches and the lock is
+// never held while visit runs, so a slow reader does not block appends and
+// the whole ledger is never copied at once. Pagination fields of filters are
+// ignored, AfterSequence sets where the scan starts.
+func (db *TranasctionDatabase) ScanEntries(filters LedgerFilters, until uint64, visit func(TransactionModel) error) error {
+	var position uint64
+	if filters.AfterSequence != nil {
+		position = *filters.AfterSequence
+	}
+
+	for position < until {
+		db.mut.RLock()
+		end := min(until, position+scanBatchSize, uint64(len(db.entries)))
+		batch := make([]TransactionModel, 0, end-position)
+		for _, transaction := range db.entries[position:end] {
+			if match(transaction, filters) {
+				batch = append(batch, transaction)
+			}
+		}
+		db.mut.RUnlock()
+
+		if end == position {
+			return nil
+		}
+		position = end
+		for _, transaction := range batch {
+			if err := visit(transaction); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// CSVHeader is the column order of CSVRecord. Postings are a JSON array and
+// hold the JSON hold record, if any, so a row holds everything needed to
+// recompute the entry hash. Columns added later go at the end.
+var CSVHeader = []string{
+	"sequence", "transaction_id", "timestamp", "description", "postings",
+	"idempotency_key", "request_hash", "reversal_of",
+	"hash_algorithm", "hash_version", "hash", "previous_hash", "hold",
+	"transfer_id",
+}
+
+func CSVRecord(transaction TransactionModel) ([]string, error) {
+	postings, err := json.Marshal(transaction.Postings)
+	if err != nil {
+		return nil, err
+	}
+	var hold []byte
+	if transaction.Hold != nil {
+		if hold, err = json.Marshal(transaction.Hold); err != nil {
+			return nil, err
+		}
+	}
+	return []string{
+		strconv.FormatUint(transaction.Sequence, 10),
+		transaction.TransactionId,
+		transaction.Timestamp.UTC().Format(time.RFC3339Nano),
+		transaction.Description,
+		string(postings),
+		transaction.IdempotencyKey,
+		transaction.RequestHash,
+		transaction.ReversalOf,
+		transaction.HashAlgorithm,
+		strconv.Itoa(transaction.HashVersion),
+		transaction.Hash,
+		transaction.PreviousHash,
+		string(hold),
+		transaction.TransferId,
+	}, nil
+}
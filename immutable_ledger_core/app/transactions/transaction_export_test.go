@@ -0,0 +1,103 @@
+package transactions
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/utils"
+)
+
+// fromCSVRecord rebuilds an entry from a row written with CSVHeader.
+func fromCSVRecord(t *testing.T, row []string) TransactionModel {
+	t.Helper()
+	column := make(map[string]string, len(CSVHeader))
+	for i, name := range CSVHeader {
+		column[name] = row[i]
+	}
+	transaction := TransactionModel{
+		TransactionId:  column["transaction_id"],
+		Description:    column["description"],
+		IdempotencyKey: column["idempotency_key"],
+		RequestHash:    column["request_hash"],
+		ReversalOf:     column["reversal_of"],
+		HashAlgorithm:  column["hash_algorithm"],
+		Hash:           column["hash"],
+		PreviousHash:   column["previous_hash"],
+		TransferId:     column["transfer_id"],
+	}
+	var err error
+	if transaction.Sequence, err = strconv.ParseUint(column["sequence"], 10, 64); err != nil {
+		t.Fatal(err)
+	}
+	if transaction.Timestamp, err = time.Parse(time.RFC3339Nano, column["timestamp"]); err != nil {
+		t.Fatal(err)
+	}
+	if transaction.HashVersion, err = strconv.Atoi(column["hash_version"]); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(column["postings"]), &transaction.Postings); err != nil {
+		t.Fatal(err)
+	}
+	if column["hold"] != "" {
+		if err := json.Unmarshal([]byte(column["hold"]), &transaction.Hold); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return transaction
+}
+
+func TestCSVRecordKeepsTheHashedContent(t *testing.T) {
+	db := NewSafeTranasctionDatabase()
+	keyed := movement("cash", "alice", 100, "USD")
+	keyed.IdempotencyKey = "key"
+	original := mustCreate(t, db, keyed)
+	reversed := int64(10)
+	if _, _, err := ReverseTransaction(original.TransactionId, ReversalDto{Amount: &reversed}, utils.GenerateID, utils.GenerateHash, db); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := CreateTransfer(TransferDto{SourceAccountId: "alice", DestinationAccountId: "bob", Asset: "USD", Amount: 20}, utils.GenerateID, utils.GenerateHash, db); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := AuthorizeHold(HoldDto{AccountId: "alice", DestinationAccountId: "shop", Asset: "USD", Amount: 30}, utils.GenerateID, utils.GenerateHash, db); err != nil {
+		t.Fatal(err)
+	}
+
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+	if err := writer.Write(CSVHeader); err != nil {
+		t.Fatal(err)
+	}
+	err := db.ScanEntries(LedgerFilters{}, uint64(db.Head().Size), func(transaction TransactionModel) error {
+		record, err := CSVRecord(transaction)
+		if err != nil {
+			return err
+		}
+		return writer.Write(record)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer.Flush()
+
+	rows, err := csv.NewReader(&buffer).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 5 {
+		t.Fatalf("got %d rows, want a header and 4 entries", len(rows))
+	}
+	for _, row := range rows[1:] {
+		transaction := fromCSVRecord(t, row)
+		hash, err := ComputeHash(transaction, utils.GenerateHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hash != transaction.Hash {
+			t.Fatalf("entry %d rebuilt from its row hashes to %s, want %s", transaction.Sequence, hash, transaction.Hash)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package transactions
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+const genesisSeed = "echochain"
+
+// CurrentHashVersion is the canonical serialization used for new entries.
+//
+// Version 1 is the JSON object of every field of TransactionModel except
+// "hash", with keys sorted, no insignificant whitespace and timestamps in
+// RFC 3339 UTC with nanoseconds. Fields added to the model later must be
+// "omitempty" so entries written before they existed keep the same content.
+const CurrentHashVersion = 1
+
+// CanonicalContent returns the bytes the hash of tx is computed over, in the
+// serialization recorded by tx.HashVersion.
+func CanonicalContent(tx TransactionModel) ([]byte, error) {
+	switch tx.HashVersion {
+	case 1:
+		return canonicalJSON(tx)
+	default:
+		return nil, fmt.Errorf("unsupported hash version %d", tx.HashVersion)
+	}
+}
+
+// ComputeHash hashes the canonical content of tx with the algorithm recorded on it.
+func ComputeHash(tx TransactionModel, GenerateHash func(string, string) (string, error)) (string, error) {
+	content, err := CanonicalContent(tx)
+	if err != nil {
+		return "", err
+	}
+	return GenerateHash(tx.HashAlgorithm, string(content))
+}
+
+// GenesisHash is the previous hash of the first entry of a ledger.
+func GenesisHash(algorithm string, GenerateHash func(string, string) (string, error)) (string, error) {
+	return GenerateHash(algorithm, genesisSeed)
+}
+
+func canonicalJSON(tx TransactionModel) ([]byte, error) {
+	tx.Timestamp = tx.Timestamp.UTC()
+	raw, err := json.Marshal(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Going through a generic map sorts the keys, UseNumber keeps int64
+	// amounts from being rounded through float64.
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var fields map[string]any
+	if err := decoder.Decode(&fields); err != nil {
+		return nil, err
+	}
+	delete(fields, "hash")
+	return json.Marshal(fields)
+}
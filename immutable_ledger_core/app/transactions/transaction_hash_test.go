@@ -0,0 +1,96 @@
+package transactions
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/utils"
+)
+
+var hashAlgorithms = []string{utils.HashAlgorithmSHA256, utils.HashAlgorithmSHA3_256, utils.HashAlgorithmBLAKE2b256}
+
+// chainOf appends count movements to a ledger hashed with algorithm and
+// returns its entries.
+func chainOf(t *testing.T, algorithm string, count int) []TransactionModel {
+	t.Helper()
+	db, err := OpenTranasctionDatabase(NewMemoryStorage(), algorithm, utils.GenerateHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range count {
+		dto := movement("cash", "alice", int64(100+i), "USD")
+		dto.Description = "top up"
+		mustCreate(t, db, dto)
+	}
+	return db.Entries()
+}
+
+func TestComputeHashCoversEveryField(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(*TransactionModel)
+	}{
+		{name: "sequence", tamper: func(tx *TransactionModel) { tx.Sequence++ }},
+		{name: "transaction id", tamper: func(tx *TransactionModel) { tx.TransactionId += "x" }},
+		{name: "description", tamper: func(tx *TransactionModel) { tx.Description = "refund" }},
+		{name: "amount", tamper: func(tx *TransactionModel) { tx.Postings[1].Amount++ }},
+		{name: "unit", tamper: func(tx *TransactionModel) { tx.Postings[1].Unit = "EUR" }},
+		{name: "account", tamper: func(tx *TransactionModel) { tx.Postings[1].AccountId = "mallory" }},
+		{name: "direction", tamper: func(tx *TransactionModel) { tx.Postings[0].Direction = DirectionCredit }},
+		{name: "timestamp", tamper: func(tx *TransactionModel) { tx.Timestamp = tx.Timestamp.Add(time.Nanosecond) }},
+		{name: "reversal of", tamper: func(tx *TransactionModel) { tx.ReversalOf = "other" }},
+		{name: "previous hash", tamper: func(tx *TransactionModel) { tx.PreviousHash = "00" + tx.PreviousHash[2:] }},
+	}
+	for _, algorithm := range hashAlgorithms {
+		t.Run(algorithm, func(t *testing.T) {
+			entry := chainOf(t, algorithm, 1)[0]
+			hash, err := ComputeHash(entry, utils.GenerateHash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hash != entry.Hash || entry.HashAlgorithm != algorithm || entry.HashVersion != CurrentHashVersion {
+				t.Fatalf("entry = %+v, want it hashed with %s version %d to %s", entry, algorithm, CurrentHashVersion, hash)
+			}
+			if digest, err := hex.DecodeString(entry.Hash); err != nil || len(digest) != 32 {
+				t.Fatalf("hash %q is not a hex encoded 32 byte digest", entry.Hash)
+			}
+
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					tampered := entry
+					tampered.Postings = append([]Posting(nil), entry.Postings...)
+					tt.tamper(&tampered)
+					hash, err := ComputeHash(tampered, utils.GenerateHash)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if hash == entry.Hash {
+						t.Fatalf("changing the %s left the hash unchanged", tt.name)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestComputeHashFollowsTheRecordedAlgorithm(t *testing.T) {
+	entry := chainOf(t, utils.HashAlgorithmSHA256, 1)[0]
+
+	relabeled := entry
+	relabeled.HashAlgorithm = utils.HashAlgorithmBLAKE2b256
+	if hash, err := ComputeHash(relabeled, utils.GenerateHash); err != nil || hash == entry.Hash {
+		t.Fatalf("ComputeHash() under another algorithm = %q, %v, want a different digest", hash, err)
+	}
+
+	unknownVersion := entry
+	unknownVersion.HashVersion = CurrentHashVersion + 1
+	if _, err := ComputeHash(unknownVersion, utils.GenerateHash); err == nil {
+		t.Fatal("ComputeHash() accepted an unknown hash version")
+	}
+	unknownAlgorithm := entry
+	unknownAlgorithm.HashAlgorithm = "md5"
+	if _, err := ComputeHash(unknownAlgorithm, utils.GenerateHash); err == nil {
+		t.Fatal("ComputeHash() accepted an unknown algorithm")
+	}
+}
@@ -0,0 +1,555 @@
+package transactions
+
+import (
+	"bytes"
+	"container/heap"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"time"
+)
+
+const (
+	HoldActionAuthorize = "authorize"
+	HoldActionCapture   = "capture"
+	HoldActionVoid      = "void"
+	HoldActionExpire    = "expire"
+
+	HoldPending  = "pending"
+	HoldCaptured = "captured"
+	HoldVoided   = "voided"
+	HoldExpired  = "expired"
+)
+
+// DefaultHoldTTL is how long a hold authorized without expires_at lasts.
+const DefaultHoldTTL = 7 * 24 * time.Hour
+
+// HoldRecord is the part of an entry that moves a hold through its life. An
+// authorization, a void or an expiry has no postings; a capture posts the
+// captured amount from the account to the destination and releases the rest.
+// Amount is the amount authorized, captured or released. The record is part
+// of the hashed content, holds are rebuilt from it when the ledger is replayed.
+type HoldRecord struct {
+	HoldId               string     `json:"hold_id"`
+	Action               string     `json:"action"`
+	AccountId            string     `json:"account_id"`
+	DestinationAccountId string     `json:"destination_account_id"`
+	Asset                string     `json:"asset"`
+	Amount               int64      `json:"amount"`
+	ExpiresAt            *time.Time `json:"expires_at,omitempty"`
+}
+
+// Hold reserves an amount of an account for a later capture. While it is
+// pending and not expired the amount is taken off the available balance of
+// the account, the posted balance only changes when it is captured.
+type Hold struct {
+	HoldId               string     `json:"hold_id"`
+	AccountId            string     `json:"account_id"`
+	DestinationAccountId string     `json:"destination_account_id"`
+	Asset                string     `json:"asset"`
+	Amount               int64      `json:"amount"`
+	Captured             int64      `json:"captured"`
+	Status               string     `json:"status"`
+	ExpiresAt            time.Time  `json:"expires_at"`
+	AuthorizedAt         time.Time  `json:"authorized_at"`
+	ClosedAt             *time.Time `json:"closed_at,omitempty"`
+	Sequence             uint64     `json:"sequence"`
+	ClosedSequence       uint64     `json:"closed_sequence,omitempty"`
+	// Entries are the IDs of the ledger entries of the hold, authorization first.
+	Entries []string `json:"entries"`
+}
+
+// heldAt reports whether the hold reserved its amount right after the entry
+// with the given sequence, at time at.
+func (h Hold) heldAt(sequence uint64, at time.Time) bool {
+	return h.Sequence <= sequence && (h.ClosedSequence == 0 || h.ClosedSequence > sequence) && at.Before(h.ExpiresAt)
+}
+
+// HoldDto authorizes a hold. Amount is in minor units or a decimal string,
+// without expires_at the hold lasts DefaultHoldTTL.
+type HoldDto struct {
+	AccountId            string     `json:"account_id" binding:"required"`
+	DestinationAccountId string     `json:"destination_account_id" binding:"required"`
+	Asset                string     `json:"asset" binding:"required"`
+	Amount               int64      `json:"amount"`
+	DecimalAmount        string     `json:"-"`
+	ExpiresAt            *time.Time `json:"expires_at"`
+	Description          string     `json:"description"`
+	// IdempotencyKey comes from the Idempotency-Key header.
+	IdempotencyKey string `json:"-"`
+}
+
+func (dto *HoldDto) UnmarshalJSON(data []byte) error {
+	type plain HoldDto
+	var raw struct {
+		plain
+		Amount json.RawMessage `json:"amount"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*dto = HoldDto(raw.plain)
+	return decodeAmount(raw.Amount, &dto.Amount, &dto.DecimalAmount)
+}
+
+// CaptureDto captures a pending hold. Without an amount the whole hold is
+// captured, a smaller amount captures part of it and releases the rest. An
+// amount of zero is refused rather than read as the whole hold.
+type CaptureDto struct {
+	Amount        *int64 `json:"amount"`
+	DecimalAmount string `json:"-"`
+	Description   string `json:"description"`
+}
+
+func (dto *CaptureDto) UnmarshalJSON(data []byte) error {
+	type plain CaptureDto
+	var raw struct {
+		plain
+		Amount json.RawMessage `json:"amount"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*dto = CaptureDto(raw.plain)
+	var amount int64
+	if err := decodeAmount(raw.Amount, &amount, &dto.DecimalAmount); err != nil {
+		return err
+	}
+	if len(raw.Amount) > 0 && raw.Amount[0] != '"' && !bytes.Equal(raw.Amount, []byte("null")) {
+		dto.Amount = &amount
+	}
+	return nil
+}
+
+type VoidDto struct {
+	Description string `json:"description"`
+}
+
+type HoldFilters struct {
+	AccountId string `form:"account_id"`
+	Status    string `form:"status" binding:"omitempty,oneof=pending captured voided expired"`
+}
+
+// AuthorizeHold appends the authorization of a hold. The balance policy of
+// the account is checked against its available balance under the write lock,
+// like a debit. A retried request with the same idempotency key returns the
+// hold it created with replayed set.
+func AuthorizeHold(holdDto HoldDto, GenerateID func() string, GenerateHash func(string, string) (string, error), transactionDb *TranasctionDatabase) (Hold, bool, error) {
+	if holdDto.DecimalAmount != "" {
+		amount, err := transactionDb.resolveAmount(holdDto.Asset, holdDto.DecimalAmount)
+		if err != nil {
+			return Hold{}, false, err
+		}
+		holdDto.Amount = amount
+	}
+	if holdDto.Amount <= 0 {
+		return Hold{}, false, &TransactionMalformed{
+			Message: "Hold amount must be greater than zero",
+			Code:    http.StatusUnprocessableEntity,
+		}
+	}
+	if holdDto.AccountId == holdDto.DestinationAccountId {
+		return Hold{}, false, &TransactionMalformed{
+			Message: "A hold needs a destination account other than the held account",
+			Code:    http.StatusUnprocessableEntity,
+		}
+	}
+
+	transaction, replayed, err := transactionDb.AppendOnce(holdDto.IdempotencyKey, "", func(link ChainLink) (TransactionModel, error) {
+		expiresAt := link.Timestamp.Add(DefaultHoldTTL)
+		if holdDto.ExpiresAt != nil {
+			expiresAt = holdDto.ExpiresAt.UTC()
+		}
+		if !expiresAt.After(link.Timestamp) {
+			return TransactionModel{}, &TransactionValidationError{
+				Message: "expires_at must be in the future",
+				Code:    http.StatusBadRequest,
+			}
+		}
+		if err := transactionDb.checkPostings(transferPostings(holdDto.AccountId, holdDto.DestinationAccountId, holdDto.Asset, holdDto.Amount), false); err != nil {
+			return TransactionModel{}, err
+		}
+
+		record := &HoldRecord{
+			HoldId:               GenerateID(),
+			Action:               HoldActionAuthorize,
+			AccountId:            holdDto.AccountId,
+			DestinationAccountId: holdDto.DestinationAccountId,
+			Asset:                holdDto.Asset,
+			Amount:               holdDto.Amount,
+			ExpiresAt:            &expiresAt,
+		}
+		description := holdDto.Description
+		if description == "" {
+			description = fmt.Sprintf("Authorization of hold %s", record.HoldId)
+		}
+		return NewTransactionModel(TransactionDto{
+			Description:    description,
+			Postings:       []PostingDto{},
+			IdempotencyKey: holdDto.IdempotencyKey,
+			Hold:           record,
+		}, link, GenerateID, GenerateHash)
+	})
+	if err != nil {
+		return Hold{}, false, err
+	}
+
+	record := transaction.Hold
+	if replayed && (record == nil || record.Action != HoldActionAuthorize || record.AccountId != holdDto.AccountId ||
+		record.DestinationAccountId != holdDto.DestinationAccountId || record.Asset != holdDto.Asset || record.Amount != holdDto.Amount) {
+		return Hold{}, false, &TransactionConflictError{
+			Message: "Idempotency key was already used for a different request",
+			Code:    http.StatusConflict,
+		}
+	}
+	hold, err := transactionDb.GetHold(record.HoldId)
+	return hold, replayed, err
+}
+
+// CaptureHold appends the capture of a pending hold: the captured amount is
+// posted from the account to the destination and the hold is closed.
+func CaptureHold(holdId string, captureDto CaptureDto, GenerateID func() string, GenerateHash func(string, string) (string, error), transactionDb *TranasctionDatabase) (Hold, TransactionModel, error) {
+	if captureDto.DecimalAmount != "" {
+		hold, err := transactionDb.GetHold(holdId)
+		if err != nil {
+			return Hold{}, TransactionModel{}, err
+		}
+		amount, err := transactionDb.resolveAmount(hold.Asset, captureDto.DecimalAmount)
+		if err != nil {
+			return Hold{}, TransactionModel{}, err
+		}
+		captureDto.Amount = &amount
+	}
+
+	transaction, err := transactionDb.Append(func(link ChainLink) (TransactionModel, error) {
+		hold, err := transactionDb.pendingHold(holdId, link.Timestamp)
+		if err != nil {
+			return TransactionModel{}, err
+		}
+		amount := hold.Amount
+		if captureDto.Amount != nil {
+			amount = *captureDto.Amount
+		}
+		if amount <= 0 || amount > hold.Amount {
+			return TransactionModel{}, &TransactionRuleViolationError{
+				Message: fmt.Sprintf("Capture of %d %s must be between 1 and the %d held", amount, hold.Asset, hold.Amount),
+				Code:    http.StatusUnprocessableEntity,
+			}
+		}
+		postings := transferPostings(hold.AccountId, hold.DestinationAccountId, hold.Asset, amount)
+		if err := transactionDb.checkPostings(postings, false); err != nil {
+			return TransactionModel{}, err
+		}
+
+		description := captureDto.Description
+		if description == "" {
+			description = fmt.Sprintf("Capture of hold %s", hold.HoldId)
+		}
+		return NewTransactionModel(TransactionDto{
+			Description: description,
+			Postings:    postings,
+			Hold:        hold.record(HoldActionCapture, amount),
+		}, link, GenerateID, GenerateHash)
+	})
+	if err != nil {
+		return Hold{}, TransactionModel{}, err
+	}
+	hold, err := transactionDb.GetHold(holdId)
+	return hold, transaction, err
+}
+
+// VoidHold appends the release of a pending hold, nothing is posted.
+func VoidHold(holdId string, voidDto VoidDto, GenerateID func() string, GenerateHash func(string, string) (string, error), transactionDb *TranasctionDatabase) (Hold, TransactionModel, error) {
+	transaction, err := transactionDb.Append(func(link ChainLink) (TransactionModel, error) {
+		hold, err := transactionDb.pendingHold(holdId, link.Timestamp)
+		if err != nil {
+			return TransactionModel{}, err
+		}
+		description := voidDto.Description
+		if description == "" {
+			description = fmt.Sprintf("Void of hold %s", hold.HoldId)
+		}
+		return NewTransactionModel(TransactionDto{
+			Description: description,
+			Postings:    []PostingDto{},
+			Hold:        hold.record(HoldActionVoid, hold.Amount),
+		}, link, GenerateID, GenerateHash)
+	})
+	if err != nil {
+		return Hold{}, TransactionModel{}, err
+	}
+	hold, err := transactionDb.GetHold(holdId)
+	return hold, transaction, err
+}
+
+// errNoExpiredHold ends ExpireHolds once every expired hold is recorded.
+var errNoExpiredHold = errors.New("no expired hold")
+
+// ExpireHolds appends an expiry entry for every pending hold past its
+// expires_at, earliest first. An expired hold stops reserving funds at
+// expires_at whether or not its expiry is recorded yet, the entry makes the
+// release visible in the ledger. Each expiry takes the next hold off
+// openHolds, so it costs O(log n) in the number of pending holds.
+func (db *TranasctionDatabase) ExpireHolds(GenerateID func() string, GenerateHash func(string, string) (string, error)) ([]TransactionModel, error) {
+	var expired []TransactionModel
+	for {
+		transaction, err := db.Append(func(link ChainLink) (TransactionModel, error) {
+			expiry, pending := db.openHolds.next()
+			if !pending || expiry.ExpiresAt.After(link.Timestamp) {
+				return TransactionModel{}, errNoExpiredHold
+			}
+			next := db.holds[expiry.HoldId]
+			return NewTransactionModel(TransactionDto{
+				Description: fmt.Sprintf("Expiry of hold %s", next.HoldId),
+				Postings:    []PostingDto{},
+				Hold:        next.record(HoldActionExpire, next.Amount),
+			}, link, GenerateID, GenerateHash)
+		})
+		if errors.Is(err, errNoExpiredHold) {
+			return expired, nil
+		}
+		if err != nil {
+			return expired, err
+		}
+		expired = append(expired, transaction)
+	}
+}
+
+// RunHoldExpiry records the expiry of holds every interval until ctx is done.
+func RunHoldExpiry(ctx context.Context, transactionDb *TranasctionDatabase, interval time.Duration, GenerateID func() string, GenerateHash func(string, string) (string, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := transactionDb.ExpireHolds(GenerateID, GenerateHash); err != nil {
+				log.Printf("hold expiry failed: %v", err)
+			}
+		}
+	}
+}
+
+func (db *TranasctionDatabase) GetHold(holdId string) (Hold, error) {
+	db.mut.RLock()
+	defer db.mut.RUnlock()
+	hold, exists := db.holds[holdId]
+	if !exists {
+		return Hold{}, holdNotFound(holdId)
+	}
+	return hold, nil
+}
+
+// ListHolds returns the matching holds in authorization order.
+func (db *TranasctionDatabase) ListHolds(filters HoldFilters) []Hold {
+	db.mut.RLock()
+	defer db.mut.RUnlock()
+	holds := []Hold{}
+	for _, hold := range db.holds {
+		if (filters.AccountId != "" && hold.AccountId != filters.AccountId) || (filters.Status != "" && hold.Status != filters.Status) {
+			continue
+		}
+		holds = append(holds, hold)
+	}
+	sort.Slice(holds, func(i, j int) bool {
+		return holds[i].Sequence < holds[j].Sequence
+	})
+	return holds
+}
+
+// GetHeldBalances returns, per asset, what the holds of an account reserved
+// right after the entry with the given sequence, at time at: the pending
+// holds authorized by then and the holds closed after it.
+func (db *TranasctionDatabase) GetHeldBalances(accountId string, sequence uint64, at time.Time) map[string]int64 {
+	db.mut.RLock()
+	defer db.mut.RUnlock()
+	held := make(map[string]int64)
+	for holdId := range db.accountHolds[accountId] {
+		if hold := db.holds[holdId]; hold.heldAt(sequence, at) {
+			held[hold.Asset] += hold.Amount
+		}
+	}
+	closed := db.closedHolds[accountId]
+	first := sort.Search(len(closed), func(i int) bool {
+		return db.holds[closed[i]].ClosedSequence > sequence
+	})
+	for _, holdId := range closed[first:] {
+		if hold := db.holds[holdId]; hold.heldAt(sequence, at) {
+			held[hold.Asset] += hold.Amount
+		}
+	}
+	return held
+}
+
+// heldLocked is what the pending holds of an account reserve in an asset at
+// time at, callers must hold the lock.
+func (db *TranasctionDatabase) heldLocked(accountId, asset string, at time.Time) int64 {
+	var held int64
+	for holdId := range db.accountHolds[accountId] {
+		if hold := db.holds[holdId]; hold.Asset == asset && at.Before(hold.ExpiresAt) {
+			held += hold.Amount
+		}
+	}
+	return held
+}
+
+// pendingHold returns a hold that can still be captured or voided at time at,
+// callers must hold the lock.
+func (db *TranasctionDatabase) pendingHold(holdId string, at time.Time) (Hold, error) {
+	hold, exists := db.holds[holdId]
+	if !exists {
+		return Hold{}, holdNotFound(holdId)
+	}
+	if hold.Status != HoldPending {
+		return Hold{}, &TransactionConflictError{
+			Message: fmt.Sprintf("Hold %s is already %s", holdId, hold.Status),
+			Code:    http.StatusConflict,
+		}
+	}
+	if !at.Before(hold.ExpiresAt) {
+		return Hold{}, &TransactionConflictError{
+			Message: fmt.Sprintf("Hold %s expired at %s", holdId, hold.ExpiresAt.Format(time.RFC3339Nano)),
+			Code:    http.StatusConflict,
+		}
+	}
+	return hold, nil
+}
+
+// projectHolds applies the hold record of an entry, callers must hold the
+// write lock.
+func (db *TranasctionDatabase) projectHolds(transaction TransactionModel) {
+	record := transaction.Hold
+	if record == nil {
+		return
+	}
+	if record.Action == HoldActionAuthorize {
+		db.holds[record.HoldId] = Hold{
+			HoldId:               record.HoldId,
+			AccountId:            record.AccountId,
+			DestinationAccountId: record.DestinationAccountId,
+			Asset:                record.Asset,
+			Amount:               record.Amount,
+			Status:               HoldPending,
+			ExpiresAt:            *record.ExpiresAt,
+			AuthorizedAt:         transaction.Timestamp,
+			Sequence:             transaction.Sequence,
+			Entries:              []string{transaction.TransactionId},
+		}
+		if db.accountHolds[record.AccountId] == nil {
+			db.accountHolds[record.AccountId] = make(map[string]struct{})
+		}
+		db.accountHolds[record.AccountId][record.HoldId] = struct{}{}
+		db.openHolds.add(db.holds[record.HoldId])
+		return
+	}
+
+	hold, exists := db.holds[record.HoldId]
+	if !exists || hold.Status != HoldPending {
+		return
+	}
+	switch record.Action {
+	case HoldActionCapture:
+		hold.Status = HoldCaptured
+		hold.Captured = record.Amount
+	case HoldActionVoid:
+		hold.Status = HoldVoided
+	case HoldActionExpire:
+		hold.Status = HoldExpired
+	}
+	closedAt := transaction.Timestamp
+	hold.ClosedAt = &closedAt
+	hold.ClosedSequence = transaction.Sequence
+	hold.Entries = append(slices.Clip(hold.Entries), transaction.TransactionId)
+	db.holds[record.HoldId] = hold
+	db.openHolds.remove(record.HoldId)
+	delete(db.accountHolds[hold.AccountId], record.HoldId)
+	if len(db.accountHolds[hold.AccountId]) == 0 {
+		delete(db.accountHolds, hold.AccountId)
+	}
+	db.closedHolds[hold.AccountId] = append(db.closedHolds[hold.AccountId], record.HoldId)
+}
+
+func (h Hold) record(action string, amount int64) *HoldRecord {
+	return &HoldRecord{
+		HoldId:               h.HoldId,
+		Action:               action,
+		AccountId:            h.AccountId,
+		DestinationAccountId: h.DestinationAccountId,
+		Asset:                h.Asset,
+		Amount:               amount,
+	}
+}
+
+func holdNotFound(holdId string) error {
+	return &TransactionNotFoundError{
+		Message: fmt.Sprintf("Hold %s not found", holdId),
+		Code:    http.StatusNotFound,
+	}
+}
+
+// holdQueue is a min-heap of the pending holds by expires_at. It records the
+// position of every hold, so a hold closed before it expires leaves the heap
+// in O(log n) too.
+type holdQueue struct {
+	entries  []holdExpiry
+	position map[string]int
+}
+
+type holdExpiry struct {
+	HoldId    string
+	ExpiresAt time.Time
+}
+
+func newHoldQueue() *holdQueue {
+	return &holdQueue{position: make(map[string]int)}
+}
+
+// next returns the pending hold that expires first.
+func (q *holdQueue) next() (holdExpiry, bool) {
+	if len(q.entries) == 0 {
+		return holdExpiry{}, false
+	}
+	return q.entries[0], true
+}
+
+func (q *holdQueue) add(hold Hold) {
+	heap.Push(q, holdExpiry{HoldId: hold.HoldId, ExpiresAt: hold.ExpiresAt})
+}
+
+func (q *holdQueue) remove(holdId string) {
+	if i, exists := q.position[holdId]; exists {
+		heap.Remove(q, i)
+	}
+}
+
+func (q *holdQueue) Len() int { return len(q.entries) }
+
+func (q *holdQueue) Less(i, j int) bool {
+	return q.entries[i].ExpiresAt.Before(q.entries[j].ExpiresAt)
+}
+
+func (q *holdQueue) Swap(i, j int) {
+	q.entries[i], q.entries[j] = q.entries[j], q.entries[i]
+	q.position[q.entries[i].HoldId] = i
+	q.position[q.entries[j].HoldId] = j
+}
+
+func (q *holdQueue) Push(x any) {
+	entry := x.(holdExpiry)
+	q.position[entry.HoldId] = len(q.entries)
+	q.entries = append(q.entries, entry)
+}
+
+func (q *holdQueue) Pop() any {
+	last := len(q.entries) - 1
+	entry := q.entries[last]
+	q.entries = q.entries[:last]
+	delete(q.position, entry.HoldId)
+	return entry
+}
@@ -0,0 +1,280 @@
+package transactions
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/utils"
+)
+
+// newHoldDatabase funds alice with 100 USD, in cents, under the no_overdraft
+// policy.
+func newHoldDatabase(t *testing.T) *TranasctionDatabase {
+	t.Helper()
+	db := NewSafeTranasctionDatabase()
+	db.SetAssetResolver(func(asset string) (int, error) { return 2, nil })
+	if err := db.SetBalancePolicy(AccountPolicy{AccountId: "alice", BalancePolicy: BalancePolicy{Type: PolicyNoOverdraft}}); err != nil {
+		t.Fatal(err)
+	}
+	mustCreate(t, db, movement("cash", "alice", 100, "USD"))
+	return db
+}
+
+// mustAuthorize holds amount of alice for shop, failing the test on error.
+func mustAuthorize(t *testing.T, db *TranasctionDatabase, amount int64, expiresAt *time.Time) Hold {
+	t.Helper()
+	hold, _, err := AuthorizeHold(HoldDto{AccountId: "alice", DestinationAccountId: "shop", Asset: "USD", Amount: amount, ExpiresAt: expiresAt}, utils.GenerateID, utils.GenerateHash, db)
+	if err != nil {
+		t.Fatalf("AuthorizeHold: %v", err)
+	}
+	return hold
+}
+
+func captureBody(t *testing.T, body string) CaptureDto {
+	t.Helper()
+	var captureDto CaptureDto
+	if err := json.Unmarshal([]byte(body), &captureDto); err != nil {
+		t.Fatalf("decoding %s: %v", body, err)
+	}
+	return captureDto
+}
+
+func TestHoldLifecycle(t *testing.T) {
+	capture := func(body string) func(*testing.T, *TranasctionDatabase, string) error {
+		return func(t *testing.T, db *TranasctionDatabase, holdId string) error {
+			_, _, err := CaptureHold(holdId, captureBody(t, body), utils.GenerateID, utils.GenerateHash, db)
+			return err
+		}
+	}
+	void := func(t *testing.T, db *TranasctionDatabase, holdId string) error {
+		_, _, err := VoidHold(holdId, VoidDto{}, utils.GenerateID, utils.GenerateHash, db)
+		return err
+	}
+
+	tests := []struct {
+		name string
+		// earlier steps are applied to a hold of 60 before the one under test.
+		earlier []func(*testing.T, *TranasctionDatabase, string) error
+		step    func(*testing.T, *TranasctionDatabase, string) error
+		code    int
+		// status, captured and the balances are the outcome once every step ran.
+		status   string
+		captured int64
+		alice    int64
+		shop     int64
+	}{
+		{name: "capture without an amount", step: capture(`{}`), status: HoldCaptured, captured: 60, alice: 40, shop: 60},
+		{name: "capture with a null amount", step: capture(`{"amount":null}`), status: HoldCaptured, captured: 60, alice: 40, shop: 60},
+		{name: "partial capture", step: capture(`{"amount":25}`), status: HoldCaptured, captured: 25, alice: 75, shop: 25},
+		{name: "partial decimal capture", step: capture(`{"amount":"0.25"}`), status: HoldCaptured, captured: 25, alice: 75, shop: 25},
+		{name: "capture of the whole hold", step: capture(`{"amount":60}`), status: HoldCaptured, captured: 60, alice: 40, shop: 60},
+		{name: "void", step: void, status: HoldVoided, alice: 100},
+		{name: "capture of zero", step: capture(`{"amount":0}`), code: 422, status: HoldPending, alice: 100},
+		{name: "capture of decimal zero", step: capture(`{"amount":"0"}`), code: 422, status: HoldPending, alice: 100},
+		{name: "negative capture", step: capture(`{"amount":-5}`), code: 422, status: HoldPending, alice: 100},
+		{name: "capture over the hold", step: capture(`{"amount":61}`), code: 422, status: HoldPending, alice: 100},
+		{
+			name:    "double capture",
+			earlier: []func(*testing.T, *TranasctionDatabase, string) error{capture(`{"amount":10}`)},
+			step:    capture(`{"amount":10}`),
+			code:    409, status: HoldCaptured, captured: 10, alice: 90, shop: 10,
+		},
+		{
+			name:    "capture after a void",
+			earlier: []func(*testing.T, *TranasctionDatabase, string) error{void},
+			step:    capture(`{}`),
+			code:    409, status: HoldVoided, alice: 100,
+		},
+		{
+			name:    "void after a capture",
+			earlier: []func(*testing.T, *TranasctionDatabase, string) error{capture(`{}`)},
+			step:    void,
+			code:    409, status: HoldCaptured, captured: 60, alice: 40, shop: 60,
+		},
+		{
+			name:    "double void",
+			earlier: []func(*testing.T, *TranasctionDatabase, string) error{void},
+			step:    void,
+			code:    409, status: HoldVoided, alice: 100,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newHoldDatabase(t)
+			hold := mustAuthorize(t, db, 60, nil)
+			for i, step := range tt.earlier {
+				if err := step(t, db, hold.HoldId); err != nil {
+					t.Fatalf("earlier step %d: %v", i, err)
+				}
+			}
+			head := db.Head()
+
+			err := tt.step(t, db, hold.HoldId)
+			if tt.code != 0 {
+				if errorCode(err) != tt.code {
+					t.Fatalf("step = %v, want code %d", err, tt.code)
+				}
+				if db.Head() != head {
+					t.Fatal("a rejected step changed the ledger")
+				}
+			} else if err != nil {
+				t.Fatalf("step = %v", err)
+			}
+
+			hold, _ = db.GetHold(hold.HoldId)
+			if hold.Status != tt.status || hold.Captured != tt.captured {
+				t.Fatalf("hold is %s with %d captured, want %s with %d", hold.Status, hold.Captured, tt.status, tt.captured)
+			}
+			alice, _ := db.GetBalances("alice")
+			shop, _ := db.GetBalances("shop")
+			if alice["USD"] != tt.alice || shop["USD"] != tt.shop {
+				t.Fatalf("alice has %d and shop %d, want %d and %d", alice["USD"], shop["USD"], tt.alice, tt.shop)
+			}
+			var held int64
+			if tt.status == HoldPending {
+				held = 60
+			}
+			if got := db.GetHeldBalances("alice", uint64(db.Head().Size), time.Now())["USD"]; got != held {
+				t.Fatalf("alice has %d held, want %d", got, held)
+			}
+		})
+	}
+}
+
+func TestHoldReservesAvailableBalance(t *testing.T) {
+	db := newHoldDatabase(t)
+	mustAuthorize(t, db, 70, nil)
+
+	if _, _, err := AuthorizeHold(HoldDto{AccountId: "alice", DestinationAccountId: "shop", Asset: "USD", Amount: 31}, utils.GenerateID, utils.GenerateHash, db); errorCode(err) != 422 {
+		t.Fatalf("holding more than is available = %v, want code 422", err)
+	}
+	if _, _, err := CreateTransaction(movement("alice", "bob", 31, "USD"), utils.GenerateID, utils.GenerateHash, db); errorCode(err) != 422 {
+		t.Fatalf("spending held funds = %v, want code 422", err)
+	}
+	mustCreate(t, db, movement("alice", "bob", 30, "USD"))
+}
+
+func TestExpiredHold(t *testing.T) {
+	db := newHoldDatabase(t)
+	expiresAt := time.Now().Add(50 * time.Millisecond)
+	hold := mustAuthorize(t, db, 60, &expiresAt)
+	authorized := uint64(db.Head().Size)
+	time.Sleep(time.Until(expiresAt))
+
+	// Past expires_at the hold reserves nothing, even before its expiry is recorded.
+	head := db.Head()
+	if _, _, err := CaptureHold(hold.HoldId, CaptureDto{}, utils.GenerateID, utils.GenerateHash, db); errorCode(err) != 409 {
+		t.Fatalf("capture after expiry = %v, want code 409", err)
+	}
+	if _, _, err := VoidHold(hold.HoldId, VoidDto{}, utils.GenerateID, utils.GenerateHash, db); errorCode(err) != 409 {
+		t.Fatalf("void after expiry = %v, want code 409", err)
+	}
+	if db.Head() != head {
+		t.Fatal("a rejected step changed the ledger")
+	}
+	mustCreate(t, db, movement("alice", "bob", 100, "USD"))
+
+	expired, err := db.ExpireHolds(utils.GenerateID, utils.GenerateHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expired) != 1 || expired[0].Hold == nil || expired[0].Hold.HoldId != hold.HoldId {
+		t.Fatalf("ExpireHolds() = %+v, want the expiry of %s", expired, hold.HoldId)
+	}
+	if expired, _ := db.ExpireHolds(utils.GenerateID, utils.GenerateHash); len(expired) != 0 {
+		t.Fatalf("second ExpireHolds() recorded %d expiries", len(expired))
+	}
+	hold, _ = db.GetHold(hold.HoldId)
+	if hold.Status != HoldExpired || hold.ClosedSequence != expired[0].Sequence {
+		t.Fatalf("hold is %s closed at %d, want expired at %d", hold.Status, hold.ClosedSequence, expired[0].Sequence)
+	}
+	if _, _, err := CaptureHold(hold.HoldId, CaptureDto{}, utils.GenerateID, utils.GenerateHash, db); errorCode(err) != 409 {
+		t.Fatalf("capture of an expired hold = %v, want code 409", err)
+	}
+	if held := db.GetHeldBalances("alice", authorized, hold.AuthorizedAt)["USD"]; held != 60 {
+		t.Fatalf("held when authorized = %d, want 60", held)
+	}
+}
+
+func TestClosedHoldsLeaveTheAccountIndex(t *testing.T) {
+	db := newHoldDatabase(t)
+	captured := mustAuthorize(t, db, 30, nil)
+	voided := mustAuthorize(t, db, 20, nil)
+	pending := mustAuthorize(t, db, 10, nil)
+	authorized := uint64(db.Head().Size)
+	at := time.Now()
+
+	if _, _, err := CaptureHold(captured.HoldId, CaptureDto{}, utils.GenerateID, utils.GenerateHash, db); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := VoidHold(voided.HoldId, VoidDto{}, utils.GenerateID, utils.GenerateHash, db); err != nil {
+		t.Fatal(err)
+	}
+
+	if open := db.accountHolds["alice"]; len(open) != 1 {
+		t.Fatalf("alice indexes %d open holds, want only %s", len(open), pending.HoldId)
+	}
+	if _, _, err := VoidHold(pending.HoldId, VoidDto{}, utils.GenerateID, utils.GenerateHash, db); err != nil {
+		t.Fatal(err)
+	}
+	if _, indexed := db.accountHolds["alice"]; indexed {
+		t.Fatal("alice is still indexed without an open hold")
+	}
+
+	// Held balances in the past still see the holds closed since.
+	tests := []struct {
+		sequence uint64
+		held     int64
+	}{
+		{authorized - 3, 0},
+		{authorized - 2, 30},
+		{authorized, 60},
+		{authorized + 1, 30},
+		{authorized + 2, 10},
+		{authorized + 3, 0},
+	}
+	for _, tt := range tests {
+		if got := db.GetHeldBalances("alice", tt.sequence, at)["USD"]; got != tt.held {
+			t.Fatalf("held after entry %d = %d, want %d", tt.sequence, got, tt.held)
+		}
+	}
+}
+
+func TestExpireHoldsInExpiryOrder(t *testing.T) {
+	db := newHoldDatabase(t)
+	now := time.Now()
+	expiresAt := func(offset time.Duration) *time.Time {
+		at := now.Add(offset)
+		return &at
+	}
+	// Authorized out of expiry order, one of them voided before it expires
+	// and one that outlives the test.
+	third := mustAuthorize(t, db, 1, expiresAt(250*time.Millisecond))
+	first := mustAuthorize(t, db, 1, expiresAt(100*time.Millisecond))
+	later := mustAuthorize(t, db, 1, expiresAt(time.Hour))
+	voided := mustAuthorize(t, db, 1, expiresAt(150*time.Millisecond))
+	second := mustAuthorize(t, db, 1, expiresAt(200*time.Millisecond))
+	if _, _, err := VoidHold(voided.HoldId, VoidDto{}, utils.GenerateID, utils.GenerateHash, db); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Until(now.Add(250 * time.Millisecond)))
+
+	expired, err := db.ExpireHolds(utils.GenerateID, utils.GenerateHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{first.HoldId, second.HoldId, third.HoldId}
+	if len(expired) != len(want) {
+		t.Fatalf("ExpireHolds() recorded %d expiries, want %d", len(expired), len(want))
+	}
+	for i, transaction := range expired {
+		if transaction.Hold.HoldId != want[i] {
+			t.Fatalf("expiry %d is of %s, want %s", i, transaction.Hold.HoldId, want[i])
+		}
+	}
+	if expiry, pending := db.openHolds.next(); !pending || expiry.HoldId != later.HoldId || db.openHolds.Len() != 1 {
+		t.Fatalf("open holds = %+v, want only %s", db.openHolds.entries, later.HoldId)
+	}
+}
@@ -1,42 +1,214 @@
 package transactions
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"time"
 )
 
+const (
+	DirectionDebit  = "debit"
+	DirectionCredit = "credit"
+)
+
+// Posting is a single leg of a journal entry. Amount is always positive, the
+// Direction says whether it is taken from (debit) or added to (credit) the account.
+type Posting struct {
+	AccountId string `json:"account_id"`
+	Direction string `json:"direction"`
+	Amount    int64  `json:"amount"`
+	Unit      string `json:"unit"`
+}
+
+// Delta returns the signed effect of the posting on the account balance.
+func (p Posting) Delta() int64 {
+	if p.Direction == DirectionDebit {
+		return -p.Amount
+	}
+	return p.Amount
+}
+
 type TransactionModel struct {
-	TransactionId string    `json:"transaction_id"`
-	AccountId     string    `json:"account_id"`
-	Amount        int64     `json:"amount"`
-	Timestamp     time.Time `json:"timestamp"`
-	Asset         AssetType `json:"asset"`
-	Hash          string    `json:"hash"`
-	PreviousHash  string    `json:"previous_hash"`
+	Sequence       uint64      `json:"sequence,omitempty"`
+	TransactionId  string      `json:"transaction_id"`
+	Description    string      `json:"description,omitempty"`
+	Postings       []Posting   `json:"postings"`
+	Timestamp      time.Time   `json:"timestamp"`
+	IdempotencyKey string      `json:"idempotency_key,omitempty"`
+	RequestHash    string      `json:"request_hash,omitempty"`
+	ReversalOf     string      `json:"reversal_of,omitempty"`
+	Hold           *HoldRecord `json:"hold,omitempty"`
+	TransferId     string      `json:"transfer_id,omitempty"`
+	HashAlgorithm  string      `json:"hash_algorithm"`
+	HashVersion    int         `json:"hash_version"`
+	Hash           string      `json:"hash"`
+	PreviousHash   string      `json:"previous_hash"`
+}
+
+// HasAccount reports whether the entry posts to the account or changes a
+// hold on it.
+func (tx TransactionModel) HasAccount(accountId string) bool {
+	for _, posting := range tx.Postings {
+		if posting.AccountId == accountId {
+			return true
+		}
+	}
+	return tx.Hold != nil && tx.Hold.AccountId == accountId
+}
+
+func (tx TransactionModel) HasUnit(unit string) bool {
+	for _, posting := range tx.Postings {
+		if posting.Unit == unit {
+			return true
+		}
+	}
+	return tx.Hold != nil && tx.Hold.Asset == unit
+}
+
+// PostingDto accepts amount either as an integer of minor units or as a
+// decimal string ("12.34"), which is kept in DecimalAmount until it is
+// converted with the scale of the asset.
+type PostingDto struct {
+	AccountId     string `json:"account_id" binding:"required"`
+	Direction     string `json:"direction" binding:"required"`
+	Amount        int64  `json:"amount"`
+	DecimalAmount string `json:"-"`
+	Unit          string `json:"unit" binding:"required"`
+}
+
+func (p *PostingDto) UnmarshalJSON(data []byte) error {
+	type plain PostingDto
+	var raw struct {
+		plain
+		Amount json.RawMessage `json:"amount"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*p = PostingDto(raw.plain)
+	return decodeAmount(raw.Amount, &p.Amount, &p.DecimalAmount)
+}
+
+// decodeAmount reads an amount sent either as an integer of minor units or as
+// a decimal string, which is left in decimal for the asset scale to convert.
+func decodeAmount(raw json.RawMessage, amount *int64, decimal *string) error {
+	switch {
+	case len(raw) == 0 || bytes.Equal(raw, []byte("null")):
+	case raw[0] == '"':
+		if err := json.Unmarshal(raw, decimal); err != nil {
+			return err
+		}
+	default:
+		if err := json.Unmarshal(raw, amount); err != nil {
+			return errors.New("amount must be an integer number of minor units or a decimal string")
+		}
+	}
+	return nil
+}
+
+func (p PostingDto) toPosting() Posting {
+	return Posting{
+		AccountId: p.AccountId,
+		Direction: p.Direction,
+		Amount:    p.Amount,
+		Unit:      p.Unit,
+	}
 }
 
 type TransactionDto struct {
-	AccountId string `json:"account_id" binding:"required"`
-	Amount    int64  `json:"amount" binding:"required"`
-	Unit      string `json:"unit" binding:"required"`
+	// TransactionId is optional, a client that picks its own ID can retry with it
+	// the same way as with an idempotency key.
+	TransactionId string       `json:"transaction_id" binding:"max=128"`
+	Description   string       `json:"description"`
+	Postings      []PostingDto `json:"postings" binding:"required,dive"`
+	// IdempotencyKey comes from the Idempotency-Key header.
+	IdempotencyKey string `json:"-"`
+	// ReversalOf is set by the server on compensating entries.
+	ReversalOf string `json:"-"`
+	// Hold is set by the server on the entries of a hold.
+	Hold *HoldRecord `json:"-"`
+	// TransferId is set by the server on the entry of a transfer.
+	TransferId string `json:"-"`
+	// RequestHash is set by the server when the entry is derived from another
+	// request, like a reversal, whose fingerprint retries are matched against.
+	RequestHash string `json:"-"`
 }
 
-type AssetType struct {
-	Unit   string `json:"unit"`
-	Amount int64  `json:"amount"`
+// Fingerprint identifies the request body, a retry must produce the same one.
+func (dto TransactionDto) Fingerprint(hashAlgorithm string, GenerateHash func(string, string) (string, error)) (string, error) {
+	body, err := json.Marshal(dto)
+	if err != nil {
+		return "", err
+	}
+	return GenerateHash(hashAlgorithm, string(body))
 }
 
-func NewTransactionModel(transactionProperties TransactionDto, previousHash string, GenerateID func() string, GenerateHash func(string) string) TransactionModel {
+// ChainLink is the position the next entry takes in the chain, handed out by
+// the database under its write lock.
+type ChainLink struct {
+	Sequence      uint64
+	PreviousHash  string
+	Timestamp     time.Time
+	HashAlgorithm string
+}
 
-	hashInput := transactionProperties.AccountId + previousHash
-	return TransactionModel{
-		TransactionId: GenerateID(),
-		AccountId:     transactionProperties.AccountId,
-		Amount:        transactionProperties.Amount,
-		Asset:         AssetType{Unit: transactionProperties.Unit, Amount: transactionProperties.Amount},
-		Timestamp:     time.Now().UTC(),
-		Hash:          GenerateHash(hashInput),
-		PreviousHash:  previousHash,
+func NewTransactionModel(transactionProperties TransactionDto, link ChainLink, GenerateID func() string, GenerateHash func(string, string) (string, error)) (TransactionModel, error) {
+
+	postings := make([]Posting, 0, len(transactionProperties.Postings))
+	for _, leg := range transactionProperties.Postings {
+		postings = append(postings, leg.toPosting())
 	}
+
+	transactionId := transactionProperties.TransactionId
+	if transactionId == "" {
+		transactionId = GenerateID()
+	}
+
+	transaction := TransactionModel{
+		Sequence:       link.Sequence,
+		TransactionId:  transactionId,
+		Description:    transactionProperties.Description,
+		Postings:       postings,
+		Timestamp:      link.Timestamp,
+		IdempotencyKey: transactionProperties.IdempotencyKey,
+		ReversalOf:     transactionProperties.ReversalOf,
+		Hold:           transactionProperties.Hold,
+		TransferId:     transactionProperties.TransferId,
+		HashAlgorithm:  link.HashAlgorithm,
+		HashVersion:    CurrentHashVersion,
+		PreviousHash:   link.PreviousHash,
+	}
+	if transactionProperties.RequestHash != "" {
+		transaction.RequestHash = transactionProperties.RequestHash
+	} else if transactionProperties.IdempotencyKey != "" || transactionProperties.TransactionId != "" {
+		requestHash, err := transactionProperties.Fingerprint(link.HashAlgorithm, GenerateHash)
+		if err != nil {
+			return TransactionModel{}, err
+		}
+		transaction.RequestHash = requestHash
+	}
+	hash, err := ComputeHash(transaction, GenerateHash)
+	if err != nil {
+		return TransactionModel{}, err
+	}
+	transaction.Hash = hash
+	return transaction, nil
+}
+
+// TransactionView is an entry as returned by single-transaction reads, with the
+// links that were established after it was appended.
+type TransactionView struct {
+	TransactionModel
+	ReversedBy []string `json:"reversed_by,omitempty"`
+}
+
+// LedgerHead describes the tip of the ledger: how many entries it holds, the
+// hash of the last one and the Merkle root over all of them (hex).
+type LedgerHead struct {
+	Size     int    `json:"size"`
+	LastHash string `json:"last_hash"`
+	Root     string `json:"root"`
 }
 
 type LedgerFilters struct {
@@ -44,5 +216,10 @@ type LedgerFilters struct {
 	AssetType     *string    `form:"asset_type" json:"asset_type,omitempty" `
 	FromTimestamp *time.Time `form:"from_timestamp" json:"from_timestamp,omitempty" `
 	ToTimestamp   *time.Time `form:"to_timestamp" json:"to_timestamp,omitempty" `
-	Limit         *int       `form:"limit" json:"limit,omitempty" `
+	Limit         *int       `form:"limit" json:"limit,omitempty" binding:"omitempty,min=1"`
+	AfterSequence *uint64    `form:"after_sequence" json:"after_sequence,omitempty" `
+	// Cursor is the next_cursor of the previous page, Order is "asc" (oldest
+	// first, the default) or "desc".
+	Cursor string `form:"cursor" json:"cursor,omitempty"`
+	Order  string `form:"order" json:"order,omitempty" binding:"omitempty,oneof=asc desc"`
 }
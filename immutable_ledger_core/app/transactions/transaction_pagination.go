@@ -0,0 +1,151 @@
+package transactions
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	OrderAsc  = "asc"
+	OrderDesc = "desc"
+
+	DefaultPageSize = 100
+	MaxPageSize     = 1000
+
+	cursorVersion = "v1"
+)
+
+// LedgerPage is one page of entries in sequence order. NextCursor is empty on
+// the last page.
+type LedgerPage struct {
+	Transactions []TransactionView `json:"transactions"`
+	NextCursor   string            `json:"next_cursor,omitempty"`
+	Order        string            `json:"order"`
+	Limit        int               `json:"limit"`
+}
+
+// The cursor is the order and the sequence of the last entry of the page. It
+// is opaque to clients so its encoding can change with the version prefix.
+func encodeCursor(order string, sequence uint64) string {
+	raw := fmt.Sprintf("%s:%s:%d", cursorVersion, order, sequence)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string, order string) (uint64, error) {
+	invalid := &TransactionValidationError{
+		Message: "Invalid cursor",
+		Code:    http.StatusBadRequest,
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, invalid
+	}
+	parts := strings.Split(string(raw), ":")
+	if len(parts) != 3 || parts[0] != cursorVersion {
+		return 0, invalid
+	}
+	if parts[1] != order {
+		return 0, &TransactionValidationError{
+			Message: fmt.Sprintf("Cursor was issued for order %q, keep the same order while paging", parts[1]),
+			Code:    http.StatusBadRequest,
+		}
+	}
+	sequence, err := strconv.ParseUint(parts[2], 10, 64)
+	if err != nil {
+		return 0, invalid
+	}
+	return sequence, nil
+}
+
+// GetAllTransactions returns a page of the entries matching filters. Entries
+// are ordered by sequence, which never changes once assigned, so a cursor keeps
+// pointing at the same place while the ledger grows.
+func (db *TranasctionDatabase) GetAllTransactions(filters LedgerFilters) (LedgerPage, error) {
+	order := filters.Order
+	if order == "" {
+		order = OrderAsc
+	}
+	limit := DefaultPageSize
+	if filters.Limit != nil {
+		limit = *filters.Limit
+	}
+	if limit < 1 || limit > MaxPageSize {
+		return LedgerPage{}, &TransactionValidationError{
+			Message: fmt.Sprintf("limit must be between 1 and %d", MaxPageSize),
+			Code:    http.StatusBadRequest,
+		}
+	}
+	if filters.Cursor != "" && filters.AfterSequence != nil {
+		return LedgerPage{}, &TransactionValidationError{
+			Message: "cursor and after_sequence cannot be used together",
+			Code:    http.StatusBadRequest,
+		}
+	}
+	if filters.AfterSequence != nil && order != OrderAsc {
+		return LedgerPage{}, &TransactionValidationError{
+			Message: "after_sequence only applies to ascending order, use cursor instead",
+			Code:    http.StatusBadRequest,
+		}
+	}
+
+	// position is the sequence the page resumes after, 0 for the first page.
+	var position uint64
+	if filters.AfterSequence != nil {
+		position = *filters.AfterSequence
+	}
+	if filters.Cursor != "" {
+		sequence, err := decodeCursor(filters.Cursor, order)
+		if err != nil {
+			return LedgerPage{}, err
+		}
+		position = sequence
+	}
+
+	db.mut.RLock()
+	defer db.mut.RUnlock()
+
+	page := LedgerPage{
+		Transactions: []TransactionView{},
+		Order:        order,
+		Limit:        limit,
+	}
+	visit := func(transaction TransactionModel) bool {
+		if !match(transaction, filters) {
+			return true
+		}
+		if len(page.Transactions) == limit {
+			last := page.Transactions[limit-1]
+			page.NextCursor = encodeCursor(order, last.Sequence)
+			return false
+		}
+		page.Transactions = append(page.Transactions, TransactionView{
+			TransactionModel: transaction,
+			ReversedBy:       slices.Clone(db.reversals[transaction.TransactionId]),
+		})
+		return true
+	}
+
+	size := uint64(len(db.entries))
+	if order == OrderAsc {
+		for i := min(position, size); i < size; i++ {
+			if !visit(db.entries[i]) {
+				break
+			}
+		}
+	} else {
+		end := size
+		if position > 0 {
+			end = min(position-1, size)
+		}
+		for i := end; i > 0; i-- {
+			if !visit(db.entries[i-1]) {
+				break
+			}
+		}
+	}
+	return page, nil
+}
@@ -0,0 +1,144 @@
+package transactions
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// pageThrough follows next_cursor until the last page and returns the
+// sequences seen, in order. grow is called after every page.
+func pageThrough(t *testing.T, db *TranasctionDatabase, filters LedgerFilters, grow func()) []uint64 {
+	t.Helper()
+	var sequences []uint64
+	for pages := 0; ; pages++ {
+		if pages > 100 {
+			t.Fatal("paging did not end")
+		}
+		page, err := db.GetAllTransactions(filters)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Transactions) > *filters.Limit {
+			t.Fatalf("page has %d entries, limit is %d", len(page.Transactions), *filters.Limit)
+		}
+		for _, transaction := range page.Transactions {
+			sequences = append(sequences, transaction.Sequence)
+		}
+		if page.NextCursor == "" {
+			return sequences
+		}
+		filters.Cursor = page.NextCursor
+		if grow != nil {
+			grow()
+		}
+	}
+}
+
+func TestCursorPaging(t *testing.T) {
+	db := NewSafeTranasctionDatabase()
+	var all, alice []uint64
+	for i := range 25 {
+		account := "bob"
+		if i%3 == 0 {
+			account = "alice"
+		}
+		transaction := mustCreate(t, db, movement("cash", account, int64(i+1), "USD"))
+		all = append(all, transaction.Sequence)
+		if account == "alice" {
+			alice = append(alice, transaction.Sequence)
+		}
+	}
+	reversed := func(sequences []uint64) []uint64 {
+		sequences = slices.Clone(sequences)
+		slices.Reverse(sequences)
+		return sequences
+	}
+	aliceId := "alice"
+
+	tests := []struct {
+		name    string
+		order   string
+		account *string
+		want    []uint64
+	}{
+		{name: "ascending", order: OrderAsc, want: all},
+		{name: "default order", want: all},
+		{name: "descending", order: OrderDesc, want: reversed(all)},
+		{name: "ascending filtered", order: OrderAsc, account: &aliceId, want: alice},
+		{name: "descending filtered", order: OrderDesc, account: &aliceId, want: reversed(alice)},
+	}
+	for _, tt := range tests {
+		for _, limit := range []int{1, 4, 9, 25, 30} {
+			t.Run(fmt.Sprintf("%s/limit %d", tt.name, limit), func(t *testing.T) {
+				got := pageThrough(t, db, LedgerFilters{Order: tt.order, AccountId: tt.account, Limit: &limit}, nil)
+				if !slices.Equal(got, tt.want) {
+					t.Fatalf("paged %v, want %v", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestCursorPagingWhileTheLedgerGrows(t *testing.T) {
+	db := NewSafeTranasctionDatabase()
+	for i := range 10 {
+		mustCreate(t, db, movement("cash", "alice", int64(i+1), "USD"))
+	}
+	limit := 3
+	grow := func() { mustCreate(t, db, movement("cash", "bob", 1, "USD")) }
+
+	// Ascending pages reach the entries appended meanwhile, each once.
+	got := pageThrough(t, db, LedgerFilters{Order: OrderAsc, Limit: &limit}, grow)
+	for i, sequence := range got {
+		if sequence != uint64(i+1) {
+			t.Fatalf("ascending paging saw %v, want every sequence once in order", got)
+		}
+	}
+
+	// Descending pages stay behind the first one, new entries do not shift them.
+	size := uint64(db.Head().Size)
+	got = pageThrough(t, db, LedgerFilters{Order: OrderDesc, Limit: &limit}, grow)
+	if uint64(len(got)) != size {
+		t.Fatalf("descending paging saw %d entries, want the %d present when it started", len(got), size)
+	}
+	for i, sequence := range got {
+		if sequence != size-uint64(i) {
+			t.Fatalf("descending paging saw %v, want %d down to 1", got, size)
+		}
+	}
+}
+
+func TestCursorPagingRefuses(t *testing.T) {
+	db := NewSafeTranasctionDatabase()
+	for i := range 5 {
+		mustCreate(t, db, movement("cash", "alice", int64(i+1), "USD"))
+	}
+	two := 2
+	page, err := db.GetAllTransactions(LedgerFilters{Limit: &two})
+	if err != nil {
+		t.Fatal(err)
+	}
+	zero, tooMany := 0, MaxPageSize+1
+	after := uint64(1)
+
+	tests := []struct {
+		name    string
+		filters LedgerFilters
+	}{
+		{name: "cursor of the other order", filters: LedgerFilters{Order: OrderDesc, Cursor: page.NextCursor}},
+		{name: "garbage cursor", filters: LedgerFilters{Cursor: "not-a-cursor"}},
+		{name: "cursor of another version", filters: LedgerFilters{Cursor: "djA6YXNjOng"}},
+		{name: "zero limit", filters: LedgerFilters{Limit: &zero}},
+		{name: "limit above the maximum", filters: LedgerFilters{Limit: &tooMany}},
+		{name: "cursor and after_sequence", filters: LedgerFilters{Cursor: page.NextCursor, AfterSequence: &after}},
+		{name: "after_sequence descending", filters: LedgerFilters{Order: OrderDesc, AfterSequence: &after}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := db.GetAllTransactions(tt.filters); errorCode(err) != 400 {
+				t.Fatalf("GetAllTransactions() = %v, want code 400", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package transactions
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/utils"
+)
+
+const (
+	PolicyNoOverdraft = "no_overdraft"
+	PolicyCreditLimit = "credit_limit"
+	PolicyUnlimited   = "unlimited"
+)
+
+// BalancePolicy bounds how far debits can take a balance. no_overdraft keeps it
+// at zero or above, credit_limit allows it down to -CreditLimit and unlimited,
+// meant for system accounts such as cash or fees, does not bound it.
+type BalancePolicy struct {
+	Type        string `json:"type"`
+	CreditLimit int64  `json:"credit_limit,omitempty"`
+}
+
+func (p BalancePolicy) Validate() error {
+	switch p.Type {
+	case PolicyNoOverdraft, PolicyUnlimited:
+		if p.CreditLimit != 0 {
+			return &TransactionValidationError{
+				Message: fmt.Sprintf("credit_limit only applies to the %s policy", PolicyCreditLimit),
+				Code:    http.StatusBadRequest,
+			}
+		}
+	case PolicyCreditLimit:
+		if p.CreditLimit < 0 {
+			return &TransactionValidationError{
+				Message: "credit_limit cannot be negative",
+				Code:    http.StatusBadRequest,
+			}
+		}
+	default:
+		return &TransactionValidationError{
+			Message: fmt.Sprintf("Unknown balance policy %q", p.Type),
+			Code:    http.StatusBadRequest,
+		}
+	}
+	return nil
+}
+
+// floor is the lowest balance the policy allows, bounded is false for unlimited.
+func (p BalancePolicy) floor() (floor int64, bounded bool) {
+	switch p.Type {
+	case PolicyUnlimited:
+		return 0, false
+	case PolicyCreditLimit:
+		return -p.CreditLimit, true
+	default:
+		return 0, true
+	}
+}
+
+// AccountPolicy assigns a policy to an account. Without an asset it covers every
+// asset of the account that has no policy of its own.
+type AccountPolicy struct {
+	AccountId string `json:"account_id"`
+	Asset     string `json:"asset,omitempty"`
+	BalancePolicy
+}
+
+// BalanceBreach describes the debit that a policy rejected. Held is what
+// pending holds reserve, Available is how much could still be debited,
+// negative when the balance is already past it.
+type BalanceBreach struct {
+	AccountId string        `json:"account_id"`
+	Asset     string        `json:"asset"`
+	Policy    BalancePolicy `json:"policy"`
+	Balance   int64         `json:"balance"`
+	Held      int64         `json:"held"`
+	Available int64         `json:"available"`
+	Requested int64         `json:"requested"`
+}
+
+// SetDefaultBalancePolicy sets the policy of accounts and assets without one.
+func (db *TranasctionDatabase) SetDefaultBalancePolicy(policy BalancePolicy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	db.mut.Lock()
+	defer db.mut.Unlock()
+	db.defaultPolicy = policy
+	return nil
+}
+
+func (rule AccountPolicy) Validate() error {
+	if rule.AccountId == "" {
+		return &TransactionValidationError{
+			Message: "account_id is required",
+			Code:    http.StatusBadRequest,
+		}
+	}
+	return rule.BalancePolicy.Validate()
+}
+
+// SetBalancePolicy assigns a policy to an account or to one of its assets. It
+// takes the write lock, so it never changes under a running append.
+func (db *TranasctionDatabase) SetBalancePolicy(rule AccountPolicy) error {
+	if err := rule.Validate(); err != nil {
+		return err
+	}
+	db.mut.Lock()
+	defer db.mut.Unlock()
+	if db.policies[rule.AccountId] == nil {
+		db.policies[rule.AccountId] = make(map[string]BalancePolicy)
+	}
+	db.policies[rule.AccountId][rule.Asset] = rule.BalancePolicy
+	return nil
+}
+
+// BalancePolicies lists the policies assigned to accounts, ordered by account and asset.
+func (db *TranasctionDatabase) BalancePolicies() []AccountPolicy {
+	db.mut.RLock()
+	defer db.mut.RUnlock()
+	var rules []AccountPolicy
+	for accountId, assets := range db.policies {
+		for asset, policy := range assets {
+			rules = append(rules, AccountPolicy{AccountId: accountId, Asset: asset, BalancePolicy: policy})
+		}
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].AccountId != rules[j].AccountId {
+			return rules[i].AccountId < rules[j].AccountId
+		}
+		return rules[i].Asset < rules[j].Asset
+	})
+	return rules
+}
+
+// ResolveBalancePolicy returns the policy that applies to an account and asset.
+func (db *TranasctionDatabase) ResolveBalancePolicy(accountId, asset string) BalancePolicy {
+	db.mut.RLock()
+	defer db.mut.RUnlock()
+	return db.resolvePolicy(accountId, asset)
+}
+
+func (db *TranasctionDatabase) resolvePolicy(accountId, asset string) BalancePolicy {
+	if policy, exists := db.policies[accountId][asset]; exists {
+		return policy
+	}
+	if policy, exists := db.policies[accountId][""]; exists {
+		return policy
+	}
+	return db.defaultPolicy
+}
+
+// checkBalancePolicies rejects a transaction whose debits would take the
+// available balance, the posted balance less what pending holds reserve,
+// below what its policy allows. An authorization lowers the available balance
+// like a debit, a capture releases its hold as it posts. Only accounts whose
+// available balance the transaction lowers are checked, a credit is always
+// accepted unless the balance would no longer fit in an int64. Callers must
+// hold the write lock.
+func (db *TranasctionDatabase) checkBalancePolicies(transaction TransactionModel) error {
+	return db.checkBalancePoliciesAfter(transaction, nil)
+}
+
+// balanceKey identifies the balance of an account in an asset.
+type balanceKey struct {
+	AccountId string
+	Asset     string
+}
+
+// checkBalancePoliciesAfter is checkBalancePolicies on top of pending, the
+// balance changes of entries built before the transaction but not stored yet.
+func (db *TranasctionDatabase) checkBalancePoliciesAfter(transaction TransactionModel, pending map[balanceKey]int64) error {
+	deltas := make(map[balanceKey]int64)
+	var order []balanceKey
+	add := func(key balanceKey, delta int64) {
+		if _, exists := deltas[key]; !exists {
+			order = append(order, key)
+		}
+		deltas[key] += delta
+	}
+	for _, posting := range transaction.Postings {
+		add(balanceKey{AccountId: posting.AccountId, Asset: posting.Unit}, posting.Delta())
+	}
+	if record := transaction.Hold; record != nil {
+		key := balanceKey{AccountId: record.AccountId, Asset: record.Asset}
+		if record.Action == HoldActionAuthorize {
+			add(key, -record.Amount)
+		} else {
+			add(key, db.holds[record.HoldId].Amount)
+		}
+	}
+
+	for _, key := range order {
+		delta := deltas[key]
+		balance := db.balances[key.AccountId][key.Asset] + pending[key]
+		if _, ok := utils.AddMinorUnits(balance, delta); !ok {
+			return &TransactionValidationError{
+				Message: fmt.Sprintf("Balance of %s in %s would overflow", key.AccountId, key.Asset),
+				Code:    http.StatusUnprocessableEntity,
+			}
+		}
+		if delta >= 0 {
+			continue
+		}
+		policy := db.resolvePolicy(key.AccountId, key.Asset)
+		floor, bounded := policy.floor()
+		if !bounded {
+			continue
+		}
+		held := db.heldLocked(key.AccountId, key.Asset, transaction.Timestamp)
+		if balance-held+delta >= floor {
+			continue
+		}
+		breach := BalanceBreach{
+			AccountId: key.AccountId,
+			Asset:     key.Asset,
+			Policy:    policy,
+			Balance:   balance,
+			Held:      held,
+			Available: balance - held - floor,
+			Requested: -delta,
+		}
+		return &TransactionRuleViolationError{
+			Message: fmt.Sprintf("Debit of %d %s on %s exceeds the available balance of %d (%s policy)", breach.Requested, breach.Asset, breach.AccountId, breach.Available, policy.Type),
+			Code:    http.StatusUnprocessableEntity,
+			Details: breach,
+		}
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package transactions
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// ReversalDto describes a compensating entry. Without postings or amount the
+// whole remaining amount of the original is reversed. Amount is a shortcut for
+// originals with one debit and one credit leg in a single asset; postings give
+// full control for partial reversals of multi-leg entries.
+type ReversalDto struct {
+	Description string       `json:"description"`
+	Amount      *int64       `json:"amount"`
+	Postings    []PostingDto `json:"postings" binding:"omitempty,dive"`
+	// IdempotencyKey comes from the Idempotency-Key header.
+	IdempotencyKey string `json:"-"`
+}
+
+// Fingerprint identifies the reversal request for an original, a retry must
+// produce the same one. The postings of a reversal depend on what was left to
+// reverse when it was appended, so the request is hashed rather than them.
+func (dto ReversalDto) Fingerprint(originalId string, hashAlgorithm string, GenerateHash func(string, string) (string, error)) (string, error) {
+	body, err := json.Marshal(struct {
+		OriginalId string `json:"original_id"`
+		ReversalDto
+	}{originalId, dto})
+	if err != nil {
+		return "", err
+	}
+	return GenerateHash(hashAlgorithm, string(body))
+}
+
+type legKey struct {
+	AccountId string
+	Unit      string
+	Direction string
+}
+
+func oppositeDirection(direction string) string {
+	if direction == DirectionDebit {
+		return DirectionCredit
+	}
+	return DirectionDebit
+}
+
+// ReverseTransaction appends an entry that undoes all or part of an original
+// one and links to it. The amounts still open per leg are computed under the
+// write lock, so concurrent reversals cannot reverse more than the original.
+// A retried request with the same idempotency key returns the reversal it
+// appended with replayed set.
+func ReverseTransaction(originalId string, reversalDto ReversalDto, GenerateID func() string, GenerateHash func(string, string) (string, error), transactionDb *TranasctionDatabase) (TransactionModel, bool, error) {
+	if err := transactionDb.ResolveAmounts(reversalDto.Postings); err != nil {
+		return TransactionModel{}, false, err
+	}
+	transaction, replayed, err := transactionDb.AppendOnce(reversalDto.IdempotencyKey, "", func(link ChainLink) (TransactionModel, error) {
+		original, exists := transactionDb.store[originalId]
+		if !exists {
+			return TransactionModel{}, &TransactionNotFoundError{
+				Message: "Transaction not found",
+				Code:    http.StatusNotFound,
+			}
+		}
+		if original.ReversalOf != "" {
+			return TransactionModel{}, &TransactionRuleViolationError{
+				Message: "A reversal cannot be reversed, post a new transaction instead",
+				Code:    http.StatusUnprocessableEntity,
+			}
+		}
+		if original.Hold != nil && original.Hold.Action != HoldActionCapture {
+			return TransactionModel{}, &TransactionRuleViolationError{
+				Message: "Only the capture of a hold can be reversed, void a pending hold instead",
+				Code:    http.StatusUnprocessableEntity,
+			}
+		}
+
+		remaining, order := transactionDb.remainingLegs(original)
+		postings, err := reversalPostings(original, reversalDto, remaining, order)
+		if err != nil {
+			return TransactionModel{}, err
+		}
+		if err := transactionDb.checkPostings(postings, true); err != nil {
+			return TransactionModel{}, err
+		}
+
+		var requestHash string
+		if reversalDto.IdempotencyKey != "" {
+			if requestHash, err = reversalDto.Fingerprint(originalId, link.HashAlgorithm, GenerateHash); err != nil {
+				return TransactionModel{}, err
+			}
+		}
+		description := reversalDto.Description
+		if description == "" {
+			description = fmt.Sprintf("Reversal of %s", original.TransactionId)
+		}
+		return NewTransactionModel(TransactionDto{
+			Description:    description,
+			Postings:       postings,
+			IdempotencyKey: reversalDto.IdempotencyKey,
+			ReversalOf:     original.TransactionId,
+			RequestHash:    requestHash,
+		}, link, GenerateID, GenerateHash)
+	})
+	if err != nil || !replayed {
+		return transaction, false, err
+	}
+
+	requestHash, err := reversalDto.Fingerprint(originalId, transaction.HashAlgorithm, GenerateHash)
+	if err != nil {
+		return TransactionModel{}, false, err
+	}
+	if transaction.ReversalOf != originalId || transaction.RequestHash != requestHash {
+		return TransactionModel{}, false, &TransactionConflictError{
+			Message: "Idempotency key was already used for a different request",
+			Code:    http.StatusConflict,
+		}
+	}
+	return transaction, true, nil
+}
+
+// remainingLegs returns, per leg of the original, the amount that has not been
+// reversed yet. Callers must hold the lock.
+func (db *TranasctionDatabase) remainingLegs(original TransactionModel) (map[legKey]int64, []legKey) {
+	remaining := make(map[legKey]int64)
+	var order []legKey
+	for _, posting := range original.Postings {
+		key := legKey{AccountId: posting.AccountId, Unit: posting.Unit, Direction: posting.Direction}
+		if _, exists := remaining[key]; !exists {
+			order = append(order, key)
+		}
+		remaining[key] += posting.Amount
+	}
+	for _, reversalId := range db.reversals[original.TransactionId] {
+		for _, posting := range db.store[reversalId].Postings {
+			key := legKey{AccountId: posting.AccountId, Unit: posting.Unit, Direction: oppositeDirection(posting.Direction)}
+			remaining[key] -= posting.Amount
+		}
+	}
+	return remaining, order
+}
+
+func reversalPostings(original TransactionModel, reversalDto ReversalDto, remaining map[legKey]int64, order []legKey) ([]PostingDto, error) {
+	var postings []PostingDto
+	switch {
+	case len(reversalDto.Postings) > 0:
+		postings = reversalDto.Postings
+
+	case reversalDto.Amount != nil:
+		if len(order) != 2 || order[0].Unit != order[1].Unit || order[0].Direction == order[1].Direction {
+			return nil, &TransactionMalformed{
+				Message: "amount can only be used for transactions with one debit and one credit leg, send postings instead",
+				Code:    http.StatusUnprocessableEntity,
+			}
+		}
+		for _, key := range order {
+			postings = append(postings, PostingDto{
+				AccountId: key.AccountId,
+				Direction: oppositeDirection(key.Direction),
+				Amount:    *reversalDto.Amount,
+				Unit:      key.Unit,
+			})
+		}
+
+	default:
+		for _, key := range order {
+			if remaining[key] == 0 {
+				continue
+			}
+			postings = append(postings, PostingDto{
+				AccountId: key.AccountId,
+				Direction: oppositeDirection(key.Direction),
+				Amount:    remaining[key],
+				Unit:      key.Unit,
+			})
+		}
+		if len(postings) == 0 {
+			return nil, &TransactionConflictError{
+				Message: fmt.Sprintf("Transaction %s is already fully reversed", original.TransactionId),
+				Code:    http.StatusConflict,
+			}
+		}
+	}
+
+	if err := validatePostings(postings); err != nil {
+		return nil, err
+	}
+
+	requested := make(map[legKey]int64)
+	for _, posting := range postings {
+		key := legKey{AccountId: posting.AccountId, Unit: posting.Unit, Direction: oppositeDirection(posting.Direction)}
+		requested[key] += posting.Amount
+	}
+	for key, amount := range requested {
+		if amount > remaining[key] {
+			return nil, &TransactionRuleViolationError{
+				Message: fmt.Sprintf("Reversal of %d %s on %s exceeds the %d left to reverse", amount, key.Unit, key.AccountId, remaining[key]),
+				Code:    http.StatusUnprocessableEntity,
+			}
+		}
+	}
+	return postings, nil
+}
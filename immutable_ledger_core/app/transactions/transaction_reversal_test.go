@@ -0,0 +1,292 @@
+package transactions
+
+import (
+	"testing"
+
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/utils"
+)
+
+func TestReverseTransaction(t *testing.T) {
+	amount := func(value int64) *int64 {
+		return &value
+	}
+	split := TransactionDto{Postings: []PostingDto{
+		debit("cash", 100, "USD"),
+		credit("alice", 60, "USD"),
+		credit("bob", 40, "USD"),
+	}}
+
+	tests := []struct {
+		name     string
+		original TransactionDto
+		// earlier reversals are applied before the one under test.
+		earlier  []ReversalDto
+		reversal ReversalDto
+		code     int
+		// replayed is set when the reversal is a retry of the last earlier one.
+		replayed bool
+		// postings is what the reversal posts when it is accepted.
+		postings []Posting
+	}{
+		{
+			name:     "full",
+			original: movement("cash", "alice", 100, "USD"),
+			reversal: ReversalDto{},
+			postings: []Posting{
+				{AccountId: "cash", Direction: DirectionCredit, Amount: 100, Unit: "USD"},
+				{AccountId: "alice", Direction: DirectionDebit, Amount: 100, Unit: "USD"},
+			},
+		},
+		{
+			name:     "partial amount",
+			original: movement("cash", "alice", 100, "USD"),
+			reversal: ReversalDto{Amount: amount(30)},
+			postings: []Posting{
+				{AccountId: "cash", Direction: DirectionCredit, Amount: 30, Unit: "USD"},
+				{AccountId: "alice", Direction: DirectionDebit, Amount: 30, Unit: "USD"},
+			},
+		},
+		{
+			name:     "full after a partial one reverses the rest",
+			original: movement("cash", "alice", 100, "USD"),
+			earlier:  []ReversalDto{{Amount: amount(30)}},
+			reversal: ReversalDto{},
+			postings: []Posting{
+				{AccountId: "cash", Direction: DirectionCredit, Amount: 70, Unit: "USD"},
+				{AccountId: "alice", Direction: DirectionDebit, Amount: 70, Unit: "USD"},
+			},
+		},
+		{
+			name:     "amount exactly what is left",
+			original: movement("cash", "alice", 100, "USD"),
+			earlier:  []ReversalDto{{Amount: amount(30)}, {Amount: amount(50)}},
+			reversal: ReversalDto{Amount: amount(20)},
+			postings: []Posting{
+				{AccountId: "cash", Direction: DirectionCredit, Amount: 20, Unit: "USD"},
+				{AccountId: "alice", Direction: DirectionDebit, Amount: 20, Unit: "USD"},
+			},
+		},
+		{
+			name:     "retry with the same key",
+			original: movement("cash", "alice", 100, "USD"),
+			earlier:  []ReversalDto{{Amount: amount(30), IdempotencyKey: "key"}},
+			reversal: ReversalDto{Amount: amount(30), IdempotencyKey: "key"},
+			replayed: true,
+			postings: []Posting{
+				{AccountId: "cash", Direction: DirectionCredit, Amount: 30, Unit: "USD"},
+				{AccountId: "alice", Direction: DirectionDebit, Amount: 30, Unit: "USD"},
+			},
+		},
+		{
+			name:     "retry of a full reversal with the same key",
+			original: movement("cash", "alice", 100, "USD"),
+			earlier:  []ReversalDto{{IdempotencyKey: "key"}},
+			reversal: ReversalDto{IdempotencyKey: "key"},
+			replayed: true,
+			postings: []Posting{
+				{AccountId: "cash", Direction: DirectionCredit, Amount: 100, Unit: "USD"},
+				{AccountId: "alice", Direction: DirectionDebit, Amount: 100, Unit: "USD"},
+			},
+		},
+		{
+			name:     "same key with another amount",
+			original: movement("cash", "alice", 100, "USD"),
+			earlier:  []ReversalDto{{Amount: amount(30), IdempotencyKey: "key"}},
+			reversal: ReversalDto{Amount: amount(40), IdempotencyKey: "key"},
+			code:     409,
+		},
+		{
+			name:     "another key reverses again",
+			original: movement("cash", "alice", 100, "USD"),
+			earlier:  []ReversalDto{{Amount: amount(30), IdempotencyKey: "key"}},
+			reversal: ReversalDto{Amount: amount(30), IdempotencyKey: "other"},
+			postings: []Posting{
+				{AccountId: "cash", Direction: DirectionCredit, Amount: 30, Unit: "USD"},
+				{AccountId: "alice", Direction: DirectionDebit, Amount: 30, Unit: "USD"},
+			},
+		},
+		{
+			name:     "amount over the original",
+			original: movement("cash", "alice", 100, "USD"),
+			reversal: ReversalDto{Amount: amount(101)},
+			code:     422,
+		},
+		{
+			name:     "amount over what is left",
+			original: movement("cash", "alice", 100, "USD"),
+			earlier:  []ReversalDto{{Amount: amount(60)}},
+			reversal: ReversalDto{Amount: amount(41)},
+			code:     422,
+		},
+		{
+			name:     "full twice",
+			original: movement("cash", "alice", 100, "USD"),
+			earlier:  []ReversalDto{{}},
+			reversal: ReversalDto{},
+			code:     409,
+		},
+		{
+			name:     "amount after a full one",
+			original: movement("cash", "alice", 100, "USD"),
+			earlier:  []ReversalDto{{}},
+			reversal: ReversalDto{Amount: amount(1)},
+			code:     422,
+		},
+		{
+			name:     "postings on one leg of a split",
+			original: split,
+			reversal: ReversalDto{Postings: []PostingDto{credit("cash", 40, "USD"), debit("bob", 40, "USD")}},
+			postings: []Posting{
+				{AccountId: "cash", Direction: DirectionCredit, Amount: 40, Unit: "USD"},
+				{AccountId: "bob", Direction: DirectionDebit, Amount: 40, Unit: "USD"},
+			},
+		},
+		{
+			name:     "postings over a leg of a split",
+			original: split,
+			reversal: ReversalDto{Postings: []PostingDto{credit("cash", 41, "USD"), debit("bob", 41, "USD")}},
+			code:     422,
+		},
+		{
+			name:     "postings over a leg already partly reversed",
+			original: split,
+			earlier:  []ReversalDto{{Postings: []PostingDto{credit("cash", 30, "USD"), debit("alice", 30, "USD")}}},
+			reversal: ReversalDto{Postings: []PostingDto{credit("cash", 31, "USD"), debit("alice", 31, "USD")}},
+			code:     422,
+		},
+		{
+			name:     "postings on an account the original does not touch",
+			original: split,
+			reversal: ReversalDto{Postings: []PostingDto{credit("cash", 10, "USD"), debit("carol", 10, "USD")}},
+			code:     422,
+		},
+		{
+			name:     "postings in the same direction as the original",
+			original: movement("cash", "alice", 100, "USD"),
+			reversal: ReversalDto{Postings: []PostingDto{debit("cash", 10, "USD"), credit("alice", 10, "USD")}},
+			code:     422,
+		},
+		{
+			name:     "unbalanced postings",
+			original: split,
+			reversal: ReversalDto{Postings: []PostingDto{credit("cash", 40, "USD"), debit("bob", 30, "USD")}},
+			code:     422,
+		},
+		{
+			name:     "amount on a multi-leg entry",
+			original: split,
+			reversal: ReversalDto{Amount: amount(10)},
+			code:     422,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := NewSafeTranasctionDatabase()
+			original := mustCreate(t, db, tt.original)
+			var last TransactionModel
+			for i, earlier := range tt.earlier {
+				var err error
+				if last, _, err = ReverseTransaction(original.TransactionId, earlier, utils.GenerateID, utils.GenerateHash, db); err != nil {
+					t.Fatalf("earlier reversal %d: %v", i, err)
+				}
+			}
+			head := db.Head()
+
+			reversal, replayed, err := ReverseTransaction(original.TransactionId, tt.reversal, utils.GenerateID, utils.GenerateHash, db)
+			if tt.code != 0 {
+				if errorCode(err) != tt.code {
+					t.Fatalf("ReverseTransaction() = %v, want code %d", err, tt.code)
+				}
+				if db.Head() != head {
+					t.Fatal("a rejected reversal changed the ledger")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReverseTransaction() = %v", err)
+			}
+			if replayed != tt.replayed {
+				t.Fatalf("replayed = %v, want %v", replayed, tt.replayed)
+			}
+			if tt.replayed && (reversal.TransactionId != last.TransactionId || db.Head() != head) {
+				t.Fatalf("retry appended %s instead of returning %s", reversal.TransactionId, last.TransactionId)
+			}
+			if reversal.ReversalOf != original.TransactionId {
+				t.Fatalf("reversal_of = %q, want %q", reversal.ReversalOf, original.TransactionId)
+			}
+			if len(reversal.Postings) != len(tt.postings) {
+				t.Fatalf("postings = %+v, want %+v", reversal.Postings, tt.postings)
+			}
+			for i := range tt.postings {
+				if reversal.Postings[i] != tt.postings[i] {
+					t.Fatalf("postings = %+v, want %+v", reversal.Postings, tt.postings)
+				}
+			}
+			reversals := len(tt.earlier) + 1
+			if tt.replayed {
+				reversals--
+			}
+			view, _ := db.GetView(original.TransactionId)
+			if len(view.ReversedBy) != reversals || view.ReversedBy[reversals-1] != reversal.TransactionId {
+				t.Fatalf("reversed_by = %v, want %d reversals ending with %s", view.ReversedBy, reversals, reversal.TransactionId)
+			}
+		})
+	}
+}
+
+func TestReverseTransactionRejectsReversals(t *testing.T) {
+	db := NewSafeTranasctionDatabase()
+	original := mustCreate(t, db, movement("cash", "alice", 100, "USD"))
+	reversal, _, err := ReverseTransaction(original.TransactionId, ReversalDto{}, utils.GenerateID, utils.GenerateHash, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := ReverseTransaction(reversal.TransactionId, ReversalDto{}, utils.GenerateID, utils.GenerateHash, db); errorCode(err) != 422 {
+		t.Fatalf("reversing a reversal = %v, want code 422", err)
+	}
+	if _, _, err := ReverseTransaction("unknown", ReversalDto{}, utils.GenerateID, utils.GenerateHash, db); errorCode(err) != 404 {
+		t.Fatalf("reversing an unknown transaction = %v, want code 404", err)
+	}
+	if size := db.Head().Size; size != 2 {
+		t.Fatalf("ledger holds %d entries, want 2", size)
+	}
+}
+
+func TestReverseTransactionKeyBelongsToOneRequest(t *testing.T) {
+	db := NewSafeTranasctionDatabase()
+	keyed := movement("cash", "alice", 100, "USD")
+	keyed.IdempotencyKey = "key"
+	original := mustCreate(t, db, keyed)
+	other := mustCreate(t, db, movement("cash", "bob", 100, "USD"))
+
+	// The key of the original transaction cannot replay as its reversal.
+	if _, _, err := ReverseTransaction(original.TransactionId, ReversalDto{IdempotencyKey: "key"}, utils.GenerateID, utils.GenerateHash, db); errorCode(err) != 409 {
+		t.Fatalf("reversal with the key of a transaction = %v, want code 409", err)
+	}
+	if _, _, err := ReverseTransaction(original.TransactionId, ReversalDto{IdempotencyKey: "reversal"}, utils.GenerateID, utils.GenerateHash, db); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ReverseTransaction(other.TransactionId, ReversalDto{IdempotencyKey: "reversal"}, utils.GenerateID, utils.GenerateHash, db); errorCode(err) != 409 {
+		t.Fatalf("reversal of another original with the same key = %v, want code 409", err)
+	}
+	if size := db.Head().Size; size != 3 {
+		t.Fatalf("ledger holds %d entries, want 3", size)
+	}
+}
+
+func TestReverseTransactionChecksPostings(t *testing.T) {
+	db := NewSafeTranasctionDatabase()
+	original := mustCreate(t, db, movement("cash", "alice", 100, "EUR"))
+	db.SetAssetResolver(func(asset string) (int, error) {
+		return 0, &TransactionRuleViolationError{Message: asset + " is disabled", Code: 422}
+	})
+
+	if _, _, err := ReverseTransaction(original.TransactionId, ReversalDto{}, utils.GenerateID, utils.GenerateHash, db); errorCode(err) != 422 {
+		t.Fatalf("reversal in a disabled asset = %v, want code 422", err)
+	}
+	if size := db.Head().Size; size != 1 {
+		t.Fatalf("ledger holds %d entries, want 1", size)
+	}
+}
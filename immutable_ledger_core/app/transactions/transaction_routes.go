@@ -7,7 +7,40 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func CreateTransactionHandler(transactionDb *TranasctionDatabase, GenerateID func() string, GenerateHash func(string) string) gin.HandlerFunc {
+// WriteError answers with the code of a TransactionError, anything else is an
+// internal error whose details are not exposed.
+func WriteError(c *gin.Context, err error) {
+	var transErr TransactionError
+	if errors.As(err, &transErr) {
+		body := gin.H{
+			"error": transErr.Error(),
+		}
+		var detailed interface{ GetDetails() any }
+		if errors.As(err, &detailed) && detailed.GetDetails() != nil {
+			body["details"] = detailed.GetDetails()
+		}
+		c.JSON(transErr.GetCode(), body)
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error": "Internal server error",
+	})
+}
+
+// idempotencyKeyHeader reads the Idempotency-Key header of a write request. An
+// oversized key is answered with 400 and ok is false.
+func idempotencyKeyHeader(c *gin.Context) (string, bool) {
+	idempotencyKey := c.GetHeader("Idempotency-Key")
+	if len(idempotencyKey) > 255 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Idempotency-Key must be at most 255 characters",
+		})
+		return "", false
+	}
+	return idempotencyKey, true
+}
+
+func CreateTransactionHandler(transactionDb *TranasctionDatabase, GenerateID func() string, GenerateHash func(string, string) (string, error)) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var transactionDto TransactionDto
 
@@ -18,44 +51,329 @@ func CreateTransactionHandler(transactionDb *TranasctionDatabase, GenerateID fun
 			return
 		}
 
-		err := CreateTransaction(transactionDto, GenerateID, GenerateHash, transactionDb)
+		idempotencyKey, ok := idempotencyKeyHeader(c)
+		if !ok {
+			return
+		}
+		transactionDto.IdempotencyKey = idempotencyKey
+
+		transaction, replayed, err := CreateTransaction(transactionDto, GenerateID, GenerateHash, transactionDb)
 		if err != nil {
-			var transErr TransactionError
-			if errors.As(err, &transErr) {
-				c.JSON(transErr.GetCode(), gin.H{
-					"error": transErr.Error(),
+			WriteError(c, err)
+			return
+		}
+		if replayed {
+			c.Header("Idempotent-Replayed", "true")
+			c.JSON(http.StatusOK, gin.H{
+				"message":     "Transaction already created",
+				"transaction": transaction,
+			})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{
+			"message":     "Transaction created",
+			"transaction": transaction,
+		})
+	}
+
+}
+
+func ListAllTransactions(transactionDb *TranasctionDatabase) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var filters LedgerFilters
+		if err := c.ShouldBindQuery(&filters); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		page, err := transactionDb.GetAllTransactions(filters)
+		if err != nil {
+			WriteError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, page)
+	}
+
+}
+
+func ValidateTransactionHandler(transactionDb *TranasctionDatabase, GenerateHash func(string, string) (string, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report := ValidateTransactions(transactionDb, GenerateHash)
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+func GetTransactionHandler(transactionDb *TranasctionDatabase) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		transaction, exists := transactionDb.GetView(c.Param("id"))
+		if !exists {
+			WriteError(c, &TransactionNotFoundError{
+				Message: "Transaction not found",
+				Code:    http.StatusNotFound,
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"transaction": transaction,
+		})
+	}
+}
+
+func ReverseTransactionHandler(transactionDb *TranasctionDatabase, GenerateID func() string, GenerateHash func(string, string) (string, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var reversalDto ReversalDto
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&reversalDto); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": err.Error(),
 				})
 				return
 			}
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": "Internal server error",
+		}
+
+		idempotencyKey, ok := idempotencyKeyHeader(c)
+		if !ok {
+			return
+		}
+		reversalDto.IdempotencyKey = idempotencyKey
+
+		originalId := c.Param("id")
+		reversal, replayed, err := ReverseTransaction(originalId, reversalDto, GenerateID, GenerateHash, transactionDb)
+		if err != nil {
+			WriteError(c, err)
+			return
+		}
+		original, _ := transactionDb.GetView(originalId)
+		if replayed {
+			c.Header("Idempotent-Replayed", "true")
+			c.JSON(http.StatusOK, gin.H{
+				"message":     "Transaction already reversed",
+				"transaction": reversal,
+				"original":    original,
 			})
 			return
 		}
 		c.JSON(http.StatusCreated, gin.H{
-			"message": "Transaction created",
+			"message":     "Transaction reversed",
+			"transaction": reversal,
+			"original":    original,
 		})
 	}
+}
+
+func AuthorizeHoldHandler(transactionDb *TranasctionDatabase, GenerateID func() string, GenerateHash func(string, string) (string, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var holdDto HoldDto
+		if err := c.BindJSON(&holdDto); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
 
+		idempotencyKey, ok := idempotencyKeyHeader(c)
+		if !ok {
+			return
+		}
+		holdDto.IdempotencyKey = idempotencyKey
+
+		hold, replayed, err := AuthorizeHold(holdDto, GenerateID, GenerateHash, transactionDb)
+		if err != nil {
+			WriteError(c, err)
+			return
+		}
+		if replayed {
+			c.Header("Idempotent-Replayed", "true")
+			c.JSON(http.StatusOK, gin.H{
+				"message": "Hold already authorized",
+				"hold":    hold,
+			})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{
+			"message": "Hold authorized",
+			"hold":    hold,
+		})
+	}
 }
 
-func ListAllTransactions(transactionDb *TranasctionDatabase) gin.HandlerFunc {
+func ListHoldsHandler(transactionDb *TranasctionDatabase) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		transactions := transactionDb.store
+		var filters HoldFilters
+		if err := c.ShouldBindQuery(&filters); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
 		c.JSON(http.StatusOK, gin.H{
-			"transactions": transactions,
+			"holds": transactionDb.ListHolds(filters),
 		})
 	}
+}
+
+func GetHoldHandler(transactionDb *TranasctionDatabase) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		hold, err := transactionDb.GetHold(c.Param("hold_id"))
+		if err != nil {
+			WriteError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"hold": hold,
+		})
+	}
+}
+
+func CaptureHoldHandler(transactionDb *TranasctionDatabase, GenerateID func() string, GenerateHash func(string, string) (string, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var captureDto CaptureDto
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&captureDto); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": err.Error(),
+				})
+				return
+			}
+		}
+
+		hold, transaction, err := CaptureHold(c.Param("hold_id"), captureDto, GenerateID, GenerateHash, transactionDb)
+		if err != nil {
+			WriteError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{
+			"message":     "Hold captured",
+			"hold":        hold,
+			"transaction": transaction,
+		})
+	}
+}
 
+func VoidHoldHandler(transactionDb *TranasctionDatabase, GenerateID func() string, GenerateHash func(string, string) (string, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var voidDto VoidDto
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&voidDto); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": err.Error(),
+				})
+				return
+			}
+		}
+
+		hold, transaction, err := VoidHold(c.Param("hold_id"), voidDto, GenerateID, GenerateHash, transactionDb)
+		if err != nil {
+			WriteError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{
+			"message":     "Hold voided",
+			"hold":        hold,
+			"transaction": transaction,
+		})
+	}
 }
 
-func ValidateTransactionHandler(transactionDb *TranasctionDatabase) gin.HandlerFunc {
+func CreateTransactionBatchHandler(transactionDb *TranasctionDatabase, GenerateID func() string, GenerateHash func(string, string) (string, error)) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		hash := ValidateTransactions(transactionDb)
-		validity := hash != nil
+		var batchDto BatchDto
+		if err := c.BindJSON(&batchDto); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		idempotencyKey, ok := idempotencyKeyHeader(c)
+		if !ok {
+			return
+		}
+		batchDto.IdempotencyKey = idempotencyKey
+
+		result, replayed, err := CreateTransactionBatch(batchDto, GenerateID, GenerateHash, transactionDb)
+		var itemErr *BatchItemError
+		if errors.As(err, &itemErr) {
+			code := http.StatusInternalServerError
+			var transErr TransactionError
+			if errors.As(err, &transErr) {
+				code = transErr.GetCode()
+			}
+			c.JSON(code, gin.H{
+				"error":   err.Error(),
+				"results": result.Results,
+				"head":    result.Head,
+			})
+			return
+		}
+		if err != nil {
+			WriteError(c, err)
+			return
+		}
+		if replayed {
+			c.Header("Idempotent-Replayed", "true")
+			c.JSON(http.StatusOK, gin.H{
+				"message": "Batch already created",
+				"results": result.Results,
+				"head":    result.Head,
+			})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{
+			"message": "Batch created",
+			"results": result.Results,
+			"head":    result.Head,
+		})
+	}
+}
+
+func CreateTransferHandler(transactionDb *TranasctionDatabase, GenerateID func() string, GenerateHash func(string, string) (string, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var transferDto TransferDto
+		if err := c.BindJSON(&transferDto); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		idempotencyKey, ok := idempotencyKeyHeader(c)
+		if !ok {
+			return
+		}
+		transferDto.IdempotencyKey = idempotencyKey
+
+		transfer, replayed, err := CreateTransfer(transferDto, GenerateID, GenerateHash, transactionDb)
+		if err != nil {
+			WriteError(c, err)
+			return
+		}
+		if replayed {
+			c.Header("Idempotent-Replayed", "true")
+			c.JSON(http.StatusOK, gin.H{
+				"message":  "Transfer already created",
+				"transfer": transfer,
+			})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{
+			"message":  "Transfer created",
+			"transfer": transfer,
+		})
+	}
+}
+
+func GetTransferHandler(transactionDb *TranasctionDatabase) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		transfer, err := transactionDb.GetTransfer(c.Param("transfer_id"))
+		if err != nil {
+			WriteError(c, err)
+			return
+		}
 		c.JSON(http.StatusOK, gin.H{
-			"last_hash": hash,
-			"valid":     validity,
+			"transfer": transfer,
 		})
 	}
 }
@@ -1,62 +1,114 @@
 package transactions
 
 import (
-	"maps"
+	"fmt"
+	"math"
 	"net/http"
-	"slices"
-	"sort"
+
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/utils"
 )
 
-func CreateTransaction(transactionDto TransactionDto, GenerateID func() string, GenerateHash func(string) string, transactionDb *TranasctionDatabase) error {
+// CreateTransaction appends a journal entry. A request carrying an idempotency
+// key or its own transaction ID that was already accepted returns the original
+// entry with replayed set; reusing them for a different body is a conflict.
+func CreateTransaction(transactionDto TransactionDto, GenerateID func() string, GenerateHash func(string, string) (string, error), transactionDb *TranasctionDatabase) (TransactionModel, bool, error) {
 
-	if transactionDto.Amount == 0 {
-		return &TransactionMalformed{
-			Message: "Transaction amount cannot be zero",
-			Code:    http.StatusUnprocessableEntity,
-		}
+	if err := transactionDb.ResolveAmounts(transactionDto.Postings); err != nil {
+		return TransactionModel{}, false, err
 	}
-
-	previousHash := transactionDb.lastHash
-
-	if previousHash == "echochain" && len(transactionDb.store) == 0 {
-		previousHash = GenerateHash(previousHash + transactionDto.AccountId)
+	if err := validatePostings(transactionDto.Postings); err != nil {
+		return TransactionModel{}, false, err
 	}
 
-	if previousHash == "echochain" && len(transactionDb.store) > 0 {
-		return &TransactionRuleViolationError{
-			Message: "Cannot create transaction: previous hash does not match the last transaction's hash",
-			Code:    http.StatusInternalServerError,
+	transaction, replayed, err := transactionDb.AppendOnce(transactionDto.IdempotencyKey, transactionDto.TransactionId, func(link ChainLink) (TransactionModel, error) {
+		if err := transactionDb.checkPostings(transactionDto.Postings, false); err != nil {
+			return TransactionModel{}, err
 		}
+		return NewTransactionModel(transactionDto, link, GenerateID, GenerateHash)
+	})
+	if err != nil || !replayed {
+		return transaction, false, err
 	}
 
-	transactionModel := NewTransactionModel(transactionDto, previousHash, GenerateID, GenerateHash)
-	if _, exists := transactionDb.Get(transactionModel.TransactionId); exists {
-		return &TransactionConflictError{
-			Message: "Transaction with the same ID already exists",
+	requestHash, err := transactionDto.Fingerprint(transaction.HashAlgorithm, GenerateHash)
+	if err != nil {
+		return TransactionModel{}, false, err
+	}
+	if transaction.RequestHash != requestHash || transaction.IdempotencyKey != transactionDto.IdempotencyKey {
+		return TransactionModel{}, false, &TransactionConflictError{
+			Message: "Idempotency key or transaction ID was already used for a different request",
 			Code:    http.StatusConflict,
 		}
 	}
-	transactionDb.Set(transactionModel.TransactionId, transactionModel)
-	return nil
+	return transaction, true, nil
 }
 
-func ValidateTransactions(transactionDb *TranasctionDatabase) *string {
-	vals := slices.Collect(maps.Values(transactionDb.store))
-	sort.Slice(vals, func(i, j int) bool {
-		a := vals[i]
-		b := vals[j]
-		return a.Timestamp.Before(b.Timestamp)
-	})
+// validatePostings enforces the double-entry invariant: a journal entry needs at
+// least one debit and one credit, and its legs must net to zero for every asset.
+// Debits and credits are totalled apart, a total that does not fit in an int64
+// is refused rather than wrapped.
+func validatePostings(postings []PostingDto) error {
+	if len(postings) < 2 {
+		return &TransactionMalformed{
+			Message: "Transaction needs at least two postings",
+			Code:    http.StatusUnprocessableEntity,
+		}
+	}
 
-	for idx, transaction := range vals {
-		if idx == 0 {
-			continue
+	debits := make(map[string]int64)
+	credits := make(map[string]int64)
+	var units []string
+	for _, posting := range postings {
+		if posting.Amount <= 0 {
+			return &TransactionMalformed{
+				Message: "Posting amount must be greater than zero",
+				Code:    http.StatusUnprocessableEntity,
+			}
+		}
+		totals := credits
+		switch posting.Direction {
+		case DirectionDebit:
+			totals = debits
+		case DirectionCredit:
+		default:
+			return &TransactionMalformed{
+				Message: fmt.Sprintf("Posting direction must be %q or %q", DirectionDebit, DirectionCredit),
+				Code:    http.StatusUnprocessableEntity,
+			}
 		}
-		prevTransaction := vals[idx-1]
-		if transaction.PreviousHash != prevTransaction.Hash {
-			return nil
+		if _, seen := debits[posting.Unit]; !seen {
+			if _, seen := credits[posting.Unit]; !seen {
+				units = append(units, posting.Unit)
+			}
 		}
+		total, ok := utils.AddMinorUnits(totals[posting.Unit], posting.Amount)
+		if !ok {
+			return &TransactionValidationError{
+				Message: fmt.Sprintf("Postings for %s add up to more than %d", posting.Unit, int64(math.MaxInt64)),
+				Code:    http.StatusUnprocessableEntity,
+			}
+		}
+		totals[posting.Unit] = total
 	}
-	lastHash := vals[len(vals)-1].Hash
-	return &lastHash
+
+	if len(debits) == 0 || len(credits) == 0 {
+		return &TransactionMalformed{
+			Message: "Transaction needs at least one debit and one credit",
+			Code:    http.StatusUnprocessableEntity,
+		}
+	}
+	for _, unit := range units {
+		if debits[unit] != credits[unit] {
+			return &TransactionValidationError{
+				Message: fmt.Sprintf("Postings for %s do not balance: debits total %d and credits total %d", unit, debits[unit], credits[unit]),
+				Code:    http.StatusUnprocessableEntity,
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateTransactions re-verifies the whole chain and reports where it breaks.
+func ValidateTransactions(transactionDb *TranasctionDatabase, GenerateHash func(string, string) (string, error)) VerificationReport {
+	return VerifyEntries(transactionDb.Entries(), GenerateHash)
 }
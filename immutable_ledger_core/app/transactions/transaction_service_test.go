@@ -0,0 +1,162 @@
+package transactions
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/utils"
+)
+
+func debit(account string, amount int64, unit string) PostingDto {
+	return PostingDto{AccountId: account, Direction: DirectionDebit, Amount: amount, Unit: unit}
+}
+
+func credit(account string, amount int64, unit string) PostingDto {
+	return PostingDto{AccountId: account, Direction: DirectionCredit, Amount: amount, Unit: unit}
+}
+
+// movement is a transaction moving amount of unit from one account to another.
+func movement(from, to string, amount int64, unit string) TransactionDto {
+	return TransactionDto{Postings: []PostingDto{debit(from, amount, unit), credit(to, amount, unit)}}
+}
+
+// mustCreate appends a transaction, failing the test on error.
+func mustCreate(t *testing.T, db *TranasctionDatabase, transactionDto TransactionDto) TransactionModel {
+	t.Helper()
+	transaction, _, err := CreateTransaction(transactionDto, utils.GenerateID, utils.GenerateHash, db)
+	if err != nil {
+		t.Fatalf("CreateTransaction: %v", err)
+	}
+	return transaction
+}
+
+// errorCode is the HTTP code carried by err, 0 when it is not a TransactionError.
+func errorCode(err error) int {
+	var transErr TransactionError
+	if errors.As(err, &transErr) {
+		return transErr.GetCode()
+	}
+	return 0
+}
+
+func TestValidatePostings(t *testing.T) {
+	tests := []struct {
+		name     string
+		postings []PostingDto
+		valid    bool
+	}{
+		{"balanced", []PostingDto{debit("cash", 100, "USD"), credit("alice", 100, "USD")}, true},
+		{"multi leg", []PostingDto{debit("cash", 100, "USD"), credit("alice", 60, "USD"), credit("bob", 40, "USD")}, true},
+		{"multi asset", []PostingDto{debit("cash", 100, "USD"), credit("alice", 100, "USD"), debit("cash", 5, "EUR"), credit("bob", 5, "EUR")}, true},
+		{"single posting", []PostingDto{debit("cash", 100, "USD")}, false},
+		{"unbalanced", []PostingDto{debit("cash", 100, "USD"), credit("alice", 99, "USD")}, false},
+		{"balanced in total but not per asset", []PostingDto{debit("cash", 100, "USD"), credit("alice", 100, "EUR")}, false},
+		{"zero amount", []PostingDto{debit("cash", 0, "USD"), credit("alice", 0, "USD")}, false},
+		{"negative amount", []PostingDto{debit("cash", -5, "USD"), credit("alice", -5, "USD")}, false},
+		{"unknown direction", []PostingDto{debit("cash", 5, "USD"), {AccountId: "alice", Direction: "sideways", Amount: 5, Unit: "USD"}}, false},
+		{"credits only", []PostingDto{credit("alice", 5, "USD"), credit("bob", 5, "USD")}, false},
+		{"debits only", []PostingDto{debit("alice", 5, "USD"), debit("bob", 5, "USD")}, false},
+		{"credits wrapping to zero", []PostingDto{credit("alice", math.MaxInt64, "USD"), credit("bob", math.MaxInt64, "USD"), credit("carol", 2, "USD")}, false},
+		{"credits overflowing against debits", []PostingDto{debit("cash", 1, "USD"), credit("alice", math.MaxInt64, "USD"), credit("bob", math.MaxInt64, "USD"), credit("carol", 3, "USD")}, false},
+		{"debits overflowing", []PostingDto{debit("cash", math.MaxInt64, "USD"), debit("bank", 2, "USD"), credit("alice", 1, "USD")}, false},
+		{"largest amount", []PostingDto{debit("cash", math.MaxInt64, "USD"), credit("alice", math.MaxInt64, "USD")}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validatePostings(tt.postings)
+			if tt.valid && err != nil {
+				t.Fatalf("validatePostings() = %v, want nil", err)
+			}
+			if !tt.valid && errorCode(err) != 422 {
+				t.Fatalf("validatePostings() = %v, want a 422 TransactionError", err)
+			}
+		})
+	}
+}
+
+func TestCreateTransactionRejectsBalanceOverflow(t *testing.T) {
+	db := NewSafeTranasctionDatabase()
+	mustCreate(t, db, movement("cash", "alice", math.MaxInt64, "USD"))
+	_, _, err := CreateTransaction(movement("cash", "alice", math.MaxInt64, "USD"), utils.GenerateID, utils.GenerateHash, db)
+	var validationErr *TransactionValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("second transaction = %v, want a TransactionValidationError", err)
+	}
+	if balances, _ := db.GetBalances("alice"); balances["USD"] != math.MaxInt64 {
+		t.Fatalf("alice USD balance = %d, want %d", balances["USD"], int64(math.MaxInt64))
+	}
+}
+
+func TestCreateTransactionIdempotency(t *testing.T) {
+	withKey := func(transactionDto TransactionDto, key string) TransactionDto {
+		transactionDto.IdempotencyKey = key
+		return transactionDto
+	}
+	withId := func(transactionDto TransactionDto, transactionId string) TransactionDto {
+		transactionDto.TransactionId = transactionId
+		return transactionDto
+	}
+	described := func(transactionDto TransactionDto, description string) TransactionDto {
+		transactionDto.Description = description
+		return transactionDto
+	}
+	original := movement("cash", "alice", 100, "USD")
+
+	tests := []struct {
+		name  string
+		first TransactionDto
+		retry TransactionDto
+		// replayed is whether the retry returns the first entry, code the
+		// error it fails with otherwise (0 when it is appended).
+		replayed bool
+		code     int
+	}{
+		{"same key and body", withKey(original, "k1"), withKey(original, "k1"), true, 0},
+		{"same key, other amount", withKey(original, "k1"), withKey(movement("cash", "alice", 101, "USD"), "k1"), false, 409},
+		{"same key, other account", withKey(original, "k1"), withKey(movement("cash", "bob", 100, "USD"), "k1"), false, 409},
+		{"same key, other description", withKey(original, "k1"), withKey(described(original, "other"), "k1"), false, 409},
+		{"same key, added transaction ID", withKey(original, "k1"), withId(withKey(original, "k1"), "tx-1"), false, 409},
+		{"other key, same body", withKey(original, "k1"), withKey(original, "k2"), false, 0},
+		{"no key, same body", original, original, false, 0},
+		{"same transaction ID and body", withId(original, "tx-1"), withId(original, "tx-1"), true, 0},
+		{"same transaction ID, other body", withId(original, "tx-1"), withId(movement("cash", "alice", 5, "USD"), "tx-1"), false, 409},
+		{"same transaction ID, other key", withId(withKey(original, "k1"), "tx-1"), withId(withKey(original, "k2"), "tx-1"), false, 409},
+		{"same transaction ID, key dropped", withId(withKey(original, "k1"), "tx-1"), withId(original, "tx-1"), false, 409},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := NewSafeTranasctionDatabase()
+			first := mustCreate(t, db, tt.first)
+
+			retry, replayed, err := CreateTransaction(tt.retry, utils.GenerateID, utils.GenerateHash, db)
+			if code := errorCode(err); code != tt.code || (tt.code == 0 && err != nil) {
+				t.Fatalf("retry error = %v, want code %d", err, tt.code)
+			}
+			if replayed != tt.replayed {
+				t.Fatalf("replayed = %v, want %v", replayed, tt.replayed)
+			}
+
+			size := db.Head().Size
+			switch {
+			case tt.replayed:
+				if retry.TransactionId != first.TransactionId || retry.Hash != first.Hash {
+					t.Fatalf("replay returned %s, want the first entry %s", retry.TransactionId, first.TransactionId)
+				}
+				if size != 1 {
+					t.Fatalf("ledger holds %d entries after a replay, want 1", size)
+				}
+			case tt.code != 0:
+				if size != 1 {
+					t.Fatalf("ledger holds %d entries after a conflict, want 1", size)
+				}
+			default:
+				if retry.TransactionId == first.TransactionId || size != 2 {
+					t.Fatalf("retry was not appended as a new entry (ledger size %d)", size)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package transactions
+
+// TransactionStorage is the durable side of the ledger. The database keeps its
+// indexes in memory and hands every accepted entry to the storage before it
+// becomes visible; on startup the entries are replayed from Load in append order.
+type TransactionStorage interface {
+	Append(entries ...TransactionModel) error
+	Load() ([]TransactionModel, error)
+	Close() error
+}
+
+// MemoryStorage keeps nothing: the in-memory store of the database is the only
+// copy of the ledger and it is lost on restart.
+type MemoryStorage struct{}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{}
+}
+
+func (s *MemoryStorage) Append(entries ...TransactionModel) error {
+	return nil
+}
+
+func (s *MemoryStorage) Load() ([]TransactionModel, error) {
+	return nil, nil
+}
+
+func (s *MemoryStorage) Close() error {
+	return nil
+}
@@ -0,0 +1,139 @@
+package transactions
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// TransferDto moves an amount of an asset from one account to another. Amount
+// is in minor units or a decimal string.
+type TransferDto struct {
+	SourceAccountId      string `json:"source_account_id" binding:"required"`
+	DestinationAccountId string `json:"destination_account_id" binding:"required"`
+	Asset                string `json:"asset" binding:"required"`
+	Amount               int64  `json:"amount"`
+	DecimalAmount        string `json:"-"`
+	Description          string `json:"description"`
+	// IdempotencyKey comes from the Idempotency-Key header.
+	IdempotencyKey string `json:"-"`
+}
+
+func (dto *TransferDto) UnmarshalJSON(data []byte) error {
+	type plain TransferDto
+	var raw struct {
+		plain
+		Amount json.RawMessage `json:"amount"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*dto = TransferDto(raw.plain)
+	return decodeAmount(raw.Amount, &dto.Amount, &dto.DecimalAmount)
+}
+
+// Transfer is the entry of a transfer seen from its two legs. The debit and
+// the credit are postings of the same entry, so they are appended together
+// or not at all.
+type Transfer struct {
+	TransferId           string    `json:"transfer_id"`
+	TransactionId        string    `json:"transaction_id"`
+	Sequence             uint64    `json:"sequence"`
+	SourceAccountId      string    `json:"source_account_id"`
+	DestinationAccountId string    `json:"destination_account_id"`
+	Asset                string    `json:"asset"`
+	Amount               int64     `json:"amount"`
+	Description          string    `json:"description,omitempty"`
+	Debit                Posting   `json:"debit"`
+	Credit               Posting   `json:"credit"`
+	Timestamp            time.Time `json:"timestamp"`
+	ReversedBy           []string  `json:"reversed_by,omitempty"`
+}
+
+// CreateTransfer appends one entry that debits the source and credits the
+// destination. It goes through CreateTransaction, so the source is held to its
+// balance policy under the write lock and both accounts must accept postings
+// in the asset. A retried request with the same idempotency key returns the
+// transfer it created with replayed set.
+func CreateTransfer(transferDto TransferDto, GenerateID func() string, GenerateHash func(string, string) (string, error), transactionDb *TranasctionDatabase) (Transfer, bool, error) {
+	if transferDto.SourceAccountId == transferDto.DestinationAccountId {
+		return Transfer{}, false, &TransactionMalformed{
+			Message: "A transfer needs a destination account other than the source",
+			Code:    http.StatusUnprocessableEntity,
+		}
+	}
+
+	postings := transferPostings(transferDto.SourceAccountId, transferDto.DestinationAccountId, transferDto.Asset, transferDto.Amount)
+	for i := range postings {
+		postings[i].DecimalAmount = transferDto.DecimalAmount
+	}
+	description := transferDto.Description
+	if description == "" {
+		description = fmt.Sprintf("Transfer from %s to %s", transferDto.SourceAccountId, transferDto.DestinationAccountId)
+	}
+
+	transaction, replayed, err := CreateTransaction(TransactionDto{
+		Description:    description,
+		Postings:       postings,
+		IdempotencyKey: transferDto.IdempotencyKey,
+		TransferId:     GenerateID(),
+	}, GenerateID, GenerateHash, transactionDb)
+	if err != nil {
+		return Transfer{}, false, err
+	}
+	if transaction.TransferId == "" {
+		return Transfer{}, false, &TransactionConflictError{
+			Message: "Idempotency key was already used for a different request",
+			Code:    http.StatusConflict,
+		}
+	}
+
+	transfer, err := transactionDb.GetTransfer(transaction.TransferId)
+	return transfer, replayed, err
+}
+
+func (db *TranasctionDatabase) GetTransfer(transferId string) (Transfer, error) {
+	db.mut.RLock()
+	defer db.mut.RUnlock()
+	transactionId, exists := db.transfers[transferId]
+	if !exists {
+		return Transfer{}, &TransactionNotFoundError{
+			Message: fmt.Sprintf("Transfer %s not found", transferId),
+			Code:    http.StatusNotFound,
+		}
+	}
+	transaction := db.store[transactionId]
+	var debit, credit Posting
+	for _, posting := range transaction.Postings {
+		switch posting.Direction {
+		case DirectionDebit:
+			debit = posting
+		case DirectionCredit:
+			credit = posting
+		}
+	}
+	return Transfer{
+		TransferId:           transferId,
+		TransactionId:        transactionId,
+		Sequence:             transaction.Sequence,
+		SourceAccountId:      debit.AccountId,
+		DestinationAccountId: credit.AccountId,
+		Asset:                debit.Unit,
+		Amount:               debit.Amount,
+		Description:          transaction.Description,
+		Debit:                debit,
+		Credit:               credit,
+		Timestamp:            transaction.Timestamp,
+		ReversedBy:           slices.Clone(db.reversals[transactionId]),
+	}, nil
+}
+
+// transferPostings debits the source and credits the destination.
+func transferPostings(sourceAccountId, destinationAccountId, asset string, amount int64) []PostingDto {
+	return []PostingDto{
+		{AccountId: sourceAccountId, Direction: DirectionDebit, Amount: amount, Unit: asset},
+		{AccountId: destinationAccountId, Direction: DirectionCredit, Amount: amount, Unit: asset},
+	}
+}
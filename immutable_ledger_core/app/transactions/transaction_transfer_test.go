@@ -0,0 +1,56 @@
+package transactions
+
+import (
+	"testing"
+
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/utils"
+)
+
+func TestGetTransferPicksLegsByDirection(t *testing.T) {
+	tests := []struct {
+		name     string
+		postings []PostingDto
+	}{
+		{"debit first", []PostingDto{debit("alice", 25, "USD"), credit("bob", 25, "USD")}},
+		{"credit first", []PostingDto{credit("bob", 25, "USD"), debit("alice", 25, "USD")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := NewSafeTranasctionDatabase()
+			mustCreate(t, db, TransactionDto{Postings: tt.postings, TransferId: "transfer"})
+
+			transfer, err := db.GetTransfer("transfer")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if transfer.SourceAccountId != "alice" || transfer.DestinationAccountId != "bob" || transfer.Amount != 25 || transfer.Asset != "USD" {
+				t.Fatalf("transfer = %+v, want 25 USD from alice to bob", transfer)
+			}
+			if transfer.Debit.Direction != DirectionDebit || transfer.Credit.Direction != DirectionCredit {
+				t.Fatalf("legs = %+v and %+v", transfer.Debit, transfer.Credit)
+			}
+		})
+	}
+}
+
+func TestCreateTransferReplaysRetries(t *testing.T) {
+	db := NewSafeTranasctionDatabase()
+	transferDto := TransferDto{SourceAccountId: "alice", DestinationAccountId: "bob", Asset: "USD", Amount: 25, IdempotencyKey: "key"}
+	first, replayed, err := CreateTransfer(transferDto, utils.GenerateID, utils.GenerateHash, db)
+	if err != nil || replayed {
+		t.Fatalf("CreateTransfer() = %v, replayed %v", err, replayed)
+	}
+	retry, replayed, err := CreateTransfer(transferDto, utils.GenerateID, utils.GenerateHash, db)
+	if err != nil || !replayed || retry.TransferId != first.TransferId {
+		t.Fatalf("retry = %+v, %v, replayed %v; want transfer %s", retry, err, replayed, first.TransferId)
+	}
+
+	transferDto.Amount = 26
+	if _, _, err := CreateTransfer(transferDto, utils.GenerateID, utils.GenerateHash, db); errorCode(err) != 409 {
+		t.Fatalf("retry with another amount = %v, want code 409", err)
+	}
+	if size := db.Head().Size; size != 1 {
+		t.Fatalf("ledger holds %d entries, want 1", size)
+	}
+}
@@ -0,0 +1,162 @@
+package transactions
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	FailureGenesisMismatch      = "genesis_mismatch"
+	FailureContentHashMismatch  = "content_hash_mismatch"
+	FailurePreviousHashMismatch = "previous_hash_mismatch"
+	FailureGap                  = "gap"
+	FailureDuplicate            = "duplicate"
+)
+
+// VerificationFailure points at the first entry where the chain breaks.
+// Position is the 0-based place of the entry in the checked list, Sequence the
+// sequence number the entry claims.
+type VerificationFailure struct {
+	Kind          string `json:"kind"`
+	Position      int    `json:"position"`
+	Sequence      uint64 `json:"sequence"`
+	TransactionId string `json:"transaction_id"`
+	Expected      string `json:"expected,omitempty"`
+	Actual        string `json:"actual,omitempty"`
+	Message       string `json:"message"`
+}
+
+type VerificationReport struct {
+	Valid          bool                 `json:"valid"`
+	EntriesChecked int                  `json:"entries_checked"`
+	GenesisValid   bool                 `json:"genesis_valid"`
+	LastHash       string               `json:"last_hash,omitempty"`
+	Failure        *VerificationFailure `json:"failure,omitempty"`
+	StartedAt      time.Time            `json:"started_at"`
+	DurationMs     float64              `json:"duration_ms"`
+}
+
+// VerifyEntries walks entries in sequence order and stops at the first broken
+// link. Each entry is checked for:
+//   - genesis: the first entry links to the genesis hash of its algorithm
+//   - sequence: it follows the previous one by exactly one, a jump is a gap
+//     and a number that was already used is a duplicate
+//   - duplicate: an ID or hash that was already seen
+//   - content hash: the stored hash matches the canonical content
+//   - previous hash: it is the hash of the entry before it
+func VerifyEntries(entries []TransactionModel, GenerateHash func(string, string) (string, error)) VerificationReport {
+	verifier := NewChainVerifier(GenerateHash)
+	for _, entry := range entries {
+		if !verifier.Add(entry) {
+			break
+		}
+	}
+	return verifier.Report()
+}
+
+// ChainVerifier runs the checks of VerifyEntries one entry at a time, for
+// ledgers read from a stream that should not be loaded in memory at once.
+// Only the previous entry and the IDs and hashes seen so far are kept.
+type ChainVerifier struct {
+	report       VerificationReport
+	generateHash func(string, string) (string, error)
+	previous     *TransactionModel
+	seenIds      map[string]struct{}
+	seenHashes   map[string]struct{}
+}
+
+func NewChainVerifier(GenerateHash func(string, string) (string, error)) *ChainVerifier {
+	return &ChainVerifier{
+		report: VerificationReport{
+			Valid:        true,
+			GenesisValid: true,
+			StartedAt:    time.Now().UTC(),
+		},
+		generateHash: GenerateHash,
+		seenIds:      make(map[string]struct{}),
+		seenHashes:   make(map[string]struct{}),
+	}
+}
+
+// Add checks the next entry and reports whether the chain is still valid.
+// Entries added after a failure are ignored.
+func (v *ChainVerifier) Add(entry TransactionModel) bool {
+	if !v.report.Valid {
+		return false
+	}
+	position := v.report.EntriesChecked
+	v.report.EntriesChecked++
+	if failure := v.check(position, entry); failure != nil {
+		v.report.Valid = false
+		v.report.GenesisValid = failure.Kind != FailureGenesisMismatch
+		v.report.Failure = failure
+		return false
+	}
+	v.report.LastHash = entry.Hash
+	v.previous = &entry
+	return true
+}
+
+// Report returns the result for the entries added so far.
+func (v *ChainVerifier) Report() VerificationReport {
+	report := v.report
+	report.DurationMs = float64(time.Since(report.StartedAt).Microseconds()) / 1000
+	return report
+}
+
+func (v *ChainVerifier) check(position int, entry TransactionModel) *VerificationFailure {
+	failure := func(kind, expected, actual, message string) *VerificationFailure {
+		return &VerificationFailure{
+			Kind:          kind,
+			Position:      position,
+			Sequence:      entry.Sequence,
+			TransactionId: entry.TransactionId,
+			Expected:      expected,
+			Actual:        actual,
+			Message:       message,
+		}
+	}
+
+	if position == 0 {
+		genesisHash, err := GenesisHash(entry.HashAlgorithm, v.generateHash)
+		if err != nil {
+			return failure(FailureGenesisMismatch, "", entry.HashAlgorithm, err.Error())
+		}
+		if entry.PreviousHash != genesisHash {
+			return failure(FailureGenesisMismatch, genesisHash, entry.PreviousHash, "first entry does not link to the genesis hash")
+		}
+	}
+
+	expectedSequence := uint64(1)
+	if v.previous != nil {
+		expectedSequence = v.previous.Sequence + 1
+	}
+	if entry.Sequence > expectedSequence {
+		return failure(FailureGap, fmt.Sprint(expectedSequence), fmt.Sprint(entry.Sequence), "sequence numbers are missing before this entry")
+	}
+	if entry.Sequence < expectedSequence {
+		return failure(FailureDuplicate, fmt.Sprint(expectedSequence), fmt.Sprint(entry.Sequence), "sequence number was already used")
+	}
+
+	if _, seen := v.seenIds[entry.TransactionId]; seen {
+		return failure(FailureDuplicate, "", entry.TransactionId, "transaction ID appears more than once")
+	}
+	if _, seen := v.seenHashes[entry.Hash]; seen {
+		return failure(FailureDuplicate, "", entry.Hash, "entry hash appears more than once")
+	}
+	v.seenIds[entry.TransactionId] = struct{}{}
+	v.seenHashes[entry.Hash] = struct{}{}
+
+	hash, err := ComputeHash(entry, v.generateHash)
+	if err != nil {
+		return failure(FailureContentHashMismatch, "", entry.Hash, err.Error())
+	}
+	if hash != entry.Hash {
+		return failure(FailureContentHashMismatch, hash, entry.Hash, "stored hash does not match the entry content")
+	}
+
+	if v.previous != nil && entry.PreviousHash != v.previous.Hash {
+		return failure(FailurePreviousHashMismatch, v.previous.Hash, entry.PreviousHash, "previous hash does not match the entry before it")
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package transactions
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/utils"
+)
+
+func TestVerifyEntries(t *testing.T) {
+	for _, algorithm := range hashAlgorithms {
+		t.Run(algorithm, func(t *testing.T) {
+			chain := chainOf(t, algorithm, 4)
+			tests := []struct {
+				name     string
+				entries  func() []TransactionModel
+				kind     string
+				position int
+			}{
+				{name: "valid", entries: func() []TransactionModel { return chain }},
+				{name: "empty", entries: func() []TransactionModel { return nil }},
+				{
+					name: "bad genesis",
+					entries: func() []TransactionModel {
+						entries := append([]TransactionModel(nil), chain...)
+						entries[0].PreviousHash = "00" + entries[0].PreviousHash[2:]
+						return entries
+					},
+					kind: FailureGenesisMismatch,
+				},
+				{
+					name:    "truncated head",
+					entries: func() []TransactionModel { return chain[1:] },
+					kind:    FailureGenesisMismatch,
+				},
+				{
+					name:     "gap",
+					entries:  func() []TransactionModel { return []TransactionModel{chain[0], chain[1], chain[3]} },
+					kind:     FailureGap,
+					position: 2,
+				},
+				{
+					name:     "duplicate sequence",
+					entries:  func() []TransactionModel { return []TransactionModel{chain[0], chain[1], chain[1], chain[2]} },
+					kind:     FailureDuplicate,
+					position: 2,
+				},
+				{
+					name: "renumbered duplicate",
+					entries: func() []TransactionModel {
+						copied := chain[1]
+						copied.Sequence = 3
+						return []TransactionModel{chain[0], chain[1], copied}
+					},
+					kind:     FailureDuplicate,
+					position: 2,
+				},
+				{
+					name: "swapped entries",
+					entries: func() []TransactionModel {
+						return []TransactionModel{chain[0], chain[2], chain[1], chain[3]}
+					},
+					kind:     FailureGap,
+					position: 1,
+				},
+				{
+					name: "tampered content",
+					entries: func() []TransactionModel {
+						entries := append([]TransactionModel(nil), chain...)
+						entries[2].Description = "rewritten"
+						return entries
+					},
+					kind:     FailureContentHashMismatch,
+					position: 2,
+				},
+				{
+					name: "rehashed entry",
+					entries: func() []TransactionModel {
+						entries := append([]TransactionModel(nil), chain...)
+						entries[2].Description = "rewritten"
+						hash, err := ComputeHash(entries[2], utils.GenerateHash)
+						if err != nil {
+							t.Fatal(err)
+						}
+						entries[2].Hash = hash
+						return entries
+					},
+					kind:     FailurePreviousHashMismatch,
+					position: 3,
+				},
+			}
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					entries := tt.entries()
+					report := VerifyEntries(entries, utils.GenerateHash)
+					if tt.kind == "" {
+						if !report.Valid || !report.GenesisValid || report.Failure != nil || report.EntriesChecked != len(entries) {
+							t.Fatalf("report = %+v, want a valid chain of %d entries", report, len(entries))
+						}
+						if len(entries) > 0 && report.LastHash != entries[len(entries)-1].Hash {
+							t.Fatalf("last hash = %s, want %s", report.LastHash, entries[len(entries)-1].Hash)
+						}
+						return
+					}
+					if report.Valid || report.Failure == nil {
+						t.Fatalf("report = %+v, want a %s failure", report, tt.kind)
+					}
+					failure := report.Failure
+					if failure.Kind != tt.kind || failure.Position != tt.position || failure.TransactionId != entries[tt.position].TransactionId {
+						t.Fatalf("failure = %+v, want %s at position %d", failure, tt.kind, tt.position)
+					}
+					if report.GenesisValid != (tt.kind != FailureGenesisMismatch) {
+						t.Fatalf("genesis valid = %t with a %s failure", report.GenesisValid, tt.kind)
+					}
+					if report.EntriesChecked != tt.position+1 {
+						t.Fatalf("checked %d entries, want to stop at position %d", report.EntriesChecked, tt.position)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestConcurrentAppendsGetContiguousSequences(t *testing.T) {
+	db := NewSafeTranasctionDatabase()
+	const count = 50
+	var wg sync.WaitGroup
+	errs := make(chan error, count)
+	for i := range count {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := CreateTransaction(movement("cash", "alice", int64(i+1), "USD"), utils.GenerateID, utils.GenerateHash, db)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries := db.Entries()
+	for i, entry := range entries {
+		if entry.Sequence != uint64(i+1) {
+			t.Fatalf("entry %d has sequence %d, want %d", i, entry.Sequence, i+1)
+		}
+	}
+	if report := VerifyEntries(entries, utils.GenerateHash); !report.Valid || report.EntriesChecked != count {
+		t.Fatalf("report = %+v, want %d valid entries", report, count)
+	}
+}
@@ -0,0 +1,270 @@
+package transactions
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	DefaultSegmentSize = 64 << 20
+
+	segmentPrefix   = "segment-"
+	segmentSuffix   = ".wal"
+	frameHeaderSize = 8
+)
+
+var (
+	crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+	errTornFrame = errors.New("torn frame")
+)
+
+// SegmentLog is an append-only write-ahead log split into numbered segment
+// files. Every Append call is written as a single frame
+//
+//	[payload length uint32][crc32c(payload) uint32][payload]
+//
+// where the payload is the JSON array of the appended entries, so a batch is
+// either fully replayed or not at all. Frames are fsynced before Append returns.
+type SegmentLog struct {
+	dir         string
+	segmentSize int64
+
+	mut         sync.Mutex
+	active      *os.File
+	activeIndex int
+	activeSize  int64
+	// broken is set when a failed append could not be undone.
+	broken error
+}
+
+func OpenSegmentLog(dir string, segmentSize int64) (*SegmentLog, error) {
+	if segmentSize <= 0 {
+		segmentSize = DefaultSegmentSize
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("wal: create directory: %w", err)
+	}
+	return &SegmentLog{dir: dir, segmentSize: segmentSize}, nil
+}
+
+// Load replays every segment in order. A frame cut short at the end of the last
+// segment is the trace of a crash in the middle of a write: it was never
+// acknowledged, so it is truncated away. Damage anywhere else is reported.
+// Load must be called once before the first Append.
+func (l *SegmentLog) Load() ([]TransactionModel, error) {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	indexes, err := l.segmentIndexes()
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []TransactionModel
+	for i, index := range indexes {
+		path := l.segmentPath(index)
+		segmentEntries, validSize, err := readSegment(path)
+		if err != nil {
+			if i != len(indexes)-1 || !errors.Is(err, errTornFrame) {
+				return nil, fmt.Errorf("wal: read %s: %w", path, err)
+			}
+			log.Printf("wal: truncating torn write at the tail of %s (offset %d)", path, validSize)
+			if err := os.Truncate(path, validSize); err != nil {
+				return nil, fmt.Errorf("wal: truncate %s: %w", path, err)
+			}
+		}
+		entries = append(entries, segmentEntries...)
+	}
+
+	activeIndex := 1
+	if len(indexes) > 0 {
+		activeIndex = indexes[len(indexes)-1]
+	}
+	if err := l.openSegment(activeIndex); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (l *SegmentLog) Append(entries ...TransactionModel) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	if l.active == nil {
+		return errors.New("wal: log must be loaded before appending")
+	}
+	if l.broken != nil {
+		return l.broken
+	}
+
+	payload, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("wal: encode entries: %w", err)
+	}
+	frame := make([]byte, frameHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(frame[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(frame[4:8], crc32.Checksum(payload, crcTable))
+	copy(frame[frameHeaderSize:], payload)
+
+	if l.activeSize > 0 && l.activeSize+int64(len(frame)) > l.segmentSize {
+		if err := l.openSegment(l.activeIndex + 1); err != nil {
+			return err
+		}
+	}
+
+	if _, err := l.active.Write(frame); err != nil {
+		return l.discardFrame(fmt.Errorf("wal: write frame: %w", err))
+	}
+	if err := l.active.Sync(); err != nil {
+		return l.discardFrame(fmt.Errorf("wal: sync segment: %w", err))
+	}
+	l.activeSize += int64(len(frame))
+	return nil
+}
+
+// discardFrame drops whatever part of a failed frame made it to the active
+// segment, so the next append does not land behind garbage and a replay does
+// not bring back entries that were never acknowledged. When the segment cannot
+// be cut back the log refuses further appends.
+func (l *SegmentLog) discardFrame(cause error) error {
+	if err := l.active.Truncate(l.activeSize); err != nil {
+		l.broken = fmt.Errorf("wal: segment left with an unacknowledged frame: %w", err)
+		return errors.Join(cause, l.broken)
+	}
+	if err := l.active.Sync(); err != nil {
+		l.broken = fmt.Errorf("wal: segment left with an unacknowledged frame: %w", err)
+		return errors.Join(cause, l.broken)
+	}
+	return cause
+}
+
+func (l *SegmentLog) Close() error {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	if l.active == nil {
+		return nil
+	}
+	err := l.active.Close()
+	l.active = nil
+	return err
+}
+
+func (l *SegmentLog) segmentPath(index int) string {
+	return filepath.Join(l.dir, fmt.Sprintf("%s%06d%s", segmentPrefix, index, segmentSuffix))
+}
+
+func (l *SegmentLog) segmentIndexes() ([]int, error) {
+	files, err := os.ReadDir(l.dir)
+	if err != nil {
+		return nil, fmt.Errorf("wal: list segments: %w", err)
+	}
+	var indexes []int
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasPrefix(name, segmentPrefix) || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		index, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, segmentPrefix), segmentSuffix))
+		if err != nil {
+			continue
+		}
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	return indexes, nil
+}
+
+// openSegment makes the segment with the given index the active one, creating
+// it (and syncing the directory entry) when it does not exist yet.
+func (l *SegmentLog) openSegment(index int) error {
+	if l.active != nil {
+		if err := l.active.Close(); err != nil {
+			return fmt.Errorf("wal: close segment: %w", err)
+		}
+		l.active = nil
+	}
+
+	file, err := os.OpenFile(l.segmentPath(index), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("wal: open segment: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("wal: stat segment: %w", err)
+	}
+	if err := syncDir(l.dir); err != nil {
+		file.Close()
+		return err
+	}
+
+	l.active = file
+	l.activeIndex = index
+	l.activeSize = info.Size()
+	return nil
+}
+
+// readSegment decodes all complete frames of a segment. validSize is the offset
+// right after the last good frame.
+func readSegment(path string) (entries []TransactionModel, validSize int64, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	offset := 0
+	for offset < len(data) {
+		if len(data)-offset < frameHeaderSize {
+			return entries, int64(offset), errTornFrame
+		}
+		length := int(binary.BigEndian.Uint32(data[offset : offset+4]))
+		checksum := binary.BigEndian.Uint32(data[offset+4 : offset+8])
+		end := offset + frameHeaderSize + length
+		if end > len(data) {
+			return entries, int64(offset), errTornFrame
+		}
+
+		payload := data[offset+frameHeaderSize : end]
+		if crc32.Checksum(payload, crcTable) != checksum {
+			if end == len(data) {
+				return entries, int64(offset), errTornFrame
+			}
+			return entries, int64(offset), fmt.Errorf("checksum mismatch at offset %d", offset)
+		}
+
+		var frameEntries []TransactionModel
+		if err := json.Unmarshal(payload, &frameEntries); err != nil {
+			return entries, int64(offset), fmt.Errorf("decode frame at offset %d: %w", offset, err)
+		}
+		entries = append(entries, frameEntries...)
+		offset = end
+	}
+	return entries, int64(offset), nil
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("wal: open directory: %w", err)
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("wal: sync directory: %w", err)
+	}
+	return nil
+}
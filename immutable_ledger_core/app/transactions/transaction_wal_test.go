@@ -0,0 +1,250 @@
+package transactions
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func walEntry(sequence int) TransactionModel {
+	return TransactionModel{
+		Sequence:      uint64(sequence),
+		TransactionId: fmt.Sprintf("tx-%03d", sequence),
+		Postings:      []Posting{{AccountId: "alice", Direction: DirectionCredit, Amount: int64(sequence), Unit: "USD"}},
+	}
+}
+
+// openTestLog opens and loads a log over dir, failing the test on error.
+func openTestLog(t *testing.T, dir string, segmentSize int64) (*SegmentLog, []TransactionModel) {
+	t.Helper()
+	log, err := OpenSegmentLog(dir, segmentSize)
+	if err != nil {
+		t.Fatalf("OpenSegmentLog: %v", err)
+	}
+	entries, err := log.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	t.Cleanup(func() { log.Close() })
+	return log, entries
+}
+
+// writeTestLog appends count entries, one frame each, and closes the log.
+func writeTestLog(t *testing.T, dir string, segmentSize int64, count int) {
+	t.Helper()
+	log, _ := openTestLog(t, dir, segmentSize)
+	for i := 1; i <= count; i++ {
+		if err := log.Append(walEntry(i)); err != nil {
+			t.Fatalf("Append(%d): %v", i, err)
+		}
+	}
+	if err := log.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+func assertSequences(t *testing.T, entries []TransactionModel, count int) {
+	t.Helper()
+	if len(entries) != count {
+		t.Fatalf("replayed %d entries, want %d", len(entries), count)
+	}
+	for i, entry := range entries {
+		if entry.Sequence != uint64(i+1) || entry.TransactionId != walEntry(i+1).TransactionId {
+			t.Fatalf("entry %d = %d/%s, want %d/%s", i, entry.Sequence, entry.TransactionId, i+1, walEntry(i+1).TransactionId)
+		}
+	}
+}
+
+func segmentFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, segmentPrefix+"*"+segmentSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func frameSize(t *testing.T, entries ...TransactionModel) int64 {
+	t.Helper()
+	dir := t.TempDir()
+	log, _ := openTestLog(t, dir, 0)
+	if err := log.Append(entries...); err != nil {
+		t.Fatal(err)
+	}
+	return log.activeSize
+}
+
+func TestSegmentLogReplaysBatchesInOrder(t *testing.T) {
+	dir := t.TempDir()
+	log, entries := openTestLog(t, dir, 0)
+	if len(entries) != 0 {
+		t.Fatalf("empty log replayed %d entries", len(entries))
+	}
+	if err := log.Append(walEntry(1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := log.Append(walEntry(2), walEntry(3), walEntry(4)); err != nil {
+		t.Fatal(err)
+	}
+	log.Close()
+
+	_, entries = openTestLog(t, dir, 0)
+	assertSequences(t, entries, 4)
+}
+
+func TestSegmentLogRollsOverSegments(t *testing.T) {
+	dir := t.TempDir()
+	// Room for two frames per segment.
+	segmentSize := 2*frameSize(t, walEntry(1)) + 1
+	writeTestLog(t, dir, segmentSize, 7)
+
+	if files := segmentFiles(t, dir); len(files) != 4 {
+		t.Fatalf("got %d segments, want 4: %v", len(files), files)
+	}
+
+	log, entries := openTestLog(t, dir, segmentSize)
+	assertSequences(t, entries, 7)
+	if log.activeIndex != 4 {
+		t.Fatalf("active segment = %d, want the last one", log.activeIndex)
+	}
+	if err := log.Append(walEntry(8)); err != nil {
+		t.Fatal(err)
+	}
+	if err := log.Append(walEntry(9)); err != nil {
+		t.Fatal(err)
+	}
+	log.Close()
+
+	if files := segmentFiles(t, dir); len(files) != 5 {
+		t.Fatalf("got %d segments after reopening, want 5: %v", len(files), files)
+	}
+	_, entries = openTestLog(t, dir, segmentSize)
+	assertSequences(t, entries, 9)
+}
+
+func TestSegmentLogTruncatesTornTail(t *testing.T) {
+	tests := []struct {
+		name string
+		// damage changes the last segment, whose frames are size bytes each.
+		damage func(data []byte, size int64) []byte
+	}{
+		{"frame cut short", func(data []byte, size int64) []byte {
+			return data[:int64(len(data))-size/2]
+		}},
+		{"header cut short", func(data []byte, size int64) []byte {
+			return data[:int64(len(data))-size+frameHeaderSize/2]
+		}},
+		{"bit flipped in the last frame", func(data []byte, size int64) []byte {
+			data[int64(len(data))-size/2] ^= 0x01
+			return data
+		}},
+		{"checksum flipped in the last frame", func(data []byte, size int64) []byte {
+			data[int64(len(data))-size+4] ^= 0x80
+			return data
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			size := frameSize(t, walEntry(1))
+			segmentSize := 3*size + 1
+			writeTestLog(t, dir, segmentSize, 5)
+
+			files := segmentFiles(t, dir)
+			last := files[len(files)-1]
+			data, err := os.ReadFile(last)
+			if err != nil {
+				t.Fatal(err)
+			}
+			goodSize := int64(len(data)) - size
+			if err := os.WriteFile(last, tt.damage(data, size), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			log, entries := openTestLog(t, dir, segmentSize)
+			assertSequences(t, entries, 4)
+			if info, err := os.Stat(last); err != nil || info.Size() != goodSize {
+				t.Fatalf("tail segment not truncated to %d bytes: %v %v", goodSize, info.Size(), err)
+			}
+
+			// The next append lands right after the last good frame.
+			if err := log.Append(walEntry(5)); err != nil {
+				t.Fatal(err)
+			}
+			log.Close()
+			_, entries = openTestLog(t, dir, segmentSize)
+			assertSequences(t, entries, 5)
+		})
+	}
+}
+
+func TestSegmentLogRejectsDamageBeforeTheTail(t *testing.T) {
+	tests := []struct {
+		name string
+		// damage changes the segment files, each holding three frames of size bytes.
+		damage func(t *testing.T, files []string, size int64)
+	}{
+		{"bit flipped in a frame followed by others", func(t *testing.T, files []string, size int64) {
+			flipByte(t, files[len(files)-1], size/2)
+		}},
+		{"bit flipped in an earlier segment", func(t *testing.T, files []string, size int64) {
+			flipByte(t, files[0], 2*size+size/2)
+		}},
+		{"earlier segment cut short", func(t *testing.T, files []string, size int64) {
+			if err := os.Truncate(files[0], 3*size-1); err != nil {
+				t.Fatal(err)
+			}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			size := frameSize(t, walEntry(1))
+			segmentSize := 3*size + 1
+			writeTestLog(t, dir, segmentSize, 6)
+
+			files := segmentFiles(t, dir)
+			if len(files) != 2 {
+				t.Fatalf("got %d segments, want 2", len(files))
+			}
+			tt.damage(t, files, size)
+			before := make(map[string][]byte)
+			for _, file := range files {
+				data, _ := os.ReadFile(file)
+				before[file] = data
+			}
+
+			log, err := OpenSegmentLog(dir, segmentSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer log.Close()
+			if _, err := log.Load(); err == nil {
+				t.Fatal("Load accepted a damaged log")
+			}
+			if err := log.Append(walEntry(7)); err == nil {
+				t.Fatal("Append accepted an entry after a failed Load")
+			}
+			for _, file := range files {
+				if data, _ := os.ReadFile(file); string(data) != string(before[file]) {
+					t.Fatalf("%s changed by a failed Load", file)
+				}
+			}
+		})
+	}
+}
+
+func flipByte(t *testing.T, path string, offset int64) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[offset] ^= 0x01
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
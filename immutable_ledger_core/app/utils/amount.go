@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseDecimal converts a decimal string such as "12.34" into minor units of
+// an asset with the given scale (1234 for a scale of 2). Digits past the scale
+// must be zeros, an amount that would need rounding is refused.
+func ParseDecimal(value string, scale int) (int64, error) {
+	digits := value
+	sign := ""
+	if strings.HasPrefix(digits, "-") {
+		sign = "-"
+		digits = digits[1:]
+	}
+
+	whole, fraction, hasPoint := strings.Cut(digits, ".")
+	if whole == "" || (hasPoint && fraction == "") || !isDigits(whole) || !isDigits(fraction) {
+		return 0, fmt.Errorf("%q is not a decimal amount", value)
+	}
+	if len(fraction) > scale {
+		if strings.Trim(fraction[scale:], "0") != "" {
+			return 0, fmt.Errorf("%q has more than %d decimal places", value, scale)
+		}
+		fraction = fraction[:scale]
+	}
+	fraction += strings.Repeat("0", scale-len(fraction))
+
+	amount, err := strconv.ParseInt(sign+whole+fraction, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%q is out of range", value)
+	}
+	return amount, nil
+}
+
+// FormatMinorUnits renders an amount in minor units as a decimal string with
+// exactly scale decimal places.
+func FormatMinorUnits(amount int64, scale int) string {
+	sign := ""
+	magnitude := uint64(amount)
+	if amount < 0 {
+		sign = "-"
+		magnitude = -magnitude
+	}
+	digits := strconv.FormatUint(magnitude, 10)
+	if scale == 0 {
+		return sign + digits
+	}
+	if len(digits) <= scale {
+		digits = strings.Repeat("0", scale-len(digits)+1) + digits
+	}
+	point := len(digits) - scale
+	return sign + digits[:point] + "." + digits[point:]
+}
+
+// AddMinorUnits adds two amounts in minor units, ok is false when the sum
+// does not fit in an int64.
+func AddMinorUnits(a, b int64) (sum int64, ok bool) {
+	sum = a + b
+	if (b > 0 && sum < a) || (b < 0 && sum > a) {
+		return 0, false
+	}
+	return sum, true
+}
+
+func isDigits(value string) bool {
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
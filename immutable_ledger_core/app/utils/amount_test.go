@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestParseDecimalRoundTrips(t *testing.T) {
+	tests := []struct {
+		scale     int
+		formatted string
+		minor     int64
+	}{
+		{scale: 0, formatted: "0", minor: 0},
+		{scale: 0, formatted: "42", minor: 42},
+		{scale: 0, formatted: "-7", minor: -7},
+		{scale: 2, formatted: "0.00", minor: 0},
+		{scale: 2, formatted: "0.05", minor: 5},
+		{scale: 2, formatted: "12.34", minor: 1234},
+		{scale: 2, formatted: "-0.01", minor: -1},
+		{scale: 3, formatted: "1.001", minor: 1001},
+		{scale: 8, formatted: "0.00000001", minor: 1},
+		{scale: 8, formatted: "21000000.00000000", minor: 2_100_000_000_000_000},
+		{scale: 2, formatted: "92233720368547758.07", minor: math.MaxInt64},
+		{scale: 2, formatted: "-92233720368547758.08", minor: math.MinInt64},
+	}
+	for _, tt := range tests {
+		t.Run(tt.formatted, func(t *testing.T) {
+			minor, err := ParseDecimal(tt.formatted, tt.scale)
+			if err != nil || minor != tt.minor {
+				t.Fatalf("ParseDecimal(%q, %d) = %d, %v, want %d", tt.formatted, tt.scale, minor, err, tt.minor)
+			}
+			if formatted := FormatMinorUnits(tt.minor, tt.scale); formatted != tt.formatted {
+				t.Fatalf("FormatMinorUnits(%d, %d) = %q, want %q", tt.minor, tt.scale, formatted, tt.formatted)
+			}
+		})
+	}
+}
+
+func TestParseDecimalNormalizes(t *testing.T) {
+	tests := []struct {
+		value string
+		scale int
+		minor int64
+	}{
+		{value: "12", scale: 2, minor: 1200},
+		{value: "12.3", scale: 2, minor: 1230},
+		{value: "12.340", scale: 2, minor: 1234},
+		{value: "5.000", scale: 0, minor: 5},
+		{value: "007.10", scale: 2, minor: 710},
+	}
+	for _, tt := range tests {
+		if minor, err := ParseDecimal(tt.value, tt.scale); err != nil || minor != tt.minor {
+			t.Errorf("ParseDecimal(%q, %d) = %d, %v, want %d", tt.value, tt.scale, minor, err, tt.minor)
+		}
+	}
+}
+
+func TestParseDecimalRefuses(t *testing.T) {
+	tests := []struct {
+		value   string
+		scale   int
+		message string
+	}{
+		{value: "12.345", scale: 2, message: "more than 2 decimal places"},
+		{value: "0.001", scale: 2, message: "more than 2 decimal places"},
+		{value: "1.5", scale: 0, message: "more than 0 decimal places"},
+		{value: "", scale: 2, message: "not a decimal amount"},
+		{value: "-", scale: 2, message: "not a decimal amount"},
+		{value: ".5", scale: 2, message: "not a decimal amount"},
+		{value: "5.", scale: 2, message: "not a decimal amount"},
+		{value: "+5", scale: 2, message: "not a decimal amount"},
+		{value: "1,50", scale: 2, message: "not a decimal amount"},
+		{value: "1e3", scale: 2, message: "not a decimal amount"},
+		{value: "92233720368547758.08", scale: 2, message: "out of range"},
+	}
+	for _, tt := range tests {
+		_, err := ParseDecimal(tt.value, tt.scale)
+		if err == nil || !strings.Contains(err.Error(), tt.message) {
+			t.Errorf("ParseDecimal(%q, %d) error = %v, want %q", tt.value, tt.scale, err, tt.message)
+		}
+	}
+}
+
+func TestAddMinorUnits(t *testing.T) {
+	tests := []struct {
+		a, b int64
+		sum  int64
+		ok   bool
+	}{
+		{a: 1, b: 2, sum: 3, ok: true},
+		{a: -5, b: 3, sum: -2, ok: true},
+		{a: math.MaxInt64, b: 1},
+		{a: math.MinInt64, b: -1},
+		{a: math.MaxInt64, b: math.MinInt64, sum: -1, ok: true},
+	}
+	for _, tt := range tests {
+		if sum, ok := AddMinorUnits(tt.a, tt.b); sum != tt.sum || ok != tt.ok {
+			t.Errorf("AddMinorUnits(%d, %d) = %d, %t, want %d, %t", tt.a, tt.b, sum, ok, tt.sum, tt.ok)
+		}
+	}
+}
@@ -1,9 +1,48 @@
 package utils
 
-import "crypto/sha256"
+import (
+	"crypto/sha256"
+	"crypto/sha3"
+	"encoding/hex"
+	"fmt"
+	"hash"
 
-func GenerateHash(input string) string {
-	hash := sha256.New()
+	"golang.org/x/crypto/blake2b"
+)
+
+const (
+	HashAlgorithmSHA256     = "sha256"
+	HashAlgorithmSHA3_256   = "sha3-256"
+	HashAlgorithmBLAKE2b256 = "blake2b-256"
+
+	DefaultHashAlgorithm = HashAlgorithmSHA256
+)
+
+var hashConstructors = map[string]func() hash.Hash{
+	HashAlgorithmSHA256: sha256.New,
+	HashAlgorithmSHA3_256: func() hash.Hash {
+		return sha3.New256()
+	},
+	HashAlgorithmBLAKE2b256: func() hash.Hash {
+		h, _ := blake2b.New256(nil)
+		return h
+	},
+}
+
+// GenerateHash returns the hex encoded digest of input. Every ledger entry
+// records the algorithm it was hashed with, so entries written with an older
+// algorithm keep verifying after the default changes.
+func GenerateHash(algorithm string, input string) (string, error) {
+	constructor, ok := hashConstructors[algorithm]
+	if !ok {
+		return "", fmt.Errorf("unsupported hash algorithm %q", algorithm)
+	}
+	hash := constructor()
 	hash.Write([]byte(input))
-	return string(hash.Sum(nil))
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func IsSupportedHashAlgorithm(algorithm string) bool {
+	_, ok := hashConstructors[algorithm]
+	return ok
 }
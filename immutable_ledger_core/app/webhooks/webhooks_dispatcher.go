@@ -0,0 +1,674 @@
+package webhooks
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/transactions"
+)
+
+// Options tune how deliveries are sent. A delivery that keeps failing is tried
+// MaxAttempts times, waiting BaseDelay after the first failure and twice as
+// long after each next one, up to MaxDelay. Deliveries that succeeded or failed
+// are forgotten Retention after their last update, except the latest one of
+// every endpoint, which marks where its events resume.
+type Options struct {
+	Client      *http.Client
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Retention   time.Duration
+}
+
+// DefaultOptions give up on a delivery after about 21 minutes and keep it for
+// a week.
+var DefaultOptions = Options{
+	Client:      &http.Client{Timeout: 10 * time.Second},
+	MaxAttempts: 8,
+	BaseDelay:   10 * time.Second,
+	MaxDelay:    time.Hour,
+	Retention:   7 * 24 * time.Hour,
+}
+
+// responseLimit is how much of a response body is read before the connection
+// is reused, receivers are only expected to answer with a status code.
+const responseLimit = 64 << 10
+
+// compactionSlack is how many superseded lines the delivery log may hold on
+// top of one line per delivery before it is rewritten.
+const compactionSlack = 1024
+
+// Dispatcher follows the ledger and delivers its events to the registered
+// endpoints. Endpoints are kept in a JSON file rewritten on every change,
+// every state of a delivery is appended to a JSON lines log whose last line
+// per delivery wins when it is loaded again. The log is rewritten with only
+// those lines on start, and while running once superseded lines outnumber the
+// live ones. Delivery is at least once: a delivery in flight when the service
+// stops is sent again on start.
+type Dispatcher struct {
+	transactionDb  *transactions.TranasctionDatabase
+	endpointsPath  string
+	deliveriesPath string
+	generateId     func() string
+	options        Options
+
+	mut        sync.RWMutex
+	endpoints  map[string]Endpoint
+	deliveries map[string]*Delivery
+	order      []string
+	lastQueued map[string]uint64
+	pending    map[string]struct{}
+	inFlight   map[string]struct{}
+	logLines   int
+	wake       chan struct{}
+}
+
+func NewDispatcher(transactionDb *transactions.TranasctionDatabase, endpointsPath string, deliveriesPath string, generateId func() string, options Options) (*Dispatcher, error) {
+	if options.Client == nil || options.MaxAttempts < 1 || options.BaseDelay <= 0 || options.MaxDelay < options.BaseDelay || options.Retention <= 0 {
+		return nil, errors.New("webhook options need a client, at least one attempt, a base delay no longer than the max delay and a retention")
+	}
+	d := &Dispatcher{
+		transactionDb:  transactionDb,
+		endpointsPath:  endpointsPath,
+		deliveriesPath: deliveriesPath,
+		generateId:     generateId,
+		options:        options,
+		endpoints:      make(map[string]Endpoint),
+		deliveries:     make(map[string]*Delivery),
+		lastQueued:     make(map[string]uint64),
+		pending:        make(map[string]struct{}),
+		inFlight:       make(map[string]struct{}),
+		wake:           make(chan struct{}, 1),
+	}
+
+	data, err := os.ReadFile(endpointsPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("read webhook endpoints: %w", err)
+	}
+	if err == nil {
+		var endpoints []Endpoint
+		if err := json.Unmarshal(data, &endpoints); err != nil {
+			return nil, fmt.Errorf("decode webhook endpoints: %w", err)
+		}
+		for _, endpoint := range endpoints {
+			d.endpoints[endpoint.Id] = endpoint
+		}
+	}
+
+	if err := d.load(); err != nil {
+		return nil, err
+	}
+	d.evict(time.Now())
+	if d.logLines > len(d.order) {
+		if err := d.compact(); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// load reads the delivery log, the last line of a delivery wins.
+func (d *Dispatcher) load() error {
+	file, err := os.Open(d.deliveriesPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("open webhook deliveries: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var delivery Delivery
+		if err := json.Unmarshal(scanner.Bytes(), &delivery); err != nil {
+			return fmt.Errorf("decode webhook delivery on line %d: %w", line, err)
+		}
+		d.store(&delivery)
+		d.logLines++
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read webhook deliveries: %w", err)
+	}
+	return nil
+}
+
+// Register adds an endpoint. It receives the events of entries appended from
+// now on, the ledger history is not replayed to it.
+func (d *Dispatcher) Register(endpointDto EndpointDto) (Endpoint, error) {
+	events := EventTypes
+	if len(endpointDto.Events) > 0 {
+		events = endpointDto.Events
+	}
+	secret := endpointDto.Secret
+	if secret == "" {
+		random := make([]byte, 32)
+		if _, err := rand.Read(random); err != nil {
+			return Endpoint{}, fmt.Errorf("generate webhook secret: %w", err)
+		}
+		secret = "whsec_" + hex.EncodeToString(random)
+	}
+
+	d.mut.Lock()
+	defer d.mut.Unlock()
+
+	endpoint := Endpoint{
+		Id:            d.generateId(),
+		Url:           endpointDto.Url,
+		Events:        slices.Compact(slices.Sorted(slices.Values(events))),
+		AccountIds:    slices.Clone(endpointDto.AccountIds),
+		Secret:        secret,
+		StartSequence: uint64(d.transactionDb.Head().Size),
+		CreatedAt:     time.Now().UTC(),
+	}
+	d.endpoints[endpoint.Id] = endpoint
+	if err := d.persistEndpoints(); err != nil {
+		delete(d.endpoints, endpoint.Id)
+		return Endpoint{}, err
+	}
+	return endpoint, nil
+}
+
+// List returns the endpoints ordered by ID, without their secrets.
+func (d *Dispatcher) List() []Endpoint {
+	d.mut.RLock()
+	defer d.mut.RUnlock()
+	endpoints := make([]Endpoint, 0, len(d.endpoints))
+	for _, endpoint := range d.endpoints {
+		endpoints = append(endpoints, endpoint.Redacted())
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		return endpoints[i].Id < endpoints[j].Id
+	})
+	return endpoints
+}
+
+func (d *Dispatcher) Get(endpointId string) (Endpoint, error) {
+	d.mut.RLock()
+	defer d.mut.RUnlock()
+	endpoint, exists := d.endpoints[endpointId]
+	if !exists {
+		return Endpoint{}, endpointNotFound(endpointId)
+	}
+	return endpoint.Redacted(), nil
+}
+
+// Delete removes an endpoint. Its pending deliveries fail, the delivery log
+// is kept.
+func (d *Dispatcher) Delete(endpointId string) error {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+	endpoint, exists := d.endpoints[endpointId]
+	if !exists {
+		return endpointNotFound(endpointId)
+	}
+	delete(d.endpoints, endpointId)
+	if err := d.persistEndpoints(); err != nil {
+		d.endpoints[endpointId] = endpoint
+		return err
+	}
+
+	now := time.Now().UTC()
+	for deliveryId := range d.pending {
+		delivery := *d.deliveries[deliveryId]
+		if delivery.EndpointId != endpointId {
+			continue
+		}
+		delivery.Status = DeliveryFailed
+		delivery.NextAttemptAt = nil
+		delivery.UpdatedAt = now
+		if err := d.save(&delivery); err != nil {
+			log.Printf("webhooks: failed to record delivery %s of deleted endpoint: %v", deliveryId, err)
+		}
+	}
+	return nil
+}
+
+// Deliveries returns the delivery log of an endpoint, oldest first.
+func (d *Dispatcher) Deliveries(endpointId string, filters DeliveryFilters) ([]Delivery, error) {
+	d.mut.RLock()
+	defer d.mut.RUnlock()
+	if _, exists := d.endpoints[endpointId]; !exists {
+		return nil, endpointNotFound(endpointId)
+	}
+	deliveries := []Delivery{}
+	for _, deliveryId := range d.order {
+		delivery := d.deliveries[deliveryId]
+		if delivery.EndpointId != endpointId || (filters.Status != "" && delivery.Status != filters.Status) {
+			continue
+		}
+		deliveries = append(deliveries, *delivery)
+	}
+	return deliveries, nil
+}
+
+func (d *Dispatcher) Delivery(endpointId string, deliveryId string) (Delivery, error) {
+	d.mut.RLock()
+	defer d.mut.RUnlock()
+	delivery, err := d.delivery(endpointId, deliveryId)
+	if err != nil {
+		return Delivery{}, err
+	}
+	return *delivery, nil
+}
+
+// Redeliver schedules a delivery to be sent right away, whatever its status,
+// with a fresh retry budget. A delivery that is being sent cannot be
+// scheduled again until the attempt is over.
+func (d *Dispatcher) Redeliver(endpointId string, deliveryId string) (Delivery, error) {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+	current, err := d.delivery(endpointId, deliveryId)
+	if err != nil {
+		return Delivery{}, err
+	}
+	if _, sending := d.inFlight[deliveryId]; sending {
+		return Delivery{}, &transactions.TransactionConflictError{
+			Message: fmt.Sprintf("Delivery %s is being sent", deliveryId),
+			Code:    http.StatusConflict,
+		}
+	}
+
+	now := time.Now().UTC()
+	delivery := *current
+	delivery.Status = DeliveryPending
+	delivery.RetryCount = 0
+	delivery.Redeliveries++
+	delivery.NextAttemptAt = &now
+	delivery.UpdatedAt = now
+	if err := d.save(&delivery); err != nil {
+		return Delivery{}, err
+	}
+	d.signal()
+	return delivery, nil
+}
+
+// Run delivers events until ctx is done. It wakes up when the ledger grows,
+// when a retry is due and when a delivery is scheduled by hand, and forgets
+// settled deliveries once their retention is over.
+func (d *Dispatcher) Run(ctx context.Context) {
+	position := d.resumePosition()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	retention := time.NewTicker(min(d.options.Retention, time.Hour))
+	defer retention.Stop()
+	for {
+		appended := d.transactionDb.Appended()
+		head := uint64(d.transactionDb.Head().Size)
+		wait := time.Duration(-1)
+		if head > position {
+			err := d.transactionDb.ScanEntries(transactions.LedgerFilters{AfterSequence: &position}, head, func(transaction transactions.TransactionModel) error {
+				if err := d.enqueue(transaction); err != nil {
+					return err
+				}
+				position = transaction.Sequence
+				return nil
+			})
+			if err != nil {
+				log.Printf("webhooks: failed to enqueue ledger events: %v", err)
+				wait = d.options.BaseDelay
+			} else {
+				position = head
+			}
+		}
+
+		if next, scheduled := d.dispatchDue(ctx); scheduled && (wait < 0 || time.Until(next) < wait) {
+			wait = max(time.Until(next), 0)
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		var retry <-chan time.Time
+		if wait >= 0 {
+			timer.Reset(wait)
+			retry = timer.C
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-appended:
+		case <-d.wake:
+		case <-retry:
+		case now := <-retention.C:
+			d.prune(now)
+		}
+	}
+}
+
+// resumePosition is the sequence the ledger is scanned after on start: the
+// oldest point an endpoint may still be missing events from.
+func (d *Dispatcher) resumePosition() uint64 {
+	d.mut.RLock()
+	defer d.mut.RUnlock()
+	position := uint64(d.transactionDb.Head().Size)
+	for _, endpoint := range d.endpoints {
+		position = min(position, max(endpoint.StartSequence, d.lastQueued[endpoint.Id]))
+	}
+	return position
+}
+
+// enqueue creates the deliveries of a ledger entry. Entries are enqueued in
+// sequence order, so one at or before an endpoint's latest delivery was
+// already handled for it, even if that delivery has since been forgotten.
+func (d *Dispatcher) enqueue(transaction transactions.TransactionModel) error {
+	eventType := EventType(transaction)
+
+	d.mut.Lock()
+	defer d.mut.Unlock()
+	var event *Event
+	for _, endpoint := range d.endpoints {
+		if transaction.Sequence <= max(endpoint.StartSequence, d.lastQueued[endpoint.Id]) || !endpoint.Accepts(eventType, transaction) {
+			continue
+		}
+		if event == nil {
+			event = &Event{
+				Id:        d.generateId(),
+				Type:      eventType,
+				CreatedAt: transaction.Timestamp,
+				Data:      transaction,
+			}
+		}
+		now := time.Now().UTC()
+		delivery := &Delivery{
+			Id:            d.generateId(),
+			EndpointId:    endpoint.Id,
+			Event:         *event,
+			Status:        DeliveryPending,
+			NextAttemptAt: &now,
+			Attempts:      []DeliveryAttempt{},
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+		if err := d.save(delivery); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dispatchDue starts sending every pending delivery whose attempt is due and
+// returns when the next one is.
+func (d *Dispatcher) dispatchDue(ctx context.Context) (next time.Time, scheduled bool) {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+	now := time.Now()
+	for deliveryId := range d.pending {
+		if _, sending := d.inFlight[deliveryId]; sending {
+			continue
+		}
+		delivery := d.deliveries[deliveryId]
+		if at := *delivery.NextAttemptAt; at.After(now) {
+			if !scheduled || at.Before(next) {
+				next, scheduled = at, true
+			}
+			continue
+		}
+		endpoint, exists := d.endpoints[delivery.EndpointId]
+		if !exists {
+			continue
+		}
+		d.inFlight[deliveryId] = struct{}{}
+		go d.send(ctx, endpoint, *delivery)
+	}
+	return next, scheduled
+}
+
+// send makes one attempt and records its outcome. An attempt cut short by
+// ctx is not recorded, the delivery stays due for the next start.
+func (d *Dispatcher) send(ctx context.Context, endpoint Endpoint, delivery Delivery) {
+	attempt := d.post(ctx, endpoint, delivery)
+
+	d.mut.Lock()
+	defer d.mut.Unlock()
+	defer d.signal()
+	delete(d.inFlight, delivery.Id)
+	if ctx.Err() != nil {
+		return
+	}
+
+	updated := *d.deliveries[delivery.Id]
+	updated.Attempts = append(slices.Clip(updated.Attempts), attempt)
+	updated.UpdatedAt = time.Now().UTC()
+	switch {
+	case attempt.Error == "":
+		updated.Status = DeliverySucceeded
+		updated.NextAttemptAt = nil
+	case updated.RetryCount+1 >= d.options.MaxAttempts:
+		updated.RetryCount++
+		updated.Status = DeliveryFailed
+		updated.NextAttemptAt = nil
+	default:
+		updated.RetryCount++
+		at := updated.UpdatedAt.Add(d.backoff(updated.RetryCount))
+		updated.NextAttemptAt = &at
+	}
+	if err := d.save(&updated); err != nil {
+		log.Printf("webhooks: failed to record attempt of delivery %s: %v", delivery.Id, err)
+	}
+}
+
+func (d *Dispatcher) post(ctx context.Context, endpoint Endpoint, delivery Delivery) DeliveryAttempt {
+	start := time.Now()
+	attempt := DeliveryAttempt{Timestamp: start.UTC()}
+	defer func() {
+		attempt.DurationMs = time.Since(start).Milliseconds()
+	}()
+
+	body, err := json.Marshal(delivery.Event)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.Url, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "immutable-ledger-webhooks/1")
+	request.Header.Set(EventHeader, delivery.Event.Type)
+	request.Header.Set(DeliveryHeader, delivery.Id)
+	request.Header.Set(SignatureHeader, Sign(endpoint.Secret, start, body))
+
+	response, err := d.options.Client.Do(request)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(response.Body, responseLimit))
+	attempt.StatusCode = response.StatusCode
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		attempt.Error = fmt.Sprintf("endpoint answered %s", response.Status)
+	}
+	return attempt
+}
+
+// backoff is the wait after the retryCount-th failed attempt in a row.
+func (d *Dispatcher) backoff(retryCount int) time.Duration {
+	delay := d.options.BaseDelay
+	for i := 1; i < retryCount && delay < d.options.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, d.options.MaxDelay)
+}
+
+func (d *Dispatcher) signal() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// delivery returns a delivery of an endpoint, callers must hold the lock.
+func (d *Dispatcher) delivery(endpointId string, deliveryId string) (*Delivery, error) {
+	if _, exists := d.endpoints[endpointId]; !exists {
+		return nil, endpointNotFound(endpointId)
+	}
+	delivery, exists := d.deliveries[deliveryId]
+	if !exists || delivery.EndpointId != endpointId {
+		return nil, &transactions.TransactionNotFoundError{
+			Message: fmt.Sprintf("Delivery %s not found", deliveryId),
+			Code:    http.StatusNotFound,
+		}
+	}
+	return delivery, nil
+}
+
+func endpointNotFound(endpointId string) error {
+	return &transactions.TransactionNotFoundError{
+		Message: fmt.Sprintf("Webhook endpoint %s not found", endpointId),
+		Code:    http.StatusNotFound,
+	}
+}
+
+// save appends the delivery to the log, then keeps it in memory. Callers must
+// hold the write lock.
+func (d *Dispatcher) save(delivery *Delivery) error {
+	line, err := json.Marshal(delivery)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(d.deliveriesPath), 0o755); err != nil {
+		return fmt.Errorf("create webhook deliveries directory: %w", err)
+	}
+	file, err := os.OpenFile(d.deliveriesPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("open webhook deliveries: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("write webhook deliveries: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("sync webhook deliveries: %w", err)
+	}
+	d.store(delivery)
+	d.logLines++
+	return nil
+}
+
+// store indexes a delivery, callers must hold the write lock.
+func (d *Dispatcher) store(delivery *Delivery) {
+	if _, exists := d.deliveries[delivery.Id]; !exists {
+		d.order = append(d.order, delivery.Id)
+	}
+	d.deliveries[delivery.Id] = delivery
+	d.lastQueued[delivery.EndpointId] = max(d.lastQueued[delivery.EndpointId], delivery.Event.Data.Sequence)
+	if delivery.Status == DeliveryPending {
+		d.pending[delivery.Id] = struct{}{}
+	} else {
+		delete(d.pending, delivery.Id)
+	}
+}
+
+// prune forgets the deliveries whose retention is over and rewrites the log
+// without them, or once it holds more superseded lines than compactionSlack.
+func (d *Dispatcher) prune(now time.Time) {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+	if d.evict(now) > 0 || d.logLines > len(d.order)+compactionSlack {
+		if err := d.compact(); err != nil {
+			log.Printf("webhooks: failed to compact the delivery log: %v", err)
+		}
+	}
+}
+
+// evict drops the settled deliveries last updated more than the retention ago.
+// The latest delivery of a registered endpoint is kept so lastQueued survives
+// a restart. It returns how many were dropped, callers must hold the write
+// lock.
+func (d *Dispatcher) evict(now time.Time) int {
+	cutoff := now.Add(-d.options.Retention)
+	count := len(d.order)
+	d.order = slices.DeleteFunc(d.order, func(deliveryId string) bool {
+		delivery := d.deliveries[deliveryId]
+		_, registered := d.endpoints[delivery.EndpointId]
+		if delivery.Status == DeliveryPending || delivery.UpdatedAt.After(cutoff) || (registered && delivery.Event.Data.Sequence == d.lastQueued[delivery.EndpointId]) {
+			return false
+		}
+		delete(d.deliveries, deliveryId)
+		return true
+	})
+	return count - len(d.order)
+}
+
+// compact replaces the delivery log through a rename with one line per
+// delivery it still holds. Callers must hold the write lock.
+func (d *Dispatcher) compact() error {
+	var buffer bytes.Buffer
+	for _, deliveryId := range d.order {
+		line, err := json.Marshal(d.deliveries[deliveryId])
+		if err != nil {
+			return err
+		}
+		buffer.Write(append(line, '\n'))
+	}
+	tmp := d.deliveriesPath + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("open webhook deliveries: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.Write(buffer.Bytes()); err != nil {
+		return fmt.Errorf("write webhook deliveries: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("sync webhook deliveries: %w", err)
+	}
+	if err := os.Rename(tmp, d.deliveriesPath); err != nil {
+		return fmt.Errorf("replace webhook deliveries: %w", err)
+	}
+	d.logLines = len(d.order)
+	return nil
+}
+
+// persistEndpoints replaces the endpoints file through a rename. The file
+// holds the signing secrets, so only the owner can read it.
+func (d *Dispatcher) persistEndpoints() error {
+	endpoints := make([]Endpoint, 0, len(d.endpoints))
+	for _, endpoint := range d.endpoints {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		return endpoints[i].Id < endpoints[j].Id
+	})
+	data, err := json.MarshalIndent(endpoints, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(d.endpointsPath), 0o755); err != nil {
+		return fmt.Errorf("create webhook endpoints directory: %w", err)
+	}
+	tmp := d.endpointsPath + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("write webhook endpoints: %w", err)
+	}
+	if err := os.Rename(tmp, d.endpointsPath); err != nil {
+		return fmt.Errorf("replace webhook endpoints: %w", err)
+	}
+	return nil
+}
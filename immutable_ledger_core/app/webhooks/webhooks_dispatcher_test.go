@@ -0,0 +1,500 @@
+package webhooks
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/transactions"
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/utils"
+)
+
+const testSecret = "whsec_test_secret_value"
+
+// receiver is a local webhook endpoint that records the requests it gets and
+// answers with status.
+type receiver struct {
+	server *httptest.Server
+	status atomic.Int32
+
+	mut      sync.Mutex
+	requests []receivedRequest
+}
+
+type receivedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+func newReceiver(t *testing.T, status int) *receiver {
+	t.Helper()
+	r := &receiver{}
+	r.status.Store(int32(status))
+	r.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mut.Lock()
+		r.requests = append(r.requests, receivedRequest{header: req.Header.Clone(), body: body})
+		r.mut.Unlock()
+		w.WriteHeader(int(r.status.Load()))
+	}))
+	t.Cleanup(r.server.Close)
+	return r
+}
+
+func (r *receiver) received() []receivedRequest {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	return append([]receivedRequest(nil), r.requests...)
+}
+
+// testDispatcher is a dispatcher over a fresh ledger whose files live in dir.
+type testDispatcher struct {
+	*Dispatcher
+	transactionDb *transactions.TranasctionDatabase
+	dir           string
+	options       Options
+	stop          context.CancelFunc
+	done          chan struct{}
+}
+
+func testOptions(maxAttempts int) Options {
+	return Options{
+		Client:      &http.Client{Timeout: 2 * time.Second},
+		MaxAttempts: maxAttempts,
+		BaseDelay:   5 * time.Millisecond,
+		MaxDelay:    20 * time.Millisecond,
+		Retention:   time.Hour,
+	}
+}
+
+func newTestDispatcher(t *testing.T, options Options) *testDispatcher {
+	t.Helper()
+	d := &testDispatcher{
+		transactionDb: transactions.NewSafeTranasctionDatabase(),
+		dir:           t.TempDir(),
+		options:       options,
+	}
+	d.open(t)
+	return d
+}
+
+// open loads the dispatcher from its files and starts it.
+func (d *testDispatcher) open(t *testing.T) {
+	t.Helper()
+	dispatcher, err := NewDispatcher(d.transactionDb, filepath.Join(d.dir, "endpoints.json"), filepath.Join(d.dir, "deliveries.jsonl"), utils.GenerateID, d.options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	d.Dispatcher, d.stop, d.done = dispatcher, stop, make(chan struct{})
+	go func() {
+		defer close(d.done)
+		dispatcher.Run(ctx)
+	}()
+	t.Cleanup(d.close)
+}
+
+func (d *testDispatcher) close() {
+	d.stop()
+	<-d.done
+}
+
+func (d *testDispatcher) register(t *testing.T, dto EndpointDto) Endpoint {
+	t.Helper()
+	if dto.Secret == "" {
+		dto.Secret = testSecret
+	}
+	endpoint, err := d.Register(dto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return endpoint
+}
+
+func (d *testDispatcher) move(t *testing.T, from, to string, amount int64) transactions.TransactionModel {
+	t.Helper()
+	transaction, _, err := transactions.CreateTransaction(transactions.TransactionDto{Postings: []transactions.PostingDto{
+		{AccountId: from, Direction: transactions.DirectionDebit, Amount: amount, Unit: "USD"},
+		{AccountId: to, Direction: transactions.DirectionCredit, Amount: amount, Unit: "USD"},
+	}}, utils.GenerateID, utils.GenerateHash, d.transactionDb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return transaction
+}
+
+// waitForDeliveries waits until the endpoint has count deliveries that all
+// satisfy done, and returns them.
+func (d *testDispatcher) waitForDeliveries(t *testing.T, endpointId string, count int, done func(Delivery) bool) []Delivery {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		deliveries, err := d.Deliveries(endpointId, DeliveryFilters{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		finished := len(deliveries) == count
+		for _, delivery := range deliveries {
+			finished = finished && done(delivery)
+		}
+		if finished {
+			return deliveries
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("deliveries of %s did not settle: %+v", endpointId, deliveries)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func hasStatus(status string) func(Delivery) bool {
+	return func(delivery Delivery) bool {
+		return delivery.Status == status
+	}
+}
+
+func TestDispatcherDeliversSignedEvents(t *testing.T) {
+	r := newReceiver(t, http.StatusNoContent)
+	d := newTestDispatcher(t, testOptions(3))
+	d.move(t, "cash", "alice", 50)
+	endpoint := d.register(t, EndpointDto{Url: r.server.URL})
+
+	transaction := d.move(t, "cash", "alice", 100)
+	deliveries := d.waitForDeliveries(t, endpoint.Id, 1, hasStatus(DeliverySucceeded))
+
+	requests := r.received()
+	if len(requests) != 1 {
+		t.Fatalf("receiver got %d requests, want 1 (entries before the registration are not sent)", len(requests))
+	}
+	request := requests[0]
+	if err := VerifySignature(testSecret, request.header.Get(SignatureHeader), request.body, time.Minute); err != nil {
+		t.Fatalf("signature: %v", err)
+	}
+	if got := request.header.Get(EventHeader); got != EventTransactionCreated {
+		t.Fatalf("%s = %q, want %q", EventHeader, got, EventTransactionCreated)
+	}
+	if got := request.header.Get(DeliveryHeader); got != deliveries[0].Id {
+		t.Fatalf("%s = %q, want %q", DeliveryHeader, got, deliveries[0].Id)
+	}
+	var event Event
+	if err := json.Unmarshal(request.body, &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != EventTransactionCreated || event.Data.TransactionId != transaction.TransactionId || event.Data.Hash != transaction.Hash {
+		t.Fatalf("event = %+v, want the created entry %s", event, transaction.TransactionId)
+	}
+	if attempts := deliveries[0].Attempts; len(attempts) != 1 || attempts[0].StatusCode != http.StatusNoContent || attempts[0].Error != "" {
+		t.Fatalf("attempts = %+v, want one successful attempt", attempts)
+	}
+}
+
+func TestDispatcherRetriesUntilFailed(t *testing.T) {
+	r := newReceiver(t, http.StatusInternalServerError)
+	d := newTestDispatcher(t, testOptions(3))
+	endpoint := d.register(t, EndpointDto{Url: r.server.URL})
+
+	d.move(t, "cash", "alice", 100)
+	delivery := d.waitForDeliveries(t, endpoint.Id, 1, hasStatus(DeliveryFailed))[0]
+
+	if delivery.RetryCount != 3 || len(delivery.Attempts) != 3 || delivery.NextAttemptAt != nil {
+		t.Fatalf("delivery = %+v, want 3 failed attempts and nothing scheduled", delivery)
+	}
+	for i, attempt := range delivery.Attempts {
+		if attempt.StatusCode != http.StatusInternalServerError || attempt.Error == "" {
+			t.Fatalf("attempt %d = %+v, want a recorded 500", i, attempt)
+		}
+		if i > 0 && attempt.Timestamp.Sub(delivery.Attempts[i-1].Timestamp) < d.options.BaseDelay {
+			t.Fatalf("attempt %d came %s after the previous one, before the backoff", i, attempt.Timestamp.Sub(delivery.Attempts[i-1].Timestamp))
+		}
+	}
+
+	// A failed delivery is not tried again on its own.
+	time.Sleep(5 * d.options.MaxDelay)
+	if requests := r.received(); len(requests) != 3 {
+		t.Fatalf("receiver got %d requests, want 3", len(requests))
+	}
+}
+
+func TestDispatcherRetriesUnreachableEndpoints(t *testing.T) {
+	r := newReceiver(t, http.StatusOK)
+	url := r.server.URL
+	r.server.Close()
+
+	d := newTestDispatcher(t, testOptions(2))
+	endpoint := d.register(t, EndpointDto{Url: url})
+	d.move(t, "cash", "alice", 100)
+	delivery := d.waitForDeliveries(t, endpoint.Id, 1, hasStatus(DeliveryFailed))[0]
+
+	for i, attempt := range delivery.Attempts {
+		if attempt.StatusCode != 0 || attempt.Error == "" {
+			t.Fatalf("attempt %d = %+v, want a connection error", i, attempt)
+		}
+	}
+}
+
+func TestDispatcherReloadsDeliveryLog(t *testing.T) {
+	ok := newReceiver(t, http.StatusOK)
+	failing := newReceiver(t, http.StatusBadGateway)
+	d := newTestDispatcher(t, testOptions(2))
+	succeeding := d.register(t, EndpointDto{Url: ok.server.URL})
+	failed := d.register(t, EndpointDto{Url: failing.server.URL})
+
+	d.move(t, "cash", "alice", 100)
+	d.move(t, "cash", "bob", 100)
+	before := map[string][]Delivery{
+		succeeding.Id: d.waitForDeliveries(t, succeeding.Id, 2, hasStatus(DeliverySucceeded)),
+		failed.Id:     d.waitForDeliveries(t, failed.Id, 2, hasStatus(DeliveryFailed)),
+	}
+	d.close()
+
+	d.open(t)
+	for endpointId, deliveries := range before {
+		reloaded, err := d.Deliveries(endpointId, DeliveryFilters{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(reloaded) != len(deliveries) {
+			t.Fatalf("endpoint %s has %d deliveries after a reload, want %d", endpointId, len(reloaded), len(deliveries))
+		}
+		for i := range deliveries {
+			want, got := deliveries[i], reloaded[i]
+			if got.Id != want.Id || got.Status != want.Status || got.RetryCount != want.RetryCount || len(got.Attempts) != len(want.Attempts) || got.Event.Data.Hash != want.Event.Data.Hash {
+				t.Fatalf("delivery %d after a reload = %+v, want %+v", i, got, want)
+			}
+		}
+	}
+
+	// Entries already delivered are not sent again after the reload, new ones are.
+	d.move(t, "cash", "carol", 100)
+	d.waitForDeliveries(t, succeeding.Id, 3, hasStatus(DeliverySucceeded))
+	if requests := ok.received(); len(requests) != 3 {
+		t.Fatalf("receiver got %d requests, want 3", len(requests))
+	}
+}
+
+// logLines counts the lines of the delivery log.
+func (d *testDispatcher) logLines(t *testing.T) int {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(d.dir, "deliveries.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.Count(data, []byte("\n"))
+}
+
+func TestDispatcherCompactsDeliveryLogOnStart(t *testing.T) {
+	r := newReceiver(t, http.StatusBadGateway)
+	d := newTestDispatcher(t, testOptions(3))
+	endpoint := d.register(t, EndpointDto{Url: r.server.URL})
+	d.move(t, "cash", "alice", 100)
+	d.move(t, "cash", "bob", 100)
+	before := d.waitForDeliveries(t, endpoint.Id, 2, hasStatus(DeliveryFailed))
+	d.close()
+	if lines := d.logLines(t); lines != 8 {
+		t.Fatalf("delivery log has %d lines, want one per state of each delivery", lines)
+	}
+
+	d.open(t)
+	if lines := d.logLines(t); lines != 2 {
+		t.Fatalf("delivery log has %d lines after a restart, want one per delivery", lines)
+	}
+	reloaded, err := d.Deliveries(endpoint.Id, DeliveryFilters{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range before {
+		if reloaded[i].Id != before[i].Id || reloaded[i].Status != DeliveryFailed || len(reloaded[i].Attempts) != 3 {
+			t.Fatalf("delivery %d after compaction = %+v, want %+v", i, reloaded[i], before[i])
+		}
+	}
+}
+
+func TestDispatcherForgetsSettledDeliveries(t *testing.T) {
+	r := newReceiver(t, http.StatusOK)
+	d := newTestDispatcher(t, testOptions(2))
+	endpoint := d.register(t, EndpointDto{Url: r.server.URL})
+	d.move(t, "cash", "alice", 100)
+	d.move(t, "cash", "bob", 100)
+	last := d.move(t, "cash", "carol", 100)
+	d.waitForDeliveries(t, endpoint.Id, 3, hasStatus(DeliverySucceeded))
+
+	// Within the retention nothing is forgotten.
+	d.prune(time.Now())
+	d.waitForDeliveries(t, endpoint.Id, 3, hasStatus(DeliverySucceeded))
+
+	// Past it only the latest delivery stays, it marks where events resume.
+	d.prune(time.Now().Add(2 * time.Hour))
+	kept := d.waitForDeliveries(t, endpoint.Id, 1, hasStatus(DeliverySucceeded))
+	if kept[0].Event.Data.Sequence != last.Sequence {
+		t.Fatalf("kept the delivery of entry %d, want the latest, %d", kept[0].Event.Data.Sequence, last.Sequence)
+	}
+	d.close()
+
+	d.open(t)
+	if lines := d.logLines(t); lines != 1 {
+		t.Fatalf("delivery log has %d lines after a restart, want only the kept delivery", lines)
+	}
+	d.move(t, "cash", "dave", 100)
+	d.waitForDeliveries(t, endpoint.Id, 2, hasStatus(DeliverySucceeded))
+	if requests := r.received(); len(requests) != 4 {
+		t.Fatalf("receiver got %d requests, want forgotten deliveries not to be sent again", len(requests))
+	}
+}
+
+func TestRedeliverResetsRetryCount(t *testing.T) {
+	r := newReceiver(t, http.StatusServiceUnavailable)
+	d := newTestDispatcher(t, testOptions(2))
+	endpoint := d.register(t, EndpointDto{Url: r.server.URL})
+	d.move(t, "cash", "alice", 100)
+	failed := d.waitForDeliveries(t, endpoint.Id, 1, hasStatus(DeliveryFailed))[0]
+	if failed.RetryCount != 2 {
+		t.Fatalf("retry count = %d, want 2", failed.RetryCount)
+	}
+
+	r.status.Store(http.StatusOK)
+	scheduled, err := d.Redeliver(endpoint.Id, failed.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scheduled.Status != DeliveryPending || scheduled.RetryCount != 0 || scheduled.Redeliveries != 1 || scheduled.NextAttemptAt == nil {
+		t.Fatalf("redelivery = %+v, want a pending delivery with a fresh retry budget", scheduled)
+	}
+
+	delivered := d.waitForDeliveries(t, endpoint.Id, 1, hasStatus(DeliverySucceeded))[0]
+	if delivered.Id != failed.Id || delivered.RetryCount != 0 || len(delivered.Attempts) != 3 {
+		t.Fatalf("delivery = %+v, want the same delivery with its 3 attempts", delivered)
+	}
+	if requests := r.received(); len(requests) != 3 || requests[2].header.Get(DeliveryHeader) != failed.Id {
+		t.Fatalf("receiver got %d requests, want the redelivery as the third", len(requests))
+	}
+
+	if _, err := d.Redeliver(endpoint.Id, "unknown"); err == nil {
+		t.Fatal("Redeliver accepted an unknown delivery")
+	}
+	other := d.register(t, EndpointDto{Url: r.server.URL})
+	if _, err := d.Redeliver(other.Id, failed.Id); err == nil {
+		t.Fatal("Redeliver accepted a delivery of another endpoint")
+	}
+}
+
+func TestDispatcherFiltersEndpoints(t *testing.T) {
+	r := newReceiver(t, http.StatusOK)
+	d := newTestDispatcher(t, testOptions(2))
+	all := d.register(t, EndpointDto{Url: r.server.URL})
+	bob := d.register(t, EndpointDto{Url: r.server.URL, AccountIds: []string{"bob"}})
+	carolOrBob := d.register(t, EndpointDto{Url: r.server.URL, AccountIds: []string{"carol", "bob"}})
+	reversals := d.register(t, EndpointDto{Url: r.server.URL, Events: []string{EventTransactionReversed}})
+
+	d.move(t, "cash", "alice", 100)
+	toBob := d.move(t, "cash", "bob", 100)
+	fromBob := d.move(t, "bob", "alice", 40)
+	reversal, _, err := transactions.ReverseTransaction(toBob.TransactionId, transactions.ReversalDto{}, utils.GenerateID, utils.GenerateHash, d.transactionDb)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		endpoint Endpoint
+		entries  []string
+	}{
+		{"one account", bob, []string{toBob.TransactionId, fromBob.TransactionId, reversal.TransactionId}},
+		{"several accounts", carolOrBob, []string{toBob.TransactionId, fromBob.TransactionId, reversal.TransactionId}},
+		{"reversals only", reversals, []string{reversal.TransactionId}},
+	}
+	d.waitForDeliveries(t, all.Id, 4, hasStatus(DeliverySucceeded))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deliveries := d.waitForDeliveries(t, tt.endpoint.Id, len(tt.entries), hasStatus(DeliverySucceeded))
+			got := map[string]bool{}
+			for _, delivery := range deliveries {
+				got[delivery.Event.Data.TransactionId] = true
+				if want := EventTransactionCreated; delivery.Event.Data.ReversalOf != "" {
+					want = EventTransactionReversed
+					if delivery.Event.Type != want {
+						t.Fatalf("reversal sent as %q", delivery.Event.Type)
+					}
+				} else if delivery.Event.Type != want {
+					t.Fatalf("entry sent as %q", delivery.Event.Type)
+				}
+			}
+			for _, transactionId := range tt.entries {
+				if !got[transactionId] {
+					t.Fatalf("entry %s was not delivered, got %v", transactionId, got)
+				}
+			}
+		})
+	}
+
+	// Every delivery is settled, nothing else may arrive: 4 + 3 + 3 + 1.
+	time.Sleep(5 * d.options.MaxDelay)
+	if requests := r.received(); len(requests) != 11 {
+		t.Fatalf("receiver got %d requests, want 11", len(requests))
+	}
+}
+
+func TestDispatcherSendsHoldEvents(t *testing.T) {
+	r := newReceiver(t, http.StatusOK)
+	d := newTestDispatcher(t, testOptions(2))
+	all := d.register(t, EndpointDto{Url: r.server.URL})
+	captures := d.register(t, EndpointDto{Url: r.server.URL, Events: []string{EventHoldCaptured}})
+	created := d.register(t, EndpointDto{Url: r.server.URL, Events: []string{EventTransactionCreated}})
+
+	funding := d.move(t, "cash", "alice", 100)
+	authorize := func(expiresAt *time.Time) transactions.Hold {
+		t.Helper()
+		hold, _, err := transactions.AuthorizeHold(transactions.HoldDto{AccountId: "alice", DestinationAccountId: "shop", Asset: "USD", Amount: 10, ExpiresAt: expiresAt}, utils.GenerateID, utils.GenerateHash, d.transactionDb)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hold
+	}
+	captured := authorize(nil)
+	_, capture, err := transactions.CaptureHold(captured.HoldId, transactions.CaptureDto{}, utils.GenerateID, utils.GenerateHash, d.transactionDb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	voided := authorize(nil)
+	if _, _, err := transactions.VoidHold(voided.HoldId, transactions.VoidDto{}, utils.GenerateID, utils.GenerateHash, d.transactionDb); err != nil {
+		t.Fatal(err)
+	}
+	expiresAt := time.Now().Add(20 * time.Millisecond)
+	authorize(&expiresAt)
+	time.Sleep(time.Until(expiresAt))
+	if _, err := d.transactionDb.ExpireHolds(utils.GenerateID, utils.GenerateHash); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		EventTransactionCreated,
+		EventHoldAuthorized, EventHoldCaptured,
+		EventHoldAuthorized, EventHoldVoided,
+		EventHoldAuthorized, EventHoldExpired,
+	}
+	deliveries := d.waitForDeliveries(t, all.Id, len(want), hasStatus(DeliverySucceeded))
+	slices.SortFunc(deliveries, func(a, b Delivery) int {
+		return cmp.Compare(a.Event.Data.Sequence, b.Event.Data.Sequence)
+	})
+	for i, delivery := range deliveries {
+		if delivery.Event.Type != want[i] {
+			t.Fatalf("entry %d sent as %q, want %q", delivery.Event.Data.Sequence, delivery.Event.Type, want[i])
+		}
+	}
+	if deliveries := d.waitForDeliveries(t, captures.Id, 1, hasStatus(DeliverySucceeded)); deliveries[0].Event.Data.TransactionId != capture.TransactionId {
+		t.Fatalf("hold.captured endpoint got entry %s, want %s", deliveries[0].Event.Data.TransactionId, capture.TransactionId)
+	}
+	if deliveries := d.waitForDeliveries(t, created.Id, 1, hasStatus(DeliverySucceeded)); deliveries[0].Event.Data.TransactionId != funding.TransactionId {
+		t.Fatalf("transaction.created endpoint got entry %s, want %s", deliveries[0].Event.Data.TransactionId, funding.TransactionId)
+	}
+}
@@ -0,0 +1,137 @@
+package webhooks
+
+import (
+	"slices"
+	"time"
+
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/transactions"
+)
+
+const (
+	EventTransactionCreated  = "transaction.created"
+	EventTransactionReversed = "transaction.reversed"
+	EventHoldAuthorized      = "hold.authorized"
+	EventHoldCaptured        = "hold.captured"
+	EventHoldVoided          = "hold.voided"
+	EventHoldExpired         = "hold.expired"
+)
+
+// EventTypes lists the events an endpoint can subscribe to.
+var EventTypes = []string{
+	EventTransactionCreated,
+	EventTransactionReversed,
+	EventHoldAuthorized,
+	EventHoldCaptured,
+	EventHoldVoided,
+	EventHoldExpired,
+}
+
+// holdEvents maps the action of a hold entry to its event.
+var holdEvents = map[string]string{
+	transactions.HoldActionAuthorize: EventHoldAuthorized,
+	transactions.HoldActionCapture:   EventHoldCaptured,
+	transactions.HoldActionVoid:      EventHoldVoided,
+	transactions.HoldActionExpire:    EventHoldExpired,
+}
+
+// EventType is the event of a ledger entry: the entries of a hold have their
+// own events, the others are created or reversed transactions.
+func EventType(transaction transactions.TransactionModel) string {
+	switch {
+	case transaction.Hold != nil:
+		return holdEvents[transaction.Hold.Action]
+	case transaction.ReversalOf != "":
+		return EventTransactionReversed
+	default:
+		return EventTransactionCreated
+	}
+}
+
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// Endpoint is a registered webhook receiver. It gets the events of entries
+// appended after StartSequence whose type is in Events and, when AccountIds is
+// set, that post to one of those accounts. The secret signs every payload and
+// is only returned when the endpoint is created.
+type Endpoint struct {
+	Id            string    `json:"id"`
+	Url           string    `json:"url"`
+	Events        []string  `json:"events"`
+	AccountIds    []string  `json:"account_ids,omitempty"`
+	Secret        string    `json:"secret,omitempty"`
+	StartSequence uint64    `json:"start_sequence"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// Redacted is the endpoint as listed by the API, without its secret.
+func (e Endpoint) Redacted() Endpoint {
+	e.Secret = ""
+	return e
+}
+
+// Accepts reports whether an entry with the given event type is delivered to the endpoint.
+func (e Endpoint) Accepts(eventType string, transaction transactions.TransactionModel) bool {
+	if !slices.Contains(e.Events, eventType) {
+		return false
+	}
+	if len(e.AccountIds) == 0 {
+		return true
+	}
+	for _, accountId := range e.AccountIds {
+		if transaction.HasAccount(accountId) {
+			return true
+		}
+	}
+	return false
+}
+
+// EndpointDto registers an endpoint. Without events it subscribes to all of
+// them, without a secret one is generated.
+type EndpointDto struct {
+	Url        string   `json:"url" binding:"required,http_url"`
+	Events     []string `json:"events" binding:"omitempty,dive,oneof=transaction.created transaction.reversed hold.authorized hold.captured hold.voided hold.expired"`
+	AccountIds []string `json:"account_ids" binding:"omitempty,dive,required"`
+	Secret     string   `json:"secret" binding:"omitempty,min=16,max=256"`
+}
+
+// Event is the JSON body posted to an endpoint.
+type Event struct {
+	Id        string                        `json:"id"`
+	Type      string                        `json:"type"`
+	CreatedAt time.Time                     `json:"created_at"`
+	Data      transactions.TransactionModel `json:"data"`
+}
+
+// Delivery tracks an event sent to one endpoint. Every attempt is kept,
+// RetryCount counts the failed attempts since the delivery was last scheduled
+// and sets the backoff before the next one. A manual redelivery schedules it
+// again with a fresh retry budget.
+type Delivery struct {
+	Id            string            `json:"id"`
+	EndpointId    string            `json:"endpoint_id"`
+	Event         Event             `json:"event"`
+	Status        string            `json:"status"`
+	RetryCount    int               `json:"retry_count"`
+	Redeliveries  int               `json:"redeliveries"`
+	NextAttemptAt *time.Time        `json:"next_attempt_at,omitempty"`
+	Attempts      []DeliveryAttempt `json:"attempts"`
+	CreatedAt     time.Time         `json:"created_at"`
+	UpdatedAt     time.Time         `json:"updated_at"`
+}
+
+// DeliveryAttempt is one POST to the endpoint. StatusCode is 0 when no
+// response was received, Error then says why.
+type DeliveryAttempt struct {
+	Timestamp  time.Time `json:"timestamp"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+}
+
+type DeliveryFilters struct {
+	Status string `form:"status" binding:"omitempty,oneof=pending succeeded failed"`
+}
@@ -0,0 +1,105 @@
+package webhooks
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/transactions"
+)
+
+func RegisterEndpointHandler(dispatcher *Dispatcher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var endpointDto EndpointDto
+		if err := c.BindJSON(&endpointDto); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		endpoint, err := dispatcher.Register(endpointDto)
+		if err != nil {
+			transactions.WriteError(c, err)
+			return
+		}
+		c.JSON(201, gin.H{
+			"message":  "Webhook endpoint registered",
+			"endpoint": endpoint,
+		})
+	}
+}
+
+func ListEndpointsHandler(dispatcher *Dispatcher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(200, gin.H{
+			"endpoints": dispatcher.List(),
+		})
+	}
+}
+
+func GetEndpointHandler(dispatcher *Dispatcher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		endpoint, err := dispatcher.Get(c.Param("endpoint_id"))
+		if err != nil {
+			transactions.WriteError(c, err)
+			return
+		}
+		c.JSON(200, gin.H{
+			"endpoint": endpoint,
+		})
+	}
+}
+
+func DeleteEndpointHandler(dispatcher *Dispatcher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := dispatcher.Delete(c.Param("endpoint_id")); err != nil {
+			transactions.WriteError(c, err)
+			return
+		}
+		c.JSON(200, gin.H{
+			"message": "Webhook endpoint deleted",
+		})
+	}
+}
+
+func ListDeliveriesHandler(dispatcher *Dispatcher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var filters DeliveryFilters
+		if err := c.ShouldBindQuery(&filters); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		deliveries, err := dispatcher.Deliveries(c.Param("endpoint_id"), filters)
+		if err != nil {
+			transactions.WriteError(c, err)
+			return
+		}
+		c.JSON(200, gin.H{
+			"deliveries": deliveries,
+		})
+	}
+}
+
+func GetDeliveryHandler(dispatcher *Dispatcher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		delivery, err := dispatcher.Delivery(c.Param("endpoint_id"), c.Param("delivery_id"))
+		if err != nil {
+			transactions.WriteError(c, err)
+			return
+		}
+		c.JSON(200, gin.H{
+			"delivery": delivery,
+		})
+	}
+}
+
+func RedeliverHandler(dispatcher *Dispatcher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		delivery, err := dispatcher.Redeliver(c.Param("endpoint_id"), c.Param("delivery_id"))
+		if err != nil {
+			transactions.WriteError(c, err)
+			return
+		}
+		c.JSON(202, gin.H{
+			"message":  "Delivery scheduled",
+			"delivery": delivery,
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SignatureHeader = "X-Ledger-Signature"
+	EventHeader     = "X-Ledger-Event"
+	DeliveryHeader  = "X-Ledger-Delivery"
+)
+
+// Sign returns the X-Ledger-Signature value of a payload sent at a time:
+// "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<body>">". Signing the
+// timestamp with the body lets a receiver refuse replayed requests.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + t + ",v1=" + hex.EncodeToString(signature(secret, t, body))
+}
+
+// VerifySignature checks a X-Ledger-Signature header against the body. With a
+// tolerance above zero, signatures older or newer than it are refused.
+func VerifySignature(secret string, header string, body []byte, tolerance time.Duration) error {
+	var t string
+	var signatures [][]byte
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			t = value
+		case "v1":
+			if decoded, err := hex.DecodeString(value); err == nil {
+				signatures = append(signatures, decoded)
+			}
+		}
+	}
+	unix, err := strconv.ParseInt(t, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return errors.New("malformed signature header")
+	}
+	if tolerance > 0 {
+		if age := time.Since(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+			return fmt.Errorf("signature timestamp is %s away from now", age.Round(time.Second))
+		}
+	}
+	expected := signature(secret, t, body)
+	for _, candidate := range signatures {
+		if hmac.Equal(candidate, expected) {
+			return nil
+		}
+	}
+	return errors.New("signature does not match")
+}
+
+func signature(secret string, t string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
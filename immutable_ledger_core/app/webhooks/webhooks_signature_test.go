@@ -0,0 +1,60 @@
+package webhooks
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignatureRoundTrip(t *testing.T) {
+	const secret = "whsec_test_secret_value"
+	body := []byte(`{"id":"evt_1","type":"transaction.created"}`)
+	now := time.Now()
+	header := Sign(secret, now, body)
+
+	tests := []struct {
+		name      string
+		secret    string
+		header    string
+		body      []byte
+		tolerance time.Duration
+		valid     bool
+	}{
+		{"untouched", secret, header, body, 5 * time.Minute, true},
+		{"no tolerance", secret, header, body, 0, true},
+		{"body changed", secret, header, []byte(`{"id":"evt_1","type":"transaction.reversed"}`), 5 * time.Minute, false},
+		{"body extended", secret, header, append(body, ' '), 5 * time.Minute, false},
+		{"other secret", "whsec_other_secret_value", header, body, 5 * time.Minute, false},
+		{"signature changed", secret, flipLastHexDigit(header), body, 5 * time.Minute, false},
+		{"timestamp changed", secret, strings.Replace(header, "t=", "t=1", 1), body, 0, false},
+		{"old signature", secret, Sign(secret, now.Add(-10*time.Minute), body), body, 5 * time.Minute, false},
+		{"future signature", secret, Sign(secret, now.Add(10*time.Minute), body), body, 5 * time.Minute, false},
+		{"old signature without tolerance", secret, Sign(secret, now.Add(-10*time.Minute), body), body, 0, true},
+		{"signature within tolerance", secret, Sign(secret, now.Add(-4*time.Minute), body), body, 5 * time.Minute, true},
+		{"one of several signatures", secret, header + ",v1=" + strings.Repeat("00", 32), body, 5 * time.Minute, true},
+		{"no signature", secret, strings.Split(header, ",")[0], body, 0, false},
+		{"no timestamp", secret, strings.Split(header, ",")[1], body, 0, false},
+		{"empty header", secret, "", body, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifySignature(tt.secret, tt.header, tt.body, tt.tolerance)
+			if tt.valid && err != nil {
+				t.Fatalf("VerifySignature(%q) = %v, want nil", tt.header, err)
+			}
+			if !tt.valid && err == nil {
+				t.Fatalf("VerifySignature(%q) accepted a bad signature", tt.header)
+			}
+		})
+	}
+}
+
+func flipLastHexDigit(header string) string {
+	last := header[len(header)-1]
+	replacement := byte('0')
+	if last == '0' {
+		replacement = '1'
+	}
+	return header[:len(header)-1] + string(replacement)
+}
@@ -0,0 +1,170 @@
+// Command ledger-verify checks a ledger exported with
+// GET /ledger/export?format=ndjson without the running service: the genesis
+// link, every content hash, every previous-hash link and the sequence numbers
+// are recomputed from the file alone.
+//
+//	ledger-verify [-json] [-expect-size N] [-expect-last-hash HASH] FILE
+//	ledger-verify [-json] -checkpoint CHECKPOINT -public-key KEY FILE
+//
+// With -checkpoint, the signature of a checkpoint saved from
+// GET /ledger/checkpoints is checked against the hex public key listed there,
+// and the export must end at the signed sequence and last hash.
+//
+// FILE may be "-" to read standard input. The exit status is 0 when the ledger
+// is valid, 1 when it is not and 2 when the file cannot be read.
+package main
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/ledger"
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/transactions"
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/utils"
+)
+
+const (
+	exitValid   = 0
+	exitInvalid = 1
+	exitError   = 2
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run verifies the ledger named by args and returns the exit status, so the
+// input file is closed before the process exits.
+func run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("ledger-verify", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	asJSON := flags.Bool("json", false, "print the verification report as JSON")
+	expectSize := flags.Int("expect-size", -1, "fail unless the ledger has exactly this many entries, e.g. the sequence of a checkpoint")
+	expectLastHash := flags.String("expect-last-hash", "", "fail unless the last entry has this hash, e.g. the last_hash of a checkpoint")
+	checkpointPath := flags.String("checkpoint", "", "a JSON checkpoint whose signature is checked and whose sequence and last_hash the ledger must end at")
+	publicKeyHex := flags.String("public-key", "", "the hex public key the checkpoint must be signed with")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: %s [flags] FILE\n", flags.Name())
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+	if flags.NArg() != 1 || (*checkpointPath == "") != (*publicKeyHex == "") {
+		flags.Usage()
+		return exitError
+	}
+
+	var mismatches []string
+	if *checkpointPath != "" {
+		checkpoint, publicKey, err := loadCheckpoint(*checkpointPath, *publicKeyHex)
+		if err != nil {
+			fmt.Fprintf(stderr, "ledger-verify: %v\n", err)
+			return exitError
+		}
+		if err := ledger.VerifyCheckpoint(publicKey, checkpoint); err != nil {
+			mismatches = append(mismatches, fmt.Sprintf("checkpoint: %v", err))
+		}
+		*expectSize, *expectLastHash = checkpoint.Sequence, checkpoint.LastHash
+	}
+
+	input := stdin
+	if path := flags.Arg(0); path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintf(stderr, "ledger-verify: %v\n", err)
+			return exitError
+		}
+		defer file.Close()
+		input = file
+	}
+
+	report, err := verify(input)
+	if err != nil {
+		fmt.Fprintf(stderr, "ledger-verify: %v\n", err)
+		return exitError
+	}
+
+	if report.Valid && *expectSize >= 0 && report.EntriesChecked != *expectSize {
+		mismatches = append(mismatches, fmt.Sprintf("expected %d entries, found %d", *expectSize, report.EntriesChecked))
+	}
+	if report.Valid && *expectLastHash != "" && report.LastHash != *expectLastHash {
+		mismatches = append(mismatches, fmt.Sprintf("expected last hash %s, found %s", *expectLastHash, report.LastHash))
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(struct {
+			transactions.VerificationReport
+			Mismatches []string `json:"mismatches,omitempty"`
+		}{report, mismatches})
+	} else {
+		printReport(stdout, report, mismatches)
+	}
+
+	if !report.Valid || len(mismatches) > 0 {
+		return exitInvalid
+	}
+	return exitValid
+}
+
+func loadCheckpoint(path string, publicKeyHex string) (ledger.Checkpoint, ed25519.PublicKey, error) {
+	publicKey, err := hex.DecodeString(publicKeyHex)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return ledger.Checkpoint{}, nil, fmt.Errorf("public key must be a hex encoded %d byte Ed25519 key", ed25519.PublicKeySize)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ledger.Checkpoint{}, nil, err
+	}
+	var checkpoint ledger.Checkpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return ledger.Checkpoint{}, nil, fmt.Errorf("decode checkpoint: %w", err)
+	}
+	return checkpoint, publicKey, nil
+}
+
+// verify streams the entries through the same checks the service runs on
+// replay and on GET /ledger/verify.
+func verify(input io.Reader) (transactions.VerificationReport, error) {
+	verifier := transactions.NewChainVerifier(utils.GenerateHash)
+	decoder := json.NewDecoder(bufio.NewReader(input))
+	for line := 1; ; line++ {
+		var entry transactions.TransactionModel
+		err := decoder.Decode(&entry)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return transactions.VerificationReport{}, fmt.Errorf("entry %d: %w", line, err)
+		}
+		if !verifier.Add(entry) {
+			break
+		}
+	}
+	return verifier.Report(), nil
+}
+
+func printReport(output io.Writer, report transactions.VerificationReport, mismatches []string) {
+	if report.Valid {
+		fmt.Fprintf(output, "valid: %d entries checked, last hash %s\n", report.EntriesChecked, report.LastHash)
+	} else {
+		failure := report.Failure
+		fmt.Fprintf(output, "INVALID: %s at position %d (sequence %d, transaction %s)\n", failure.Kind, failure.Position, failure.Sequence, failure.TransactionId)
+		fmt.Fprintf(output, "  %s\n", failure.Message)
+		if failure.Expected != "" || failure.Actual != "" {
+			fmt.Fprintf(output, "  expected: %s\n  actual:   %s\n", failure.Expected, failure.Actual)
+		}
+	}
+	for _, mismatch := range mismatches {
+		fmt.Fprintf(output, "MISMATCH: %s\n", mismatch)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/transactions"
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/utils"
+)
+
+// exportLines returns the NDJSON export of a ledger with three entries, one
+// line per entry.
+func exportLines(t *testing.T) []string {
+	t.Helper()
+	db := transactions.NewSafeTranasctionDatabase()
+	for _, account := range []string{"alice", "bob", "carol"} {
+		_, _, err := transactions.CreateTransaction(transactions.TransactionDto{Postings: []transactions.PostingDto{
+			{AccountId: "cash", Direction: transactions.DirectionDebit, Amount: 100, Unit: "USD"},
+			{AccountId: account, Direction: transactions.DirectionCredit, Amount: 100, Unit: "USD"},
+		}}, utils.GenerateID, utils.GenerateHash, db)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	err := db.ScanEntries(transactions.LedgerFilters{}, uint64(db.Head().Size), func(transaction transactions.TransactionModel) error {
+		return encoder.Encode(transaction)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.SplitAfter(strings.TrimSuffix(buffer.String(), "\n"), "\n")
+}
+
+func TestRunExitStatus(t *testing.T) {
+	lines := exportLines(t)
+	var last transactions.TransactionModel
+	if err := json.Unmarshal([]byte(lines[2]), &last); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		export []string
+		args   []string
+		want   int
+	}{
+		{name: "valid", export: lines, want: exitValid},
+		{name: "matching expectations", export: lines, args: []string{"-expect-size", "3", "-expect-last-hash", last.Hash}, want: exitValid},
+		{name: "tampered amount", export: []string{lines[0], strings.Replace(lines[1], `"amount":100`, `"amount":900`, 1), lines[2]}, want: exitInvalid},
+		{name: "missing entry", export: []string{lines[0], lines[2]}, want: exitInvalid},
+		{name: "duplicated entry", export: []string{lines[0], lines[1], lines[1], lines[2]}, want: exitInvalid},
+		{name: "size mismatch", export: lines, args: []string{"-expect-size", "2"}, want: exitInvalid},
+		{name: "undecodable line", export: []string{lines[0], "{not json\n"}, want: exitError},
+		{name: "no file", args: []string{}, want: exitError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := slices.Clone(tt.args)
+			if tt.export != nil {
+				path := filepath.Join(t.TempDir(), "ledger.ndjson")
+				if err := os.WriteFile(path, []byte(strings.Join(tt.export, "")), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				args = append(args, path)
+			}
+			var stdout, stderr bytes.Buffer
+			if got := run(args, strings.NewReader(""), &stdout, &stderr); got != tt.want {
+				t.Fatalf("run(%q) = %d, want %d\nstdout: %s\nstderr: %s", args, got, tt.want, stdout.String(), stderr.String())
+			}
+		})
+	}
+}
+
+func TestRunReadsStandardInput(t *testing.T) {
+	var stdout bytes.Buffer
+	if got := run([]string{"-json", "-"}, strings.NewReader(strings.Join(exportLines(t), "")), &stdout, io.Discard); got != exitValid {
+		t.Fatalf("run() = %d, want %d", got, exitValid)
+	}
+	var report transactions.VerificationReport
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil || report.EntriesChecked != 3 {
+		t.Fatalf("report = %s (%v), want 3 entries checked", stdout.String(), err)
+	}
+}
@@ -1,19 +1,108 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/accounts"
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/assets"
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/fx"
 	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/ledger"
 	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/transactions"
 	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/utils"
+	"github.com/joserafaelSH/fintech_problems/immutable_ledger_core/app/webhooks"
+)
+
+const (
+	walDirectory       = "data/wal"
+	signingKeyPath     = "data/checkpoint.key"
+	checkpointsPath    = "data/checkpoints.jsonl"
+	policiesPath       = "data/policies.json"
+	accountsPath       = "data/accounts.json"
+	accountAuditPath   = "data/account_audit.jsonl"
+	assetsPath         = "data/assets.json"
+	fxRatesPath        = "data/fx_rates.jsonl"
+	webhooksPath       = "data/webhooks.json"
+	deliveriesPath     = "data/webhook_deliveries.jsonl"
+	checkpointInterval = time.Minute
+	holdExpiryInterval = 10 * time.Second
+	shutdownTimeout    = 10 * time.Second
 )
 
 func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	transactionDb := transactions.NewSafeTranasctionDatabase()
+	storage, err := transactions.OpenSegmentLog(getEnv("LEDGER_WAL_DIR", walDirectory), transactions.DefaultSegmentSize)
+	if err != nil {
+		log.Fatalf("failed to open write-ahead log: %v", err)
+	}
+	hashAlgorithm := getEnv("LEDGER_HASH_ALGORITHM", utils.DefaultHashAlgorithm)
+	transactionDb, err := transactions.OpenTranasctionDatabase(storage, hashAlgorithm, utils.GenerateHash)
+	if err != nil {
+		log.Fatalf("failed to replay ledger: %v", err)
+	}
+
+	defaultPolicy := transactions.BalancePolicy{Type: getEnv("LEDGER_DEFAULT_BALANCE_POLICY", transactions.PolicyNoOverdraft)}
+	if err := transactionDb.SetDefaultBalancePolicy(defaultPolicy); err != nil {
+		log.Fatalf("invalid default balance policy: %v", err)
+	}
+	assetRegistry, err := assets.NewRegistry(getEnv("LEDGER_ASSETS_FILE", assetsPath))
+	if err != nil {
+		log.Fatalf("failed to load assets: %v", err)
+	}
+	transactionDb.SetAssetResolver(assetRegistry.Resolve)
+
+	rateStore, err := fx.NewStore(getEnv("LEDGER_FX_RATES_FILE", fxRatesPath))
+	if err != nil {
+		log.Fatalf("failed to load fx rates: %v", err)
+	}
+
+	registry, err := accounts.NewRegistry(getEnv("LEDGER_ACCOUNTS_FILE", accountsPath), getEnv("LEDGER_ACCOUNT_AUDIT_FILE", accountAuditPath))
+	if err != nil {
+		log.Fatalf("failed to load accounts: %v", err)
+	}
+	transactionDb.SetAccountChecker(registry.CheckPosting)
+
+	policyStore, err := accounts.NewPolicyStore(transactionDb, getEnv("LEDGER_POLICIES_FILE", policiesPath))
+	if err != nil {
+		log.Fatalf("failed to load balance policies: %v", err)
+	}
+
+	signingKey, err := ledger.LoadSigningKey(getEnv("LEDGER_SIGNING_KEY", signingKeyPath))
+	if err != nil {
+		log.Fatalf("failed to load checkpoint signing key: %v", err)
+	}
+	checkpointer, err := ledger.NewCheckpointer(transactionDb, signingKey, getEnv("LEDGER_CHECKPOINTS_FILE", checkpointsPath))
+	if err != nil {
+		log.Fatalf("failed to load checkpoints: %v", err)
+	}
+	go checkpointer.Run(ctx, checkpointInterval)
+	go transactions.RunHoldExpiry(ctx, transactionDb, holdExpiryInterval, utils.GenerateID, utils.GenerateHash)
+
+	webhookOptions := webhooks.DefaultOptions
+	if value := os.Getenv("LEDGER_WEBHOOK_BASE_DELAY"); value != "" {
+		if webhookOptions.BaseDelay, err = time.ParseDuration(value); err != nil {
+			log.Fatalf("invalid webhook base delay: %v", err)
+		}
+	}
+	if value := os.Getenv("LEDGER_WEBHOOK_RETENTION"); value != "" {
+		if webhookOptions.Retention, err = time.ParseDuration(value); err != nil {
+			log.Fatalf("invalid webhook retention: %v", err)
+		}
+	}
+	dispatcher, err := webhooks.NewDispatcher(transactionDb, getEnv("LEDGER_WEBHOOKS_FILE", webhooksPath), getEnv("LEDGER_WEBHOOK_DELIVERIES_FILE", deliveriesPath), utils.GenerateID, webhookOptions)
+	if err != nil {
+		log.Fatalf("failed to load webhooks: %v", err)
+	}
+	go dispatcher.Run(ctx)
 
 	r := gin.Default()
 
@@ -24,12 +113,75 @@ func main() {
 	})
 
 	r.POST("/transactions", transactions.CreateTransactionHandler(transactionDb, utils.GenerateID, utils.GenerateHash))
-	r.GET("/accounts/:account_id/balances", accounts.GetAccountBalanceHanlder(transactionDb))
+	r.POST("/transactions/batch", transactions.CreateTransactionBatchHandler(transactionDb, utils.GenerateID, utils.GenerateHash))
+	r.POST("/transfers", transactions.CreateTransferHandler(transactionDb, utils.GenerateID, utils.GenerateHash))
+	r.GET("/transfers/:transfer_id", transactions.GetTransferHandler(transactionDb))
+	r.POST("/holds", transactions.AuthorizeHoldHandler(transactionDb, utils.GenerateID, utils.GenerateHash))
+	r.GET("/holds", transactions.ListHoldsHandler(transactionDb))
+	r.GET("/holds/:hold_id", transactions.GetHoldHandler(transactionDb))
+	r.POST("/holds/:hold_id/capture", transactions.CaptureHoldHandler(transactionDb, utils.GenerateID, utils.GenerateHash))
+	r.POST("/holds/:hold_id/void", transactions.VoidHoldHandler(transactionDb, utils.GenerateID, utils.GenerateHash))
+	r.POST("/assets", assets.CreateAssetHandler(assetRegistry))
+	r.GET("/assets", assets.ListAssetsHandler(assetRegistry))
+	r.GET("/assets/:code", assets.GetAssetHandler(assetRegistry))
+	r.PATCH("/assets/:code", assets.UpdateAssetHandler(assetRegistry))
+	r.POST("/fx/rates", fx.AddRatesHandler(rateStore))
+	r.GET("/fx/rates", fx.ListRatesHandler(rateStore))
+	r.POST("/accounts", accounts.CreateAccountHandler(registry))
+	r.GET("/accounts", accounts.ListAccountsHandler(registry))
+	r.GET("/accounts/:account_id", accounts.GetAccountHandler(registry))
+	r.POST("/accounts/:account_id/status", accounts.SetAccountStatusHandler(registry))
+	r.GET("/accounts/:account_id/audit", accounts.GetAccountAuditHandler(registry))
+	r.GET("/accounts/:account_id/balances", accounts.GetAccountBalanceHanlder(transactionDb, assetRegistry, rateStore))
+	r.GET("/accounts/:account_id/statement", accounts.GetAccountStatementHandler(transactionDb, assetRegistry))
+	r.GET("/accounts/:account_id/policies", accounts.GetAccountPoliciesHandler(policyStore))
+	r.PUT("/accounts/:account_id/policies", accounts.SetAccountPolicyHandler(policyStore))
+	r.POST("/webhooks", webhooks.RegisterEndpointHandler(dispatcher))
+	r.GET("/webhooks", webhooks.ListEndpointsHandler(dispatcher))
+	r.GET("/webhooks/:endpoint_id", webhooks.GetEndpointHandler(dispatcher))
+	r.DELETE("/webhooks/:endpoint_id", webhooks.DeleteEndpointHandler(dispatcher))
+	r.GET("/webhooks/:endpoint_id/deliveries", webhooks.ListDeliveriesHandler(dispatcher))
+	r.GET("/webhooks/:endpoint_id/deliveries/:delivery_id", webhooks.GetDeliveryHandler(dispatcher))
+	r.POST("/webhooks/:endpoint_id/deliveries/:delivery_id/redeliver", webhooks.RedeliverHandler(dispatcher))
 	r.GET("/ledger", ledger.GetLedger(transactionDb))
-	r.GET("/ledger/verify", transactions.ValidateTransactionHandler(transactionDb))
+	r.GET("/ledger/stream", ledger.StreamLedger(transactionDb))
+	r.GET("/ledger/export", ledger.ExportLedger(transactionDb))
+	r.GET("/ledger/verify", transactions.ValidateTransactionHandler(transactionDb, utils.GenerateHash))
 	r.GET("/ledger/transactions", transactions.ListAllTransactions(transactionDb))
+	r.GET("/ledger/transactions/:id", transactions.GetTransactionHandler(transactionDb))
+	r.GET("/ledger/transactions/:id/proof", ledger.GetTransactionProof(transactionDb))
+	r.POST("/ledger/transactions/:id/reverse", transactions.ReverseTransactionHandler(transactionDb, utils.GenerateID, utils.GenerateHash))
+	r.GET("/ledger/consistency", ledger.GetConsistencyProof(transactionDb))
+	r.GET("/ledger/balances/verify", ledger.CheckBalanceProjection(transactionDb))
+	r.POST("/ledger/balances/rebuild", ledger.RebuildBalanceProjection(transactionDb))
+	r.GET("/ledger/checkpoints", ledger.ListCheckpoints(checkpointer))
+	r.POST("/ledger/checkpoints", ledger.CreateCheckpoint(checkpointer))
+
+	server := &http.Server{Addr: ":3000", Handler: r}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("failed to run server: %v", err)
+		}
+	}()
+
+	// On SIGINT or SIGTERM stop taking requests, let the ones in flight finish,
+	// then close the write-ahead log.
+	<-ctx.Done()
+	stop()
+	log.Printf("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("failed to finish requests in flight: %v", err)
+	}
+	if err := transactionDb.Close(); err != nil {
+		log.Printf("failed to close write-ahead log: %v", err)
+	}
+}
 
-	if err := r.Run(":3000"); err != nil {
-		log.Fatalf("failed to run server: %v", err)
+func getEnv(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
 	}
+	return fallback
 }